@@ -0,0 +1,68 @@
+package main
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/cli"
+	"blockchain-service/internal/utils"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+const(
+	peersPath = "peers.json"
+)
+
+func main() {
+	nodeIdx := flag.Int("nodeIdx", 0, "Node index whose database is opened")
+	network := flag.String("network", "main", "Network the database belongs to")
+	flag.Parse()
+
+	params, err := blockchain.NetworkParams(*network)
+	if err != nil{
+		log.Fatal(err)
+	}
+
+	// under proof-of-authority and BFT the authorities and the node key come
+	// from the peers file, like for the server
+	var key crypto.PrivKey
+	if params.Consensus != blockchain.ConsensusPoW{
+		peers, err := utils.LoadPeers(peersPath)
+		if err != nil{
+			log.Fatalf("Error loading peers: %v", err)
+		}
+		if len(params.Authorities) == 0{
+			params.Authorities = utils.PeerIDs(peers)
+		}
+		if *nodeIdx < len(peers){
+			key, err = utils.UnmarshalPrivateKey(peers[*nodeIdx].PrivKey)
+			if err != nil{
+				log.Fatalf("Failed to load node key: %v", err)
+			}
+		}
+	}
+	// the registry admins must match the server's for blocks with registry
+	// transactions to verify
+	if admins := os.Getenv("REGISTRY_ADMINS"); admins != ""{
+		params.Admins = strings.Split(admins, ",")
+	}
+	engine, err := blockchain.NewEngine(params, key)
+	if err != nil{
+		log.Fatal(err)
+	}
+
+	chain, err := blockchain.InitBlockChain(*nodeIdx, params, engine)
+	if err != nil{
+		log.Fatalf("Failed to open blockchain: %v", err)
+	}
+
+	err = cli.NewCommandLine(chain).Run(flag.Args())
+	chain.Database.Close()
+	if err != nil{
+		log.Println(err)
+		os.Exit(1)
+	}
+}
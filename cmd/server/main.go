@@ -10,6 +10,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
@@ -41,14 +43,42 @@ func main() {
 	peer := peers[*nodeIdx]
 
 
-	blockchain := blockchain.InitBlockChain(*nodeIdx)	
+	network := os.Getenv("NETWORK")
+	if network == ""{
+		network = "main"
+	}
+	params, err := blockchain.NetworkParams(network)
+	if err != nil{
+		log.Panic(err)
+	}
+
+	if params.Consensus != blockchain.ConsensusPoW && len(params.Authorities) == 0{
+		params.Authorities = utils.PeerIDs(peers)
+	}
+	if admins := os.Getenv("REGISTRY_ADMINS"); admins != ""{
+		params.Admins = strings.Split(admins, ",")
+	}
+	key, err := utils.UnmarshalPrivateKey(peer.PrivKey)
+	if err != nil{
+		log.Panicf("Failed to load node key: %v", err)
+	}
+	engine, err := blockchain.NewEngine(params, key)
+	if err != nil{
+		log.Panic(err)
+	}
+
+	blockchain, err := blockchain.InitBlockChain(*nodeIdx, params, engine)
+	if err != nil{
+		log.Panicf("Failed to open blockchain: %v", err)
+	}
 	ctx := context.Background() 
 
 	node, err := p2p.NewBlockchainNode(
 		ctx,
-		"bc/1.0.0",
+		"bc/2.0.0",
 		peer,
 		blockchain,
+		minerConfig(),
 	)
 
 	if err != nil{
@@ -69,15 +99,55 @@ func main() {
 	go node.Run(hostPeers)
 
 
-	app := fiber.New()
+	// request bodies are streamed so that uploaded files are hashed without
+	// being stored; every route but those reading files is then limited
+	app := fiber.New(fiber.Config{
+		StreamRequestBody: true,
+		DisablePreParseMultipartForm: true,
+	})
+	app.Post("/upload/file", pdfHandler.UploadFile)
+	app.Post("/verify/file", pdfHandler.VerifyFile)
+	app.Use(api.BodyLimit(fiber.DefaultBodyLimit))
 
 	app.Get("/hello-world", func(c *fiber.Ctx) error {
 		return c.SendString("Hello World!")
 	})
 
 	app.Post("/upload", pdfHandler.UploadHash)
+	app.Get("/submissions/:id", pdfHandler.GetSubmission)
 	app.Get("/list", pdfHandler.GetBlocks)
 	app.Get("/verify", pdfHandler.VerifyHash)
+	app.Get("/blocks/latest", pdfHandler.GetLatestBlock)
+	app.Get("/blocks/height/:n", pdfHandler.GetBlockByHeight)
+	app.Get("/blocks/:hash", pdfHandler.GetBlockByHash)
+	app.Post("/status", pdfHandler.SubmitStatusTx)
+	app.Post("/notaries", pdfHandler.SubmitNotaryTx)
+	app.Get("/notaries/:id", pdfHandler.GetNotary)
+
+	admin := app.Group("/chain", api.AdminOnly(os.Getenv("ADMIN_TOKEN")))
+	admin.Get("/verify", pdfHandler.VerifyChain)
 	
 	app.Listen(os.Getenv("BASE_URL") + ":" + strconv.Itoa(*fiberPort))
 }
+
+// minerConfig reads BLOCK_MAX_DATA and BLOCK_INTERVAL_MS, falling back to the
+// defaults for unset variables
+func minerConfig() p2p.MinerConfig{
+	config := p2p.DefaultMinerConfig()
+
+	if value := os.Getenv("BLOCK_MAX_DATA"); value != ""{
+		maxData, err := strconv.Atoi(value)
+		if err != nil || maxData < 1{
+			log.Panicf("BLOCK_MAX_DATA must be a positive integer, got %q", value)
+		}
+		config.MaxBlockData = maxData
+	}
+	if value := os.Getenv("BLOCK_INTERVAL_MS"); value != ""{
+		interval, err := strconv.Atoi(value)
+		if err != nil || interval < 1{
+			log.Panicf("BLOCK_INTERVAL_MS must be a positive integer, got %q", value)
+		}
+		config.BlockInterval = time.Duration(interval) * time.Millisecond
+	}
+	return config
+}
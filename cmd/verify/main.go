@@ -0,0 +1,115 @@
+package main
+
+import (
+	"blockchain-service/verify"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	file := flag.String("file", "", "Document whose hash must be anchored in the blocks")
+	algorithm := flag.String("algorithm", verify.HashSHA256, "Hash algorithm of the document: sha256, sha512, sha3-256 or blake3")
+	blockPath := flag.String("block", "", "Exported block, array of blocks or page of GET /list")
+	receiptPath := flag.String("receipt", "", "Receipt, or response of GET /verify?receipt=true")
+	authorities := flag.String("authorities", "", "Comma separated peer IDs of the authorities or validators of the network")
+	minDifficulty := flag.Uint("min-difficulty", verify.MinDifficulty, "Least proof-of-work difficulty accepted")
+	flag.Parse()
+
+	if *blockPath == "" && *receiptPath == ""{
+		fmt.Fprintln(os.Stderr, "Usage: verify [-file document] -block blocks.json | -receipt receipt.json")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	opts := verify.Options{MinDifficulty: uint32(*minDifficulty)}
+	if *authorities != ""{
+		opts.Authorities = strings.Split(*authorities, ",")
+	}
+
+	if err := run(*file, *algorithm, *blockPath, *receiptPath, opts); err != nil{
+		log.Println(err)
+		fmt.Println("Verification FAILED")
+		os.Exit(1)
+	}
+	fmt.Println("Verification OK")
+}
+
+func run(file string, algorithm string, blockPath string, receiptPath string, opts verify.Options) error{
+	blocks := []*verify.Block{}
+	if blockPath != ""{
+		data, err := os.ReadFile(blockPath)
+		if err != nil{
+			return err
+		}
+		blocks, err = verify.ParseBlocks(data)
+		if err != nil{
+			return fmt.Errorf("%s: %w", blockPath, err)
+		}
+	}
+
+	if receiptPath != ""{
+		data, err := os.ReadFile(receiptPath)
+		if err != nil{
+			return err
+		}
+		receipt, err := verify.ParseReceipt(data)
+		if err != nil{
+			return fmt.Errorf("%s: %w", receiptPath, err)
+		}
+		payload, err := receipt.Open()
+		if err != nil{
+			return err
+		}
+		fmt.Printf("Receipt issued by %s at %s, %d confirmations\n", payload.NodeID, time.UnixMilli(payload.IssuedAt).UTC().Format(time.RFC3339), payload.Confirmations)
+		blocks = appendBlock(blocks, &payload.Block)
+	}
+
+	warnings, err := verify.VerifyChain(blocks, opts)
+	for _, warning := range warnings{
+		fmt.Println("Warning:", warning)
+	}
+	if err != nil{
+		return err
+	}
+	first, last := blocks[0], blocks[0]
+	for _, block := range blocks{
+		if block.Height < first.Height{
+			first = block
+		}
+		if block.Height > last.Height{
+			last = block
+		}
+	}
+	fmt.Printf("Blocks %d to %d OK\n", first.Height, last.Height)
+
+	if file == ""{
+		return nil
+	}
+	fileHash, err := verify.HashFile(file, algorithm)
+	if err != nil{
+		return err
+	}
+	block, doc, err := verify.FindDocument(blocks, fileHash)
+	if err != nil{
+		return err
+	}
+	if err := verify.VerifyDocument(block, doc); err != nil{
+		return fmt.Errorf("document %x: %w", fileHash, err)
+	}
+	fmt.Printf("Document %s anchored in block %d (%s) at %s, signed by notary %s\n", doc.Hash, block.Height, block.Hash, time.UnixMilli(block.Timestamp).UTC().Format(time.RFC3339), doc.NotaryID)
+	return nil
+}
+
+// appendBlock adds the block of a receipt unless it was exported too
+func appendBlock(blocks []*verify.Block, block *verify.Block) []*verify.Block{
+	for _, known := range blocks{
+		if known.Hash == block.Hash{
+			return blocks
+		}
+	}
+	return append(blocks, block)
+}
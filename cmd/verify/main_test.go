@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/models"
+	"blockchain-service/verify"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// anchor inserts a block anchoring the document in a new dev chain, unless
+// insert is false, and returns the chain and the block
+func anchor(t *testing.T, data blockchain.BlockData, insert bool) (*blockchain.BlockChain, *blockchain.Block){
+	t.Helper()
+	t.Chdir(t.TempDir())
+	params, err := blockchain.NetworkParams("dev")
+	if err != nil{
+		t.Fatal(err)
+	}
+	engine, err := blockchain.NewEngine(params, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	chain, err := blockchain.InitBlockChain(0, params, engine)
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ chain.Database.Close() })
+
+	block, err := chain.CreateBlock(context.Background(), []blockchain.BlockData{data}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if insert{
+		if err := chain.InsertBlock(block); err != nil{
+			t.Fatal(err)
+		}
+	}
+	return chain, block
+}
+
+// signed returns the entry of file signed by the notary with the given seed
+func signed(t *testing.T, file []byte, seed byte) blockchain.BlockData{
+	t.Helper()
+	hash := sha256.Sum256(file)
+	data := blockchain.BlockData{
+		Hash: hash[:],
+		DocumentID: "mom-deed.pdf",
+		NotaryID: "21122ee1-a5bc-4fcc-bead-065acfc38edf",
+		UserID: "a101fb26-8b78-4e93-9fab-67d291a28fb7",
+		CNPJ: "11.222.333/0001-81",
+	}
+	key := make([]byte, ed25519.SeedSize)
+	key[0] = seed
+	if err := data.Sign(ed25519.NewKeyFromSeed(key)); err != nil{
+		t.Fatal(err)
+	}
+	return data
+}
+
+// write writes the value as JSON, or as is if it is a byte slice, to a file
+// of the test directory and returns its path
+func write(t *testing.T, name string, value any) string{
+	t.Helper()
+	data, ok := value.([]byte)
+	if !ok{
+		var err error
+		if data, err = json.Marshal(value); err != nil{
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil{
+		t.Fatal(err)
+	}
+	return path
+}
+
+// receipt returns a receipt for the block signed by a new node key
+func receipt(t *testing.T, block *blockchain.Block) models.ReceiptAPI{
+	t.Helper()
+	key, pubKey, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil{
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pubKey)
+	if err != nil{
+		t.Fatal(err)
+	}
+	payload, err := models.NewReceiptPayload(id.String(), time.Now().UnixMilli(), block, 1)
+	if err != nil{
+		t.Fatal(err)
+	}
+	signature, err := key.Sign(payload)
+	if err != nil{
+		t.Fatal(err)
+	}
+	raw, err := pubKey.Raw()
+	if err != nil{
+		t.Fatal(err)
+	}
+	return models.NewReceipt(payload, signature, raw, pubKey.Type().String(), id.String())
+}
+
+func TestMatchingDocument(t *testing.T){
+	file := []byte("%PDF-1.7 deed")
+	chain, block := anchor(t, signed(t, file, 0), true)
+	genesis, err := chain.GetBlockByHeight(0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	filePath := write(t, "deed.pdf", file)
+
+	blocks := write(t, "blocks.json", []models.BlockAPI{models.FromBlock(genesis), models.FromBlock(block)})
+	if err := run(filePath, verify.HashSHA256, blocks, "", verify.Options{}); err != nil{
+		t.Fatalf("verify with the blocks: %v", err)
+	}
+	response := write(t, "receipt.json", map[string]any{"result": true, "receipt": receipt(t, block)})
+	if err := run(filePath, verify.HashSHA256, "", response, verify.Options{}); err != nil{
+		t.Fatalf("verify with a receipt: %v", err)
+	}
+
+	other := write(t, "will.pdf", []byte("%PDF-1.7 will"))
+	if err := run(other, verify.HashSHA256, blocks, "", verify.Options{}); !errors.Is(err, verify.ErrDocumentNotFound){
+		t.Fatalf("verify of a document not anchored: %v", err)
+	}
+}
+
+func TestTamperedBlock(t *testing.T){
+	file := []byte("%PDF-1.7 deed")
+	_, block := anchor(t, signed(t, file, 0), true)
+	filePath := write(t, "deed.pdf", file)
+
+	tampered := models.FromBlock(block)
+	tampered.Nonce++
+	blocks := write(t, "blocks.json", tampered)
+	if err := run(filePath, verify.HashSHA256, blocks, "", verify.Options{}); !errors.Is(err, verify.ErrInvalidBlock){
+		t.Fatalf("verify of a tampered block hash: %v", err)
+	}
+
+	tampered = models.FromBlock(block)
+	tampered.Data[0].UserID = "e3b0c442-98fc-4c14-9afb-f4c8996fb924"
+	blocks = write(t, "blocks.json", tampered)
+	if err := run(filePath, verify.HashSHA256, blocks, "", verify.Options{}); !errors.Is(err, verify.ErrInvalidBlock){
+		t.Fatalf("verify of a tampered merkle leaf: %v", err)
+	}
+}
+
+func TestWrongNotarySignature(t *testing.T){
+	file := []byte("%PDF-1.7 deed")
+	data := signed(t, file, 0)
+	data.Signature = signed(t, file, 1).Signature
+	// the chain refuses the document, but the block is sealed as any other
+	_, block := anchor(t, data, false)
+
+	filePath := write(t, "deed.pdf", file)
+	response := write(t, "receipt.json", receipt(t, block))
+	if err := run(filePath, verify.HashSHA256, "", response, verify.Options{}); !errors.Is(err, verify.ErrInvalidSignature){
+		t.Fatalf("verify of a document signed by another key: %v", err)
+	}
+}
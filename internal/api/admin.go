@@ -0,0 +1,29 @@
+package api
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// AdminOnly guards admin routes with the given token, which clients send in
+// the X-Admin-Token header. Admin routes are disabled when token is empty.
+func AdminOnly(token string) fiber.Handler{
+	return func(c *fiber.Ctx) error{
+		if token == ""{
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Admin routes are disabled, set ADMIN_TOKEN to enable them",
+			})
+		}
+
+		provided := c.Get(adminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1{
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid or missing " + adminTokenHeader + " header",
+			})
+		}
+		return c.Next()
+	}
+}
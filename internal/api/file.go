@@ -0,0 +1,153 @@
+package api
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/models"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const(
+	// documentField is the form field holding the document itself
+	documentField = "file"
+	// maxFieldsSize bounds the other form fields together, which are kept in
+	// memory
+	maxFieldsSize = 64 * 1024
+)
+
+// formFields are the form fields accepted besides the document: those of
+// models.BlockDataAPI, and the algorithm, which must match the query parameter
+var formFields = map[string]bool{
+	"hash": true,
+	"momId": true,
+	"notaryId": true,
+	"userId": true,
+	"cnpj": true,
+	"publicKey": true,
+	"signature": true,
+	"algorithm": true,
+}
+
+// documentForm is a multipart form whose document was hashed as it was read
+type documentForm struct{
+	hash []byte
+	fields map[string]string
+}
+
+// readDocumentForm reads a multipart form as it arrives, passing the document
+// through the hash algorithm named by the algorithm query parameter, SHA-256
+// by default, without keeping it and collecting the other fields. A hash
+// field, if sent, must match the document.
+func readDocumentForm(c *fiber.Ctx) (*documentForm, error){
+	algorithm := strings.ToLower(c.Query("algorithm", blockchain.HashSHA256))
+	hasher, err := blockchain.NewDocumentHasher(algorithm)
+	if err != nil{
+		return nil, err
+	}
+
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == ""{
+		return nil, errors.New("Request must have a multipart/form-data body")
+	}
+	body := c.Context().RequestBodyStream()
+	if body == nil{
+		body = bytes.NewReader(c.Body())
+	}
+
+	form := &documentForm{fields: map[string]string{}}
+	remaining := maxFieldsSize
+	reader := multipart.NewReader(body, boundary)
+	for{
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF){
+			break
+		}
+		if err != nil{
+			return nil, fmt.Errorf("Failed to read the form: %v", err)
+		}
+
+		name := part.FormName()
+		if name == documentField{
+			if form.hash != nil{
+				return nil, fmt.Errorf("The form must have a single %s field", documentField)
+			}
+			if _, err := io.Copy(hasher, part); err != nil{
+				return nil, fmt.Errorf("Failed to read the file: %v", err)
+			}
+			form.hash, err = blockchain.DocumentHash(algorithm, hasher.Sum(nil))
+			if err != nil{
+				return nil, err
+			}
+			continue
+		}
+
+		if !formFields[name]{
+			return nil, fmt.Errorf("Unknown form field %q", name)
+		}
+		value, err := io.ReadAll(io.LimitReader(part, int64(remaining)+1))
+		if err != nil{
+			return nil, fmt.Errorf("Failed to read the form: %v", err)
+		}
+		if len(value) > remaining{
+			return nil, fmt.Errorf("The form fields other than %s are too large", documentField)
+		}
+		remaining -= len(value)
+		form.fields[name] = string(value)
+	}
+
+	if form.hash == nil{
+		return nil, fmt.Errorf("The form must have a %s field", documentField)
+	}
+	if provided, ok := form.fields["algorithm"]; ok && !strings.EqualFold(provided, algorithm){
+		return nil, errors.New("The hash algorithm must be given in the algorithm query parameter")
+	}
+	if provided, ok := form.fields["hash"]; ok{
+		hash, err := blockchain.ParseHashString(provided)
+		if err != nil || !bytes.Equal(hash, form.hash){
+			return nil, errors.New("The provided hash does not match the file")
+		}
+	}
+	return form, nil
+}
+
+// UploadFile anchors the document sent in the file field of a multipart
+// form. The other fields are those of BlockDataAPI; hash is computed by the
+// node.
+func (h *NodeAPIHandler) UploadFile(c *fiber.Ctx) error{
+	form, err := readDocumentForm(c)
+	if err != nil{
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	blockDataAPI := models.BlockDataAPI{
+		Hash: blockchain.FormatHash(form.hash),
+		DocumentID: form.fields["momId"],
+		NotaryID: form.fields["notaryId"],
+		UserID: form.fields["userId"],
+		CNPJ: form.fields["cnpj"],
+		PublicKey: form.fields["publicKey"],
+		Signature: form.fields["signature"],
+	}
+	return h.submit(c, &blockDataAPI)
+}
+
+// VerifyFile looks up the document sent in the file field of a multipart
+// form, as GET /verify does for its hash
+func (h *NodeAPIHandler) VerifyFile(c *fiber.Ctx) error{
+	form, err := readDocumentForm(c)
+	if err != nil{
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	return h.verify(c, form.hash)
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/models"
+	"blockchain-service/internal/p2p"
+	"blockchain-service/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// testApp serves the file routes of a node on a new dev chain, which is not
+// connected to any peer
+func testApp(t *testing.T) (*fiber.App, *blockchain.BlockChain){
+	t.Helper()
+	t.Chdir(t.TempDir())
+	params, err := blockchain.NetworkParams("dev")
+	if err != nil{
+		t.Fatal(err)
+	}
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil{
+		t.Fatal(err)
+	}
+	engine, err := blockchain.NewEngine(params, key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	chain, err := blockchain.InitBlockChain(0, params, engine)
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ chain.Database.Close() })
+
+	encoded, err := crypto.MarshalPrivateKey(key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	info := utils.PeerInfo{PrivKey: base64.StdEncoding.EncodeToString(encoded), Address: "/ip4/127.0.0.1/tcp/0"}
+	node, err := p2p.NewBlockchainNode(context.Background(), "bc/test", info, chain, p2p.DefaultMinerConfig())
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ node.Stop() })
+
+	h := &NodeAPIHandler{Node: node}
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
+	app.Post("/upload/file", h.UploadFile)
+	app.Post("/verify/file", h.VerifyFile)
+	return app, chain
+}
+
+// signedFields returns the form fields of file signed by a notary, and the
+// document they describe
+func signedFields(t *testing.T, file []byte) ([][2]string, blockchain.BlockData){
+	t.Helper()
+	hash := sha256.Sum256(file)
+	data := blockchain.BlockData{
+		Hash: hash[:],
+		DocumentID: "mom-deed.pdf",
+		NotaryID: "21122ee1-a5bc-4fcc-bead-065acfc38edf",
+		UserID: "a101fb26-8b78-4e93-9fab-67d291a28fb7",
+		CNPJ: "11.222.333/0001-81",
+	}
+	if err := data.Sign(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))); err != nil{
+		t.Fatal(err)
+	}
+	return [][2]string{
+		{"momId", data.DocumentID},
+		{"notaryId", data.NotaryID},
+		{"userId", data.UserID},
+		{"cnpj", data.CNPJ},
+		{"publicKey", base64.StdEncoding.EncodeToString(data.PublicKey)},
+		{"signature", base64.StdEncoding.EncodeToString(data.Signature)},
+	}, data
+}
+
+// postForm posts the fields and, unless it is nil, the file as a multipart
+// form and returns the status and the decoded JSON body
+func postForm(t *testing.T, app *fiber.App, path string, fields [][2]string, file []byte) (int, map[string]any){
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, field := range fields{
+		if err := w.WriteField(field[0], field[1]); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if file != nil{
+		part, err := w.CreateFormFile(documentField, "deed.pdf")
+		if err != nil{
+			t.Fatal(err)
+		}
+		part.Write(file)
+	}
+	if err := w.Close(); err != nil{
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := app.Test(req)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	decoded := map[string]any{}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil{
+		t.Fatalf("%s answered %d without a JSON body: %v", path, resp.StatusCode, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+func TestUploadFile(t *testing.T){
+	app, _ := testApp(t)
+	file := []byte("%PDF-1.7 deed")
+	fields, data := signedFields(t, file)
+
+	status, body := postForm(t, app, "/upload/file", append(fields, [2]string{"hash", blockchain.FormatHash(data.Hash)}), file)
+	if status != fiber.StatusAccepted{
+		t.Fatalf("upload answered %d: %v", status, body)
+	}
+	if body["hash"] != blockchain.FormatHash(data.Hash) || body["status"] != p2p.SubmissionPending{
+		t.Fatalf("upload answered %v", body)
+	}
+}
+
+func TestFileFormRefused(t *testing.T){
+	app, _ := testApp(t)
+	file := []byte("%PDF-1.7 deed")
+	fields, _ := signedFields(t, file)
+	other := sha256.Sum256([]byte("will.pdf"))
+
+	for _, test := range []struct{
+		name string
+		fields [][2]string
+		file []byte
+		message string
+	}{
+		{"unknown field", append(fields, [2]string{"comment", "urgent"}), file, `Unknown form field "comment"`},
+		{"oversized fields", append(fields, [2]string{"hash", strings.Repeat("a", maxFieldsSize)}), file, "The form fields other than file are too large"},
+		{"missing file", fields, nil, "The form must have a file field"},
+		{"hash mismatch", append(fields, [2]string{"hash", blockchain.FormatHash(other[:])}), file, "The provided hash does not match the file"},
+	}{
+		for _, path := range []string{"/upload/file", "/verify/file"}{
+			status, body := postForm(t, app, path, test.fields, test.file)
+			if status != fiber.StatusBadRequest || body["message"] != test.message{
+				t.Errorf("%s to %s answered %d: %v", test.name, path, status, body)
+			}
+		}
+	}
+}
+
+func TestVerifyFile(t *testing.T){
+	app, chain := testApp(t)
+	file := []byte("%PDF-1.7 deed")
+	fields, data := signedFields(t, file)
+
+	status, body := postForm(t, app, "/verify/file", nil, file)
+	if status != fiber.StatusOK || body["result"] != false{
+		t.Fatalf("verify of a document not on the chain answered %d: %v", status, body)
+	}
+
+	block, err := chain.CreateInsertBlock(context.Background(), []blockchain.BlockData{data}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	status, body = postForm(t, app, "/verify/file", [][2]string{{"hash", blockchain.FormatHash(data.Hash)}}, file)
+	if status != fiber.StatusOK || body["result"] != true{
+		t.Fatalf("verify of an anchored document answered %d: %v", status, body)
+	}
+	var anchor models.AnchorAPI
+	encoded, _ := json.Marshal(body["anchor"])
+	if err := json.Unmarshal(encoded, &anchor); err != nil{
+		t.Fatal(err)
+	}
+	if anchor.Height != block.Height || anchor.Data.DocumentID != fields[0][1]{
+		t.Fatalf("document anchored at height %d as %q, want %d", anchor.Height, anchor.Data.DocumentID, block.Height)
+	}
+}
@@ -1,9 +1,14 @@
 package api
 
 import (
+	"blockchain-service/internal/blockchain"
 	"blockchain-service/internal/models"
 	"blockchain-service/internal/p2p"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
@@ -19,23 +24,59 @@ func (h *NodeAPIHandler) UploadHash(c *fiber.Ctx) error{
 		log.Errorf("Failed to parse body to BlockDataAPI type: %v", err)
 		return c.SendStatus(fiber.ErrBadRequest.Code)
 	}
-	
+
+	return h.submit(c, &blockDataAPI)
+}
+
+// submit anchors a document and answers with its submission status
+func (h *NodeAPIHandler) submit(c *fiber.Ctx, blockDataAPI *models.BlockDataAPI) error{
+	var invalid *models.ValidationError
+	if err := blockDataAPI.Validate(); errors.As(err, &invalid){
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "The document has invalid fields",
+			"errors": invalid.Fields,
+		})
+	}
+
 	blockData, err := blockDataAPI.ToBlockData()
 	if err != nil{
 		log.Errorf("Failed to convert BlockDataAPI to BlockData: %v", err)
 		return c.SendStatus(fiber.ErrBadRequest.Code)
 	}
 
-	block, err := h.Node.AddBlockAPI(blockData)
-
+	status, err := h.Node.SubmitAPI(blockData)
+	if errors.Is(err, blockchain.ErrInvalidHash) || errors.Is(err, blockchain.ErrInvalidSignature){
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	if errors.Is(err, blockchain.ErrUnauthorizedNotary){
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
 	if err != nil{
-		log.Errorf("Failed to add block to blockchain %v", err)
+		log.Errorf("Failed to submit document %s: %v", blockDataAPI.Hash, err)
 		return c.SendStatus(500)
 	}
 
-	blockAPI := models.FromBlock(block)
+	c.Location("/submissions/" + status.Submission.ID)
+	return c.Status(fiber.StatusAccepted).JSON(models.FromSubmission(status))
+}
+
+func (h *NodeAPIHandler) GetSubmission(c *fiber.Ctx) error{
+	status, err := h.Node.SubmissionAPI(c.Params("id"))
+	if errors.Is(err, p2p.ErrSubmissionNotFound){
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Submission not found",
+		})
+	}
+	if err != nil{
+		log.Errorf("Failed to look up submission %s: %v", c.Params("id"), err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
 
-	return c.Status(201).JSON(blockAPI)
+	return c.Status(fiber.StatusOK).JSON(models.FromSubmission(status))
 }
 
 func (h *NodeAPIHandler) VerifyHash(c *fiber.Ctx) error{
@@ -47,25 +88,169 @@ func (h *NodeAPIHandler) VerifyHash(c *fiber.Ctx) error{
 		})
 	}
 	
-	hashBytes, err := hex.DecodeString(hash)
+	hashBytes, err := blockchain.ParseHashString(hash)
 	if err != nil{
 		log.Errorf("Failed to convert provided string to bytes: %v", err)
 		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
-			"message": "The provided hash is invalid",
+			"message": "The provided hash is invalid: " + err.Error(),
 		})
 	}
 
-	containsHash := h.Node.ContainsFileHashAPI(hashBytes)
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"result": containsHash,
-	})
+	return h.verify(c, hashBytes)
+}
+
+// verify answers with the status, history and anchor of a document
+func (h *NodeAPIHandler) verify(c *fiber.Ctx, hashBytes []byte) error{
+	hash := blockchain.FormatHash(hashBytes)
+	events, err := h.Node.DocumentHistoryAPI(hashBytes)
+	if err != nil{
+		log.Errorf("Failed to look up the history of hash %s: %v", hash, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	status, history := models.FromDocumentHistory(events)
+
+	block, confirmations, err := h.Node.FindFileHashAPI(hashBytes)
+	if errors.Is(err, blockchain.ErrBlockNotFound){
+		return c.Status(fiber.StatusOK).JSON(models.VerifyResponseAPI{
+			Result: false,
+			Status: status,
+			History: history,
+		})
+	}
+	if err != nil{
+		log.Errorf("Failed to look up hash %s: %v", hash, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// the file index points at a block that does not hold the document
+	index := block.FindData(hashBytes)
+	if index < 0{
+		log.Errorf("Block %x indexed for hash %s does not anchor it", block.Hash, hash)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	anchor, err := models.FromAnchor(block, hashBytes, confirmations)
+	if err != nil{
+		log.Errorf("Failed to describe the anchor of hash %s: %v", hash, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if h.Node.RegistryEnabledAPI(){
+		data := &block.Data[index]
+		record, authorized, err := h.Node.NotaryAuthorizedAPI(data, block.Height)
+		if err != nil{
+			log.Errorf("Failed to look up notary %s: %v", data.NotaryID, err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		status := models.FromNotaryStatus(record, authorized)
+		anchor.Notary = &status
+	}
+	response := models.VerifyResponseAPI{
+		Result: true,
+		Status: status,
+		History: history,
+		Anchor: &anchor,
+	}
+
+	if c.QueryBool("receipt", false){
+		receipt, err := h.signReceipt(block, confirmations)
+		if err != nil{
+			log.Errorf("Failed to sign receipt for hash %s: %v", hash, err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		response.Receipt = receipt
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// signReceipt builds an inclusion receipt for block signed with the node key
+func (h *NodeAPIHandler) signReceipt(block *blockchain.Block, confirmations uint64) (*models.ReceiptAPI, error){
+	nodeID := h.Node.ID().String()
+	payload, err := models.NewReceiptPayload(nodeID, time.Now().UnixMilli(), block, confirmations)
+	if err != nil{
+		return nil, err
+	}
+
+	signature, pubKey, err := h.Node.Sign(payload)
+	if err != nil{
+		return nil, err
+	}
+	rawKey, err := pubKey.Raw()
+	if err != nil{
+		return nil, err
+	}
+
+	receipt := models.NewReceipt(payload, signature, rawKey, pubKey.Type().String(), nodeID)
+	return &receipt, nil
 }
 
 func (h *NodeAPIHandler) GetBlocks(c *fiber.Ctx) error{
-	blocks, err := h.Node.ListBlocksAPI()
+	query, err := h.parseBlockPageQuery(c)
+	if err != nil{
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	page, err := h.Node.ListBlocksPageAPI(*query)
+	if err != nil{
+		log.Errorf("Failed to list blocks: %v", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.FromBlockPage(page))
+}
+
+func (h *NodeAPIHandler) VerifyChain(c *fiber.Ctx) error{
+	report, err := h.Node.VerifyChainAPI()
+	if err != nil{
+		log.Errorf("Failed to verify chain: %v", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+func (h *NodeAPIHandler) GetBlockByHash(c *fiber.Ctx) error{
+	hashBytes, err := hex.DecodeString(c.Params("hash"))
+	if err != nil || len(hashBytes) != sha256.Size{
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": "The provided hash is invalid",
+		})
+	}
+
+	block, err := h.Node.GetBlockByHashAPI(hashBytes)
+	return sendBlock(c, block, err)
+}
+
+func (h *NodeAPIHandler) GetBlockByHeight(c *fiber.Ctx) error{
+	height, err := strconv.ParseUint(c.Params("n"), 10, 64)
+	if err != nil{
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": "The provided height is invalid",
+		})
+	}
+
+	block, err := h.Node.GetBlockByHeightAPI(height)
+	return sendBlock(c, block, err)
+}
+
+func (h *NodeAPIHandler) GetLatestBlock(c *fiber.Ctx) error{
+	block, err := h.Node.LatestBlockAPI()
+	return sendBlock(c, block, err)
+}
+
+// sendBlock answers with the block, 404 if it was not found or 500 on any
+// other lookup error
+func sendBlock(c *fiber.Ctx, block *blockchain.Block, err error) error{
+	if errors.Is(err, blockchain.ErrBlockNotFound){
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Block not found",
+		})
+	}
 	if err != nil{
-		c.SendStatus(500)
+		log.Errorf("Failed to get block: %v", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	return c.Status(fiber.StatusOK).JSON(blocks)
+	return c.Status(fiber.StatusOK).JSON(models.FromBlock(block))
 }
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"blockchain-service/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUploadInvalidFields(t *testing.T){
+	// the fields are validated before the node is used
+	h := &NodeAPIHandler{}
+	app := fiber.New()
+	app.Post("/upload", h.UploadHash)
+
+	body := `{"hash":"sha256:00","momId":"","notaryId":"21122ee1-a5bc-4fcc-bead-065acfc38edf","userId":"user","cnpj":"11222333000182","publicKey":"cHVibGljS2V5","signature":"!"}`
+	req := httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusUnprocessableEntity{
+		t.Fatalf("status %d, want 422", resp.StatusCode)
+	}
+
+	var got struct{
+		Message string `json:"message"`
+		Errors []models.FieldError `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil{
+		t.Fatal(err)
+	}
+	want := []models.FieldError{
+		{Field: "hash", Message: "sha256 digests are 32 bytes, got 1"},
+		{Field: "momId", Message: "is required"},
+		{Field: "userId", Message: "must be a UUID like a101fb26-8b78-4e93-9fab-67d291a28fb7"},
+		{Field: "cnpj", Message: "has invalid check digits"},
+		{Field: "signature", Message: "must be standard base64"},
+	}
+	if got.Message != "The document has invalid fields" || !reflect.DeepEqual(got.Errors, want){
+		t.Fatalf("422 body %+v, want the errors %+v", got, want)
+	}
+}
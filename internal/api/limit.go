@@ -0,0 +1,38 @@
+package api
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit refuses request bodies larger than limit bytes. The server
+// streams request bodies so that uploaded files can be hashed as they arrive,
+// which lifts fiber's own limit: every route reading its whole body must be
+// guarded by this one instead.
+func BodyLimit(limit int) fiber.Handler{
+	return func(c *fiber.Ctx) error{
+		length := c.Request().Header.ContentLength()
+		if length > limit{
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"message": "Request body is too large",
+			})
+		}
+
+		// a chunked body has no length: it is read up to the limit
+		stream := c.Context().RequestBodyStream()
+		if length < 0 && stream != nil{
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil{
+				return c.SendStatus(fiber.ErrBadRequest.Code)
+			}
+			if len(body) > limit{
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+					"message": "Request body is too large",
+				})
+			}
+			c.Request().SetBody(body)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"blockchain-service/internal/blockchain"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const(
+	defaultPageLimit = 20
+	maxPageLimit = 100
+)
+
+// parseBlockPageQuery reads the pagination, ordering and filter query
+// parameters of GET /list
+func (h *NodeAPIHandler) parseBlockPageQuery(c *fiber.Ctx) (*blockchain.BlockPageQuery, error){
+	query := &blockchain.BlockPageQuery{
+		Limit: defaultPageLimit,
+		Filter: blockchain.BlockFilter{
+			NotaryID: c.Query("notaryId"),
+			UserID: c.Query("userId"),
+			CNPJ: c.Query("cnpj"),
+			DocumentID: c.Query("momId"),
+		},
+	}
+
+	if limit := c.Query("limit"); limit != ""{
+		n, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil || n == 0 || n > maxPageLimit{
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		query.Limit = n
+	}
+
+	switch c.Query("order", "desc"){
+	case "asc":
+		query.Ascending = true
+	case "desc":
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	if query.Before, err = h.parseCursor(c.Query("before")); err != nil{
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	if query.After, err = h.parseCursor(c.Query("after")); err != nil{
+		return nil, fmt.Errorf("after: %w", err)
+	}
+
+	if query.Filter.Since, err = parseTimestamp(c.Query("since")); err != nil{
+		return nil, fmt.Errorf("since: %w", err)
+	}
+	if query.Filter.Until, err = parseTimestamp(c.Query("until")); err != nil{
+		return nil, fmt.Errorf("until: %w", err)
+	}
+
+	return query, nil
+}
+
+// parseCursor accepts a block height or a hex encoded block hash and returns
+// the height it refers to, or nil for an empty cursor
+func (h *NodeAPIHandler) parseCursor(cursor string) (*uint64, error){
+	if cursor == ""{
+		return nil, nil
+	}
+
+	if len(cursor) != 2*sha256.Size{
+		height, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil{
+			return nil, errors.New("cursor must be a block height or hash")
+		}
+		return &height, nil
+	}
+
+	hash, err := hex.DecodeString(cursor)
+	if err != nil{
+		return nil, errors.New("cursor must be a block height or hash")
+	}
+	block, err := h.Node.GetBlockByHashAPI(hash)
+	if err != nil{
+		return nil, fmt.Errorf("unknown block %s", cursor)
+	}
+	return &block.Height, nil
+}
+
+func parseTimestamp(value string) (int64, error){
+	if value == ""{
+		return 0, nil
+	}
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ts < 0{
+		return 0, errors.New("timestamp must be milliseconds since the epoch")
+	}
+	return ts, nil
+}
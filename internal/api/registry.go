@@ -0,0 +1,62 @@
+package api
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/models"
+	"encoding/hex"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// SubmitNotaryTx queues a notary registry transaction signed by an admin
+func (h *NodeAPIHandler) SubmitNotaryTx(c *fiber.Ctx) error{
+	var txAPI models.NotaryTxAPI
+	if err := c.BodyParser(&txAPI); err != nil{
+		log.Errorf("Failed to parse body to NotaryTxAPI type: %v", err)
+		return c.SendStatus(fiber.ErrBadRequest.Code)
+	}
+
+	tx, err := txAPI.ToNotaryTx()
+	if err != nil{
+		log.Errorf("Failed to convert NotaryTxAPI to NotaryTx: %v", err)
+		return c.SendStatus(fiber.ErrBadRequest.Code)
+	}
+
+	err = h.Node.SubmitNotaryAPI(tx)
+	if errors.Is(err, blockchain.ErrRegistryDisabled){
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	if errors.Is(err, blockchain.ErrInvalidNotaryTx){
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	if err != nil{
+		log.Errorf("Failed to submit notary tx for %s: %v", tx.NotaryID, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"txHash": hex.EncodeToString(tx.Hash()),
+	})
+}
+
+// GetNotary answers with the registry record of a notary and its history
+func (h *NodeAPIHandler) GetNotary(c *fiber.Ctx) error{
+	history, err := h.Node.NotaryAPI(c.Params("id"))
+	if errors.Is(err, blockchain.ErrNotaryNotFound){
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Notary not found",
+		})
+	}
+	if err != nil{
+		log.Errorf("Failed to look up notary %s: %v", c.Params("id"), err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.FromNotaryHistory(history))
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/models"
+	"encoding/hex"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// SubmitStatusTx queues the revocation or supersession of an anchored
+// document, signed by its notary
+func (h *NodeAPIHandler) SubmitStatusTx(c *fiber.Ctx) error{
+	var txAPI models.StatusTxAPI
+	if err := c.BodyParser(&txAPI); err != nil{
+		log.Errorf("Failed to parse body to StatusTxAPI type: %v", err)
+		return c.SendStatus(fiber.ErrBadRequest.Code)
+	}
+
+	tx, err := txAPI.ToStatusTx()
+	if err != nil{
+		log.Errorf("Failed to convert StatusTxAPI to StatusTx: %v", err)
+		return c.SendStatus(fiber.ErrBadRequest.Code)
+	}
+
+	err = h.Node.SubmitStatusAPI(tx)
+	if errors.Is(err, blockchain.ErrInvalidStatusTx){
+		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	if err != nil{
+		log.Errorf("Failed to submit status tx for %s: %v", txAPI.Target, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"txHash": hex.EncodeToString(tx.Hash()),
+	})
+}
@@ -0,0 +1,786 @@
+package bft
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Default timeouts. Each round waits TimeoutDelta longer than the previous
+// one, so that slow validators eventually catch up.
+const(
+	DefaultTimeoutPropose = 3 * time.Second
+	DefaultTimeoutPrevote = time.Second
+	DefaultTimeoutPrecommit = time.Second
+	DefaultTimeoutDelta = 500 * time.Millisecond
+	DefaultRebroadcastInterval = 2 * time.Second
+)
+
+const(
+	// messageQueueSize is the number of received messages waiting to be
+	// handled before new ones are dropped
+	messageQueueSize = 1024
+	// maxFutureMessages is the number of messages for the next height kept
+	// until this node commits the current one
+	maxFutureMessages = 1024
+)
+
+// Step is the step of a round
+type Step uint8
+
+const(
+	StepPropose Step = iota
+	StepPrevote
+	StepPrecommit
+)
+
+// Transport broadcasts consensus messages to the other validators
+type Transport interface{
+	Broadcast(msg *Message)
+}
+
+// Application is the chain that blocks are finalized onto
+type Application interface{
+	// LastBlock returns the last committed block, the parent of the height
+	// being decided
+	LastBlock() (*blockchain.Block, error)
+	// Pending reports whether there are documents waiting for a block
+	Pending() bool
+	// ProposeBlock returns a new block on top of parent, or nil when there is
+	// nothing to propose
+	ProposeBlock(parent *blockchain.Block) (*blockchain.Block, error)
+	// ValidateBlock checks a proposed block on top of parent
+	ValidateBlock(parent *blockchain.Block, block *blockchain.Block) error
+	// Commit stores a block carrying its commit
+	Commit(block *blockchain.Block) error
+}
+
+// Config of a Consensus. Key is nil on nodes that only follow the
+// validators. Every RebroadcastInterval a validator sends its messages of the
+// current round again, since the transport may lose them.
+type Config struct{
+	Validators []peer.ID
+	Key crypto.PrivKey
+	TimeoutPropose time.Duration
+	TimeoutPrevote time.Duration
+	TimeoutPrecommit time.Duration
+	TimeoutDelta time.Duration
+	RebroadcastInterval time.Duration
+}
+
+func DefaultConfig(validators []peer.ID, key crypto.PrivKey) Config{
+	return Config{
+		Validators: validators,
+		Key: key,
+		TimeoutPropose: DefaultTimeoutPropose,
+		TimeoutPrevote: DefaultTimeoutPrevote,
+		TimeoutPrecommit: DefaultTimeoutPrecommit,
+		TimeoutDelta: DefaultTimeoutDelta,
+		RebroadcastInterval: DefaultRebroadcastInterval,
+	}
+}
+
+type timeout struct{
+	height uint64
+	round uint32
+	step Step
+}
+
+// one-shot rules of a round
+const(
+	rulePrevoteWait = iota
+	rulePolka
+	rulePrecommitWait
+	ruleCommit
+)
+
+type trigger struct{
+	rule int
+	round uint32
+}
+
+// Consensus runs the protocol for one validator, or follows it on a node
+// outside the validator set. Heights are only started while the application
+// has pending documents or another validator is already deciding one, so an
+// idle network exchanges no messages.
+type Consensus struct{
+	config Config
+	app Application
+	transport Transport
+	storage *Storage
+	id peer.ID
+	validator bool
+	quorum int
+
+	ctx context.Context
+	messages chan *Message
+	timeouts chan timeout
+	kick chan struct{}
+
+	// state of the height being decided, only touched by Run
+	lastCommit *blockchain.Block
+	behind bool
+	height uint64
+	round uint32
+	step Step
+	active bool
+	parent *blockchain.Block
+	lockedRound int32
+	lockedBlock *blockchain.Block
+	validRound int32
+	validBlock *blockchain.Block
+	proposals map[uint32]*Proposal
+	prevotes map[uint32]map[peer.ID]*Vote
+	precommits map[uint32]map[peer.ID]*Vote
+	valid map[string]bool
+	triggered map[trigger]bool
+	future []*Message
+	// signed is the stored lock and last votes of this validator
+	signed State
+}
+
+// New creates the consensus of a validator, or of a follower when
+// config.Key is not one of the validators. A validator resumes from the lock
+// and votes in storage.
+func New(config Config, app Application, transport Transport, storage *Storage) (*Consensus, error){
+	if len(config.Validators) == 0{
+		return nil, fmt.Errorf("no validators")
+	}
+
+	c := &Consensus{
+		config: config,
+		app: app,
+		transport: transport,
+		storage: storage,
+		quorum: blockchain.Quorum(len(config.Validators)),
+		messages: make(chan *Message, messageQueueSize),
+		timeouts: make(chan timeout, messageQueueSize),
+		kick: make(chan struct{}, 1),
+	}
+	if config.Key != nil{
+		id, err := peer.IDFromPrivateKey(config.Key)
+		if err != nil{
+			return nil, err
+		}
+		c.id = id
+		c.validator = c.isValidator(id)
+	}
+
+	state, err := storage.State()
+	if err != nil{
+		return nil, err
+	}
+	c.signed = state
+	return c, nil
+}
+
+// Receive queues a message from another validator. It never blocks; when
+// the queue is full the message is dropped, which the protocol tolerates.
+func (c *Consensus) Receive(msg *Message){
+	select{
+	case c.messages <- msg:
+	default:
+		log.Printf("Consensus queue full, dropping message for height %d", msg.Height())
+	}
+}
+
+// Kick tells the consensus that documents are pending or that the chain
+// advanced without it, e.g. through sync
+func (c *Consensus) Kick(){
+	select{
+	case c.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run decides heights until ctx is done
+func (c *Consensus) Run(ctx context.Context) error{
+	c.ctx = ctx
+	if err := c.newHeight(); err != nil{
+		return err
+	}
+
+	ticker := time.NewTicker(c.config.RebroadcastInterval)
+	defer ticker.Stop()
+	for{
+		select{
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			c.rebroadcast()
+		case msg := <-c.messages:
+			c.handleMessage(msg)
+		case t := <-c.timeouts:
+			c.handleTimeout(t)
+		case <-c.kick:
+			c.handleKick()
+		}
+	}
+}
+
+func (c *Consensus) isValidator(id peer.ID) bool{
+	for _, validator := range c.config.Validators{
+		if validator == id{
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Consensus) proposer(height uint64, round uint32) peer.ID{
+	count := uint64(len(c.config.Validators))
+	return c.config.Validators[(height+uint64(round))%count]
+}
+
+// newHeight moves to the height above the last committed block, unless the
+// chain did not advance
+func (c *Consensus) newHeight() error{
+	parent, err := c.app.LastBlock()
+	if err != nil{
+		return err
+	}
+	if c.parent != nil && parent.Height < c.height{
+		return nil
+	}
+
+	c.parent = parent
+	c.lastCommit = nil
+	if parent.IsFinal(){
+		c.lastCommit = parent
+	}
+	c.behind = false
+	c.height = parent.Height + 1
+	c.round = 0
+	c.step = StepPropose
+	c.active = false
+	c.lockedRound = -1
+	c.lockedBlock = nil
+	c.validRound = -1
+	c.validBlock = nil
+	c.proposals = map[uint32]*Proposal{}
+	c.prevotes = map[uint32]map[peer.ID]*Vote{}
+	c.precommits = map[uint32]map[peer.ID]*Vote{}
+	c.valid = map[string]bool{}
+	c.triggered = map[trigger]bool{}
+	c.resume()
+
+	future := c.future
+	c.future = nil
+	for _, msg := range future{
+		c.handleMessage(msg)
+	}
+	if !c.active && c.app.Pending(){
+		c.startRound(c.round)
+		c.checkRules()
+	}
+	return nil
+}
+
+// resume restores the lock and the votes this validator signed for the new
+// height before it restarted, and moves to the round of its last vote
+func (c *Consensus) resume(){
+	state := c.signed
+	if state.Height != c.height{
+		return
+	}
+	c.round = state.Round
+	c.lockedRound, c.lockedBlock = state.LockedRound, state.LockedBlock
+	c.validRound, c.validBlock = state.LockedRound, state.LockedBlock
+	for _, v := range []*Vote{state.Prevote, state.Precommit}{
+		if v == nil || v.Height != c.height{
+			continue
+		}
+		if err := c.addVote(v); err != nil{
+			log.Printf("Failed to restore own vote: %v", err)
+		}
+	}
+}
+
+func (c *Consensus) handleKick(){
+	parent, err := c.app.LastBlock()
+	if err != nil{
+		log.Printf("Consensus cannot read the last block: %v", err)
+		return
+	}
+	if parent.Height >= c.height{
+		if err := c.newHeight(); err != nil{
+			log.Printf("Consensus cannot start height %d: %v", parent.Height+1, err)
+		}
+		return
+	}
+	if !c.active && c.app.Pending(){
+		c.startRound(c.round)
+		c.checkRules()
+	}
+}
+
+func (c *Consensus) handleMessage(msg *Message){
+	height := msg.Height()
+	if height < c.height{
+		// the sender is still deciding a height we committed
+		c.behind = c.behind || height+1 == c.height
+		return
+	}
+	if height > c.height{
+		if height == c.height+1 && len(c.future) < maxFutureMessages{
+			c.future = append(c.future, msg)
+		}
+		return
+	}
+
+	switch{
+	case msg.Proposal != nil:
+		if err := c.addProposal(msg.Proposal); err != nil{
+			log.Printf("Ignoring proposal for height %d round %d: %v", msg.Proposal.Height, msg.Proposal.Round, err)
+			return
+		}
+	case msg.Vote != nil:
+		if err := c.addVote(msg.Vote); err != nil{
+			log.Printf("Ignoring vote for height %d round %d: %v", msg.Vote.Height, msg.Vote.Round, err)
+			return
+		}
+	case msg.Commit != nil:
+		if err := c.verifyCommit(msg.Commit); err != nil{
+			log.Printf("Ignoring commit for height %d: %v", msg.Commit.Height, err)
+			return
+		}
+		c.finalize(msg.Commit)
+		return
+	default:
+		return
+	}
+
+	if !c.active{
+		c.startRound(c.round)
+	}
+	c.checkRules()
+}
+
+func (c *Consensus) addProposal(p *Proposal) error{
+	if _, ok := c.proposals[p.Round]; ok{
+		return nil
+	}
+	if p.Block == nil || p.Block.Height != p.Height{
+		return fmt.Errorf("proposal without a block for its height")
+	}
+	if p.POLRound < -1 || p.POLRound >= int32(p.Round){
+		return fmt.Errorf("invalid POL round %d", p.POLRound)
+	}
+
+	proposer := c.proposer(p.Height, p.Round)
+	if p.Proposer != proposer.String() || !bytes.Equal(p.Block.Signer, []byte(proposer)){
+		return fmt.Errorf("%s is not the proposer", p.Proposer)
+	}
+	if _, err := verifySignature(p.Proposer, proposalSignBytes(p), p.Signature); err != nil{
+		return err
+	}
+
+	c.proposals[p.Round] = p
+	return nil
+}
+
+func (c *Consensus) addVote(v *Vote) error{
+	var votes map[uint32]map[peer.ID]*Vote
+	switch v.Type{
+	case blockchain.VotePrevote:
+		votes = c.prevotes
+	case blockchain.VotePrecommit:
+		votes = c.precommits
+	default:
+		return fmt.Errorf("unknown vote type %d", v.Type)
+	}
+
+	// the first vote of a validator counts, a conflicting one is ignored
+	if id, err := peer.Decode(v.Validator); err == nil{
+		if _, ok := votes[v.Round][id]; ok{
+			return nil
+		}
+	}
+
+	validator, err := verifySignature(v.Validator, voteSignBytes(v), v.Signature)
+	if err != nil{
+		return err
+	}
+	if !c.isValidator(validator){
+		return fmt.Errorf("%s is not a validator", validator)
+	}
+
+	if votes[v.Round] == nil{
+		votes[v.Round] = map[peer.ID]*Vote{}
+	}
+	votes[v.Round][validator] = v
+	return nil
+}
+
+// startRound enters a round, proposing when this node is the proposer. The
+// caller runs checkRules afterwards.
+func (c *Consensus) startRound(round uint32){
+	c.active = true
+	c.round = round
+	c.step = StepPropose
+
+	if c.validator && c.proposer(c.height, round) == c.id{
+		c.propose()
+	}
+	c.schedule(c.config.TimeoutPropose, StepPropose)
+}
+
+func (c *Consensus) propose(){
+	block, polRound := c.validBlock, c.validRound
+	if block == nil{
+		var err error
+		block, err = c.app.ProposeBlock(c.parent)
+		if err != nil{
+			log.Printf("Failed to build a proposal for height %d: %v", c.height, err)
+			return
+		}
+		if block == nil{
+			return
+		}
+		polRound = -1
+	}
+
+	proposal := &Proposal{
+		Height: c.height,
+		Round: c.round,
+		POLRound: polRound,
+		Block: block,
+		Proposer: c.id.String(),
+	}
+	if err := signProposal(c.config.Key, proposal); err != nil{
+		log.Printf("Failed to sign proposal for height %d: %v", c.height, err)
+		return
+	}
+	c.proposals[c.round] = proposal
+	c.transport.Broadcast(&Message{Proposal: proposal})
+}
+
+func (c *Consensus) schedule(base time.Duration, step Step){
+	t := timeout{c.height, c.round, step}
+	delay := base + time.Duration(c.round)*c.config.TimeoutDelta
+	time.AfterFunc(delay, func(){
+		select{
+		case c.timeouts <- t:
+		case <-c.ctx.Done():
+		}
+	})
+}
+
+func (c *Consensus) handleTimeout(t timeout){
+	if t.height != c.height || t.round != c.round || !c.active{
+		return
+	}
+
+	switch t.step{
+	case StepPropose:
+		if c.step == StepPropose{
+			c.vote(blockchain.VotePrevote, nil)
+		}
+	case StepPrevote:
+		if c.step == StepPrevote{
+			c.vote(blockchain.VotePrecommit, nil)
+		}
+	case StepPrecommit:
+		if c.lockedBlock == nil && c.validBlock == nil && !c.app.Pending(){
+			// nothing left to decide: wait for documents or for another
+			// validator before running the next round
+			c.round++
+			c.step = StepPropose
+			c.active = false
+			return
+		}
+		c.startRound(c.round + 1)
+	}
+	c.checkRules()
+}
+
+// vote casts a prevote or precommit for the current round and moves to the
+// matching step. Nodes outside the validator set only move. The vote and the
+// lock are stored before the vote is sent, and a validator never signs a
+// vote for a step it already voted in or left: it sends the vote it signed
+// then again, if any.
+func (c *Consensus) vote(voteType byte, hash []byte){
+	last := c.signed.Prevote
+	if voteType == blockchain.VotePrevote{
+		c.step = StepPrevote
+	} else {
+		c.step = StepPrecommit
+		last = c.signed.Precommit
+	}
+	if !c.validator{
+		return
+	}
+	if last != nil && last.Height == c.height && last.Round == c.round{
+		c.transport.Broadcast(&Message{Vote: last})
+		return
+	}
+	if c.signed.signedSince(c.height, c.round, c.step){
+		return
+	}
+
+	v := &Vote{
+		Type: voteType,
+		Height: c.height,
+		Round: c.round,
+		BlockHash: hash,
+		Validator: c.id.String(),
+	}
+	if err := signVote(c.config.Key, v); err != nil{
+		log.Printf("Failed to sign vote for height %d: %v", c.height, err)
+		return
+	}
+
+	state := State{
+		Height: c.height,
+		Round: c.round,
+		Step: c.step,
+		LockedRound: c.lockedRound,
+		LockedBlock: c.lockedBlock,
+		Prevote: c.signed.Prevote,
+		Precommit: c.signed.Precommit,
+	}
+	if voteType == blockchain.VotePrevote{
+		state.Prevote = v
+	} else {
+		state.Precommit = v
+	}
+	if err := c.storage.SetState(state); err != nil{
+		log.Printf("Failed to store vote for height %d: %v", c.height, err)
+		return
+	}
+	c.signed = state
+
+	if err := c.addVote(v); err != nil{
+		log.Printf("Failed to record own vote: %v", err)
+		return
+	}
+	c.transport.Broadcast(&Message{Vote: v})
+}
+
+// once reports whether a one-shot rule has not fired yet in a round, and
+// marks it as fired
+func (c *Consensus) once(rule int, round uint32) bool{
+	key := trigger{rule, round}
+	if c.triggered[key]{
+		return false
+	}
+	c.triggered[key] = true
+	return true
+}
+
+// count returns the number of votes for hash, or for no block when hash is
+// empty
+func count(votes map[peer.ID]*Vote, hash []byte) int{
+	total := 0
+	for _, v := range votes{
+		if bytes.Equal(v.BlockHash, hash){
+			total++
+		}
+	}
+	return total
+}
+
+// senders returns the number of validators that sent a message for round
+func (c *Consensus) senders(round uint32) int{
+	seen := map[peer.ID]bool{}
+	for id := range c.prevotes[round]{
+		seen[id] = true
+	}
+	for id := range c.precommits[round]{
+		seen[id] = true
+	}
+	if _, ok := c.proposals[round]; ok{
+		seen[c.proposer(c.height, round)] = true
+	}
+	return len(seen)
+}
+
+func (c *Consensus) isValid(block *blockchain.Block) bool{
+	key := string(block.Hash)
+	if ok, seen := c.valid[key]; seen{
+		return ok
+	}
+
+	err := c.app.ValidateBlock(c.parent, block)
+	if err == nil && (block.Height != c.height || !bytes.Equal(block.PrevHash, c.parent.Hash)){
+		err = fmt.Errorf("block does not extend height %d", c.parent.Height)
+	}
+	if err != nil{
+		log.Printf("Invalid proposal %x: %v", block.Hash, err)
+	}
+	c.valid[key] = err == nil
+	return err == nil
+}
+
+func sameBlock(a *blockchain.Block, b *blockchain.Block) bool{
+	return a != nil && b != nil && bytes.Equal(a.Hash, b.Hash)
+}
+
+// checkRules applies the rules of the protocol until none fires
+func (c *Consensus) checkRules(){
+	for c.active && c.applyRule(){
+	}
+}
+
+// applyRule fires the first rule whose condition holds, and reports whether
+// one did. The rules follow the Tendermint consensus algorithm.
+func (c *Consensus) applyRule() bool{
+	// a quorum of precommits for a proposal of any round commits it
+	for round, p := range c.proposals{
+		if count(c.precommits[round], p.Block.Hash) >= c.quorum && c.isValid(p.Block) && c.once(ruleCommit, round){
+			c.commit(p)
+			return false
+		}
+	}
+
+	// f+1 validators are in a later round, so at least one correct one is
+	skip := len(c.config.Validators) - c.quorum + 1
+	var later uint32
+	for round := range c.prevotes{
+		if round > later && round > c.round && c.senders(round) >= skip{
+			later = round
+		}
+	}
+	for round := range c.precommits{
+		if round > later && round > c.round && c.senders(round) >= skip{
+			later = round
+		}
+	}
+	if later > c.round{
+		c.startRound(later)
+		return true
+	}
+
+	p := c.proposals[c.round]
+	quorum := c.quorum
+
+	if p != nil && c.step == StepPropose && p.POLRound == -1{
+		if c.isValid(p.Block) && (c.lockedRound == -1 || sameBlock(c.lockedBlock, p.Block)){
+			c.vote(blockchain.VotePrevote, p.Block.Hash)
+		} else {
+			c.vote(blockchain.VotePrevote, nil)
+		}
+		return true
+	}
+
+	if p != nil && c.step == StepPropose && p.POLRound >= 0 && count(c.prevotes[uint32(p.POLRound)], p.Block.Hash) >= quorum{
+		if c.isValid(p.Block) && (c.lockedRound <= p.POLRound || sameBlock(c.lockedBlock, p.Block)){
+			c.vote(blockchain.VotePrevote, p.Block.Hash)
+		} else {
+			c.vote(blockchain.VotePrevote, nil)
+		}
+		return true
+	}
+
+	if c.step == StepPrevote && len(c.prevotes[c.round]) >= quorum && c.once(rulePrevoteWait, c.round){
+		c.schedule(c.config.TimeoutPrevote, StepPrevote)
+		return true
+	}
+
+	if p != nil && c.step >= StepPrevote && count(c.prevotes[c.round], p.Block.Hash) >= quorum && c.isValid(p.Block) && c.once(rulePolka, c.round){
+		if c.step == StepPrevote{
+			c.lockedBlock = p.Block
+			c.lockedRound = int32(c.round)
+			c.vote(blockchain.VotePrecommit, p.Block.Hash)
+		}
+		c.validBlock = p.Block
+		c.validRound = int32(c.round)
+		return true
+	}
+
+	if c.step == StepPrevote && count(c.prevotes[c.round], nil) >= quorum{
+		c.vote(blockchain.VotePrecommit, nil)
+		return true
+	}
+
+	if len(c.precommits[c.round]) >= quorum && c.once(rulePrecommitWait, c.round){
+		c.schedule(c.config.TimeoutPrecommit, StepPrecommit)
+		return true
+	}
+	return false
+}
+
+// commit attaches the precommits to the block, hands it to the application
+// and moves to the next height
+func (c *Consensus) commit(p *Proposal){
+	block := *p.Block
+	block.Commit = []blockchain.CommitSig{}
+	for id, v := range c.precommits[p.Round]{
+		if bytes.Equal(v.BlockHash, p.Block.Hash){
+			block.Commit = append(block.Commit, blockchain.CommitSig{
+				Validator: []byte(id),
+				Round: p.Round,
+				Signature: v.Signature,
+			})
+		}
+	}
+
+	c.finalize(&block)
+}
+
+// finalize hands a block carrying its commit to the application and moves
+// to the next height
+func (c *Consensus) finalize(block *blockchain.Block){
+	if err := c.app.Commit(block); err != nil{
+		log.Printf("Failed to commit block %x at height %d: %v", block.Hash, block.Height, err)
+		return
+	}
+	log.Printf("Committed block %x at height %d", block.Hash, block.Height)
+
+	if err := c.newHeight(); err != nil{
+		log.Printf("Consensus cannot start height %d: %v", block.Height+1, err)
+	}
+}
+
+// verifyCommit checks that a block received with its commit extends our
+// chain and was precommitted by a quorum of validators
+func (c *Consensus) verifyCommit(block *blockchain.Block) error{
+	if !c.isValid(block){
+		return fmt.Errorf("invalid block %x", block.Hash)
+	}
+
+	signed := map[peer.ID]bool{}
+	for _, sig := range block.Commit{
+		validator, err := peer.IDFromBytes(sig.Validator)
+		if err != nil || !c.isValidator(validator) || signed[validator]{
+			continue
+		}
+		data := blockchain.VoteSignBytes(blockchain.VotePrecommit, block.Height, sig.Round, block.Hash)
+		if _, err := verifySignature(validator.String(), data, sig.Signature); err == nil{
+			signed[validator] = true
+		}
+	}
+	if len(signed) < c.quorum{
+		return fmt.Errorf("%d valid precommits, %d needed", len(signed), c.quorum)
+	}
+	return nil
+}
+
+// rebroadcast sends again the messages of this validator for the current
+// round, and the last commit when a validator is still deciding its height
+func (c *Consensus) rebroadcast(){
+	if c.behind && c.lastCommit != nil{
+		c.transport.Broadcast(&Message{Commit: c.lastCommit})
+		c.behind = false
+	}
+	if !c.active || !c.validator{
+		return
+	}
+
+	if p := c.proposals[c.round]; p != nil && p.Proposer == c.id.String(){
+		c.transport.Broadcast(&Message{Proposal: p})
+	}
+	if v := c.prevotes[c.round][c.id]; v != nil{
+		c.transport.Broadcast(&Message{Vote: v})
+	}
+	if v := c.precommits[c.round][c.id]; v != nil{
+		c.transport.Broadcast(&Message{Vote: v})
+	}
+}
@@ -0,0 +1,349 @@
+package bft
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// testApp keeps the committed blocks of a validator in memory and has
+// documents pending until target blocks are committed
+type testApp struct{
+	lock sync.Mutex
+	id peer.ID
+	target uint64
+	blocks []*blockchain.Block
+}
+
+func newTestApp(id peer.ID, target uint64) *testApp{
+	genesis := &blockchain.Block{Hash: []byte("genesis")}
+	return &testApp{id: id, target: target, blocks: []*blockchain.Block{genesis}}
+}
+
+func (a *testApp) LastBlock() (*blockchain.Block, error){
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.blocks[len(a.blocks)-1], nil
+}
+
+func (a *testApp) Pending() bool{
+	return a.height() < a.target
+}
+
+func (a *testApp) ProposeBlock(parent *blockchain.Block) (*blockchain.Block, error){
+	block := &blockchain.Block{
+		PrevHash: parent.Hash,
+		Height: parent.Height + 1,
+		Timestamp: time.Now().UnixNano(),
+		Signer: []byte(a.id),
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%x/%d/%s/%d", block.PrevHash, block.Height, a.id, block.Timestamp)))
+	block.Hash = hash[:]
+	return block, nil
+}
+
+func (a *testApp) ValidateBlock(parent *blockchain.Block, block *blockchain.Block) error{
+	if !bytes.Equal(block.PrevHash, parent.Hash){
+		return fmt.Errorf("block does not extend %x", parent.Hash)
+	}
+	return nil
+}
+
+func (a *testApp) Commit(block *blockchain.Block) error{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if last := a.blocks[len(a.blocks)-1]; block.Height != last.Height+1{
+		return fmt.Errorf("block at height %d on top of height %d", block.Height, last.Height)
+	}
+	a.blocks = append(a.blocks, block)
+	return nil
+}
+
+func (a *testApp) height() uint64{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return uint64(len(a.blocks) - 1)
+}
+
+func (a *testApp) block(height uint64) *blockchain.Block{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.blocks[height]
+}
+
+// testNetwork is a set of validators on a SimNetwork
+type testNetwork struct{
+	net *SimNetwork
+	validators []peer.ID
+	apps map[peer.ID]*testApp
+	nodes map[peer.ID]*Consensus
+}
+
+func testConfig(validators []peer.ID, key crypto.PrivKey) Config{
+	return Config{
+		Validators: validators,
+		Key: key,
+		TimeoutPropose: 300 * time.Millisecond,
+		TimeoutPrevote: 100 * time.Millisecond,
+		TimeoutPrecommit: 100 * time.Millisecond,
+		TimeoutDelta: 50 * time.Millisecond,
+		RebroadcastInterval: 200 * time.Millisecond,
+	}
+}
+
+func testStorage(t *testing.T) *Storage{
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ db.Close() })
+	return NewStorage(db)
+}
+
+func testKeys(t *testing.T, count int) ([]crypto.PrivKey, []peer.ID){
+	t.Helper()
+	keys := make([]crypto.PrivKey, count)
+	validators := make([]peer.ID, count)
+	for i := range keys{
+		key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil{
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil{
+			t.Fatal(err)
+		}
+		keys[i], validators[i] = key, id
+	}
+	return keys, validators
+}
+
+// newTestNetwork creates count validators that commit target blocks. The
+// caller starts them with start once the network faults are set.
+func newTestNetwork(t *testing.T, count int, target uint64) *testNetwork{
+	t.Helper()
+	keys, validators := testKeys(t, count)
+
+	tn := &testNetwork{
+		net: NewSimNetwork(),
+		validators: validators,
+		apps: map[peer.ID]*testApp{},
+		nodes: map[peer.ID]*Consensus{},
+	}
+	for i, id := range validators{
+		app := newTestApp(id, target)
+		c, err := New(testConfig(validators, keys[i]), app, tn.net.Transport(id), testStorage(t))
+		if err != nil{
+			t.Fatal(err)
+		}
+		tn.apps[id] = app
+		tn.nodes[id] = c
+	}
+	return tn
+}
+
+// start joins and runs the validators in ids until the test ends
+func (tn *testNetwork) start(t *testing.T, ids ...peer.ID){
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	t.Cleanup(func(){
+		cancel()
+		wg.Wait()
+	})
+	for _, id := range ids{
+		tn.net.Join(id, tn.nodes[id])
+	}
+	for _, id := range ids{
+		c := tn.nodes[id]
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			c.Run(ctx)
+		}()
+	}
+}
+
+// waitCommitted waits until every validator in ids committed height, then
+// checks that they all committed the same blocks
+func (tn *testNetwork) waitCommitted(t *testing.T, height uint64, ids ...peer.ID){
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for _, id := range ids{
+		for tn.apps[id].height() < height{
+			if time.Now().After(deadline){
+				t.Fatalf("validator %s committed %d blocks, want %d", id, tn.apps[id].height(), height)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for h := uint64(1); h <= height; h++{
+		first := tn.apps[ids[0]].block(h)
+		for _, id := range ids[1:]{
+			if block := tn.apps[id].block(h); !bytes.Equal(block.Hash, first.Hash){
+				t.Fatalf("validators committed %x and %x at height %d", first.Hash, block.Hash, h)
+			}
+		}
+	}
+}
+
+func TestCommitWithValidatorDown(t *testing.T){
+	tn := newTestNetwork(t, 4, 5)
+	// validators[0] proposes the first round of height 4
+	down := tn.validators[0]
+	up := tn.validators[1:]
+	tn.start(t, up...)
+	tn.waitCommitted(t, 5, up...)
+
+	if tn.apps[down].height() != 0{
+		t.Fatal("the stopped validator committed blocks")
+	}
+	for h := uint64(1); h <= 5; h++{
+		block := tn.apps[up[0]].block(h)
+		if bytes.Equal(block.Signer, []byte(down)){
+			t.Fatalf("block at height %d proposed by the stopped validator", h)
+		}
+		if len(block.Commit) < blockchain.Quorum(4){
+			t.Fatalf("block at height %d has %d precommits", h, len(block.Commit))
+		}
+	}
+}
+
+func TestRoundChangeWhenProposerSilenced(t *testing.T){
+	tn := newTestNetwork(t, 4, 2)
+	// validators[1] proposes round 0 of height 1; nothing it sends for that
+	// round reaches the others
+	silenced := tn.validators[1]
+	tn.net.Drop = func(from peer.ID, to peer.ID, msg *Message) bool{
+		if from != silenced{
+			return false
+		}
+		if msg.Proposal != nil{
+			return msg.Proposal.Height == 1 && msg.Proposal.Round == 0
+		}
+		return msg.Vote != nil && msg.Vote.Height == 1 && msg.Vote.Round == 0
+	}
+	tn.start(t, tn.validators...)
+	tn.waitCommitted(t, 2, tn.validators...)
+
+	block := tn.apps[tn.validators[0]].block(1)
+	if bytes.Equal(block.Signer, []byte(silenced)){
+		t.Fatal("block at height 1 proposed in the silenced round")
+	}
+	for _, sig := range block.Commit{
+		if sig.Round == 0{
+			t.Fatalf("block at height 1 committed in round 0 by %x", sig.Validator)
+		}
+	}
+}
+
+func TestSafetyUnderDelay(t *testing.T){
+	tn := newTestNetwork(t, 4, 6)
+	// delays up to about the propose timeout reorder the messages and make
+	// validators time out on proposals that are on their way
+	var lock sync.Mutex
+	random := mrand.New(mrand.NewSource(1))
+	tn.net.Delay = func(from peer.ID, to peer.ID, msg *Message) time.Duration{
+		lock.Lock()
+		defer lock.Unlock()
+		return time.Duration(random.Int63n(int64(400 * time.Millisecond)))
+	}
+	tn.start(t, tn.validators...)
+	tn.waitCommitted(t, 6, tn.validators...)
+
+	for h := uint64(1); h <= 6; h++{
+		block := tn.apps[tn.validators[0]].block(h)
+		if !bytes.Equal(block.PrevHash, tn.apps[tn.validators[0]].block(h-1).Hash){
+			t.Fatalf("block at height %d does not extend the block below it", h)
+		}
+	}
+}
+
+// recordTransport keeps the messages of a validator that is driven by the
+// test instead of Run
+type recordTransport struct{
+	sent []*Message
+}
+
+func (t *recordTransport) Broadcast(msg *Message){
+	t.sent = append(t.sent, msg)
+}
+
+func TestLockSurvivesRestart(t *testing.T){
+	keys, validators := testKeys(t, 4)
+	app := newTestApp(validators[0], 1)
+	storage := testStorage(t)
+	// validators[1] proposes round 0 of height 1 and validators[2] round 1
+	locked, err := newTestApp(validators[1], 1).ProposeBlock(app.block(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	other, err := newTestApp(validators[2], 1).ProposeBlock(app.block(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	start := func() (*Consensus, *recordTransport){
+		transport := &recordTransport{}
+		c, err := New(testConfig(validators, keys[0]), app, transport, storage)
+		if err != nil{
+			t.Fatal(err)
+		}
+		c.ctx = context.Background()
+		if err := c.newHeight(); err != nil{
+			t.Fatal(err)
+		}
+		return c, transport
+	}
+
+	// lock on the block of round 0 and precommit it, then restart
+	c, _ := start()
+	c.active = true
+	c.lockedBlock, c.lockedRound = locked, 0
+	c.vote(blockchain.VotePrecommit, locked.Hash)
+	precommit := c.precommits[0][c.id]
+
+	c, transport := start()
+	if c.round != 0 || c.lockedRound != 0 || !sameBlock(c.lockedBlock, locked){
+		t.Fatalf("restarted in round %d locked on round %d", c.round, c.lockedRound)
+	}
+	if v := c.precommits[0][c.id]; v == nil || !bytes.Equal(v.Signature, precommit.Signature){
+		t.Fatal("restarted without the precommit of round 0")
+	}
+
+	// a precommit for no block in the same round sends the stored one again,
+	// and the prevote of the round it left is not signed any more
+	c.active = true
+	c.vote(blockchain.VotePrecommit, nil)
+	c.vote(blockchain.VotePrevote, other.Hash)
+	if len(transport.sent) != 1 || !bytes.Equal(transport.sent[0].Vote.BlockHash, locked.Hash){
+		t.Fatalf("sent %d messages after the restart, want the stored precommit", len(transport.sent))
+	}
+
+	// the lock makes it prevote for no block on another proposal
+	proposal := &Proposal{Height: 1, Round: 1, POLRound: -1, Block: other, Proposer: validators[2].String()}
+	if err := signProposal(keys[2], proposal); err != nil{
+		t.Fatal(err)
+	}
+	c.startRound(1)
+	if err := c.addProposal(proposal); err != nil{
+		t.Fatal(err)
+	}
+	c.applyRule()
+	last := transport.sent[len(transport.sent)-1].Vote
+	if last == nil || last.Type != blockchain.VotePrevote || last.Round != 1 || len(last.BlockHash) != 0{
+		t.Fatalf("locked validator sent %+v on another proposal", last)
+	}
+}
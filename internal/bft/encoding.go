@@ -0,0 +1,153 @@
+package bft
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/codec"
+)
+
+// Field numbers of the messages in proto/p2p.proto
+const(
+	proposalHeight = iota + 1
+	proposalRound
+	proposalPOLRound
+	proposalBlock
+	proposalProposer
+	proposalSignature
+)
+
+const(
+	voteType = iota + 1
+	voteHeight
+	voteRound
+	voteBlockHash
+	voteValidator
+	voteSignature
+)
+
+const(
+	messageProposal = iota + 1
+	messageVote
+	messageCommit
+)
+
+// Serialize returns the canonical encoding of the message
+func (m *Message) Serialize() []byte{
+	var e codec.Encoder
+	if m.Proposal != nil{
+		e.Message(messageProposal, m.Proposal.serialize())
+	}
+	if m.Vote != nil{
+		e.Message(messageVote, m.Vote.serialize())
+	}
+	if m.Commit != nil{
+		block, _ := m.Commit.Serialize()
+		e.Message(messageCommit, block)
+	}
+	return e.Encoded()
+}
+
+// DeserializeMessage decodes a message from its canonical encoding
+func DeserializeMessage(data []byte) (*Message, error){
+	var m Message
+	d := codec.NewDecoder(data)
+	for d.More(){
+		var err error
+		switch d.Field(){
+		case messageProposal:
+			m.Proposal, err = deserializeProposal(d.Message())
+		case messageVote:
+			m.Vote, err = deserializeVote(d.Message())
+		case messageCommit:
+			m.Commit, err = blockchain.Deserialize(d.Message())
+		default:
+			d.Skip()
+		}
+		if err != nil{
+			return nil, err
+		}
+	}
+	if err := d.Err(); err != nil{
+		return nil, err
+	}
+	if err := codec.Canonical(data, m.Serialize()); err != nil{
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (p *Proposal) serialize() []byte{
+	var e codec.Encoder
+	e.Uint(proposalHeight, p.Height)
+	e.Uint(proposalRound, uint64(p.Round))
+	e.Int(proposalPOLRound, int64(p.POLRound))
+	if p.Block != nil{
+		block, _ := p.Block.Serialize()
+		e.Message(proposalBlock, block)
+	}
+	e.Text(proposalProposer, p.Proposer)
+	e.Bytes(proposalSignature, p.Signature)
+	return e.Encoded()
+}
+
+func deserializeProposal(data []byte) (*Proposal, error){
+	var p Proposal
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case proposalHeight:
+			p.Height = d.Uint()
+		case proposalRound:
+			p.Round = d.Uint32()
+		case proposalPOLRound:
+			p.POLRound = int32(d.Int())
+		case proposalBlock:
+			block, err := blockchain.Deserialize(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			p.Block = block
+		case proposalProposer:
+			p.Proposer = d.Text()
+		case proposalSignature:
+			p.Signature = d.Bytes()
+		default:
+			d.Skip()
+		}
+	}
+	return &p, d.Err()
+}
+
+func (v *Vote) serialize() []byte{
+	var e codec.Encoder
+	e.Uint(voteType, uint64(v.Type))
+	e.Uint(voteHeight, v.Height)
+	e.Uint(voteRound, uint64(v.Round))
+	e.Bytes(voteBlockHash, v.BlockHash)
+	e.Text(voteValidator, v.Validator)
+	e.Bytes(voteSignature, v.Signature)
+	return e.Encoded()
+}
+
+func deserializeVote(data []byte) (*Vote, error){
+	var v Vote
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case voteType:
+			v.Type = byte(d.Uint32())
+		case voteHeight:
+			v.Height = d.Uint()
+		case voteRound:
+			v.Round = d.Uint32()
+		case voteBlockHash:
+			v.BlockHash = d.Bytes()
+		case voteValidator:
+			v.Validator = d.Text()
+		case voteSignature:
+			v.Signature = d.Bytes()
+		default:
+			d.Skip()
+		}
+	}
+	return &v, d.Err()
+}
@@ -0,0 +1,119 @@
+// Package bft finalizes blocks among a fixed validator set with a
+// Tendermint-style protocol: in every round a proposer proposes a block, the
+// validators prevote and then precommit it, and the block is committed once
+// more than two thirds of them precommitted it in the same round.
+package bft
+
+import (
+	"bytes"
+	"fmt"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// proposalDomain separates proposal signatures from any other use of the keys
+var proposalDomain = []byte("bc/bft/proposal")
+
+// Proposal is a block proposed for a height and round by the proposer of the
+// round. POLRound is the round in which the block got a quorum of prevotes
+// when it is proposed again, or -1.
+type Proposal struct{
+	Height uint64 `json:"height"`
+	Round uint32 `json:"round"`
+	POLRound int32 `json:"polRound"`
+	Block *blockchain.Block `json:"block"`
+	Proposer string `json:"proposer"`
+	Signature []byte `json:"signature"`
+}
+
+// Vote is a prevote or precommit of a validator. An empty BlockHash votes
+// for no block.
+type Vote struct{
+	Type byte `json:"type"`
+	Height uint64 `json:"height"`
+	Round uint32 `json:"round"`
+	BlockHash []byte `json:"blockHash,omitempty"`
+	Validator string `json:"validator"`
+	Signature []byte `json:"signature"`
+}
+
+// Message is a consensus message on the wire, holding either a proposal, a
+// vote, or a committed block with its commit for validators that fell behind
+type Message struct{
+	Proposal *Proposal `json:"proposal,omitempty"`
+	Vote *Vote `json:"vote,omitempty"`
+	Commit *blockchain.Block `json:"commit,omitempty"`
+}
+
+// Height returns the height the message is about
+func (m *Message) Height() uint64{
+	if m.Proposal != nil{
+		return m.Proposal.Height
+	}
+	if m.Vote != nil{
+		return m.Vote.Height
+	}
+	if m.Commit != nil{
+		return m.Commit.Height
+	}
+	return 0
+}
+
+func proposalSignBytes(p *Proposal) []byte{
+	return bytes.Join(
+		[][]byte{
+			proposalDomain,
+			blockchain.ToHex(int64(p.Height)),
+			blockchain.ToHex(int64(p.Round)),
+			blockchain.ToHex(int64(p.POLRound)),
+			p.Block.Hash,
+		},
+		[]byte{},
+	)
+}
+
+func voteSignBytes(v *Vote) []byte{
+	return blockchain.VoteSignBytes(v.Type, v.Height, v.Round, v.BlockHash)
+}
+
+func signProposal(key crypto.PrivKey, p *Proposal) error{
+	signature, err := key.Sign(proposalSignBytes(p))
+	if err != nil{
+		return err
+	}
+	p.Signature = signature
+	return nil
+}
+
+func signVote(key crypto.PrivKey, v *Vote) error{
+	signature, err := key.Sign(voteSignBytes(v))
+	if err != nil{
+		return err
+	}
+	v.Signature = signature
+	return nil
+}
+
+// verifySignature checks that signer, a peer ID embedding its public key,
+// signed data
+func verifySignature(signer string, data []byte, signature []byte) (peer.ID, error){
+	id, err := peer.Decode(signer)
+	if err != nil{
+		return "", err
+	}
+	pubKey, err := id.ExtractPublicKey()
+	if err != nil{
+		return "", err
+	}
+	ok, err := pubKey.Verify(data, signature)
+	if err != nil{
+		return "", err
+	}
+	if !ok{
+		return "", fmt.Errorf("bad signature from %s", id)
+	}
+	return id, nil
+}
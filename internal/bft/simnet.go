@@ -0,0 +1,76 @@
+package bft
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SimNetwork connects Consensus instances in the same process, to simulate a
+// network of validators. Drop and Delay, when set, are asked about every
+// delivery so that lost, late and reordered messages can be reproduced.
+type SimNetwork struct{
+	lock sync.Mutex
+	nodes map[peer.ID]*Consensus
+
+	Drop func(from peer.ID, to peer.ID, msg *Message) bool
+	Delay func(from peer.ID, to peer.ID, msg *Message) time.Duration
+}
+
+func NewSimNetwork() *SimNetwork{
+	return &SimNetwork{
+		nodes: make(map[peer.ID]*Consensus),
+	}
+}
+
+// Join registers the consensus instance receiving the messages sent to id
+func (n *SimNetwork) Join(id peer.ID, c *Consensus){
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.nodes[id] = c
+}
+
+// Leave disconnects id, as if the node had stopped
+func (n *SimNetwork) Leave(id peer.ID){
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	delete(n.nodes, id)
+}
+
+// Transport returns the transport id broadcasts through
+func (n *SimNetwork) Transport(id peer.ID) Transport{
+	return &simTransport{network: n, id: id}
+}
+
+type simTransport struct{
+	network *SimNetwork
+	id peer.ID
+}
+
+func (t *simTransport) Broadcast(msg *Message){
+	n := t.network
+	n.lock.Lock()
+	nodes := make(map[peer.ID]*Consensus, len(n.nodes))
+	for id, c := range n.nodes{
+		nodes[id] = c
+	}
+	drop, delay := n.Drop, n.Delay
+	n.lock.Unlock()
+
+	for to, c := range nodes{
+		if to == t.id{
+			continue
+		}
+		if drop != nil && drop(t.id, to, msg){
+			continue
+		}
+		if delay != nil{
+			if d := delay(t.id, to, msg); d > 0{
+				time.AfterFunc(d, func(){ c.Receive(msg) })
+				continue
+			}
+		}
+		c.Receive(msg)
+	}
+}
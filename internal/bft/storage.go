@@ -0,0 +1,75 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const stateKey = "bft:state"
+
+// State is what a validator must remember across a restart not to sign a
+// vote conflicting with one it already sent: its lock and its last votes.
+// Height, Round and Step are those of the last vote it signed.
+type State struct{
+	Height uint64 `json:"height"`
+	Round uint32 `json:"round"`
+	Step Step `json:"step"`
+	LockedRound int32 `json:"lockedRound"`
+	LockedBlock *blockchain.Block `json:"lockedBlock,omitempty"`
+	Prevote *Vote `json:"prevote,omitempty"`
+	Precommit *Vote `json:"precommit,omitempty"`
+}
+
+// signedSince reports whether the last signed vote is at or after step of
+// round at height
+func (s *State) signedSince(height uint64, round uint32, step Step) bool{
+	if s.Height != height{
+		return s.Height > height
+	}
+	if s.Round != round{
+		return s.Round > round
+	}
+	return s.Step >= step
+}
+
+// Storage keeps the state of a validator in the chain database
+type Storage struct{
+	db *badger.DB
+}
+
+func NewStorage(db *badger.DB) *Storage{
+	return &Storage{db: db}
+}
+
+// State returns the stored state, or the zero state of a validator that
+// never voted
+func (s *Storage) State() (State, error){
+	state := State{LockedRound: -1}
+	err := s.db.View(func(txn *badger.Txn) error{
+		item, err := txn.Get([]byte(stateKey))
+		if errors.Is(err, badger.ErrKeyNotFound){
+			return nil
+		}
+		if err != nil{
+			return err
+		}
+		return item.Value(func(val []byte) error{
+			return json.Unmarshal(val, &state)
+		})
+	})
+	return state, err
+}
+
+func (s *Storage) SetState(state State) error{
+	encoded, err := json.Marshal(state)
+	if err != nil{
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error{
+		return txn.Set([]byte(stateKey), encoded)
+	})
+}
@@ -0,0 +1,263 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Difficulties of proof-of-authority blocks. The authority whose turn it is
+// seals with inTurnDifficulty, any other one with outOfTurnDifficulty, and
+// the difficulty is the work of the block, so the in-turn branch wins forks.
+const(
+	inTurnDifficulty = 2
+	outOfTurnDifficulty = 1
+)
+
+// ErrNotAuthorized is returned when sealing on a node whose key is not in the
+// authority set
+var ErrNotAuthorized = errors.New("node is not an authority")
+
+// ErrSignedRecently is returned for a block sealed by an authority that
+// sealed one of the blocks just before it
+var ErrSignedRecently = errors.New("authority signed recently")
+
+// AuthorityEngine seals blocks by signing them with the key of one of a fixed
+// set of authorities, identified by their libp2p peer IDs. The authority at
+// index height % len(authorities) is in turn for a height. The others only
+// seal when it is late: the n-th authority after it waits n times the
+// network's TargetInterval, so that a block from an authority ahead of it
+// aborts the wait, and its block is timestamped at least that long after the
+// parent. As in Clique, an authority that sealed one of the last
+// len(authorities)/2 blocks may not seal the next one, so a single authority
+// cannot build a chain on its own.
+type AuthorityEngine struct{
+	authorities []peer.ID
+	key crypto.PrivKey
+	id peer.ID
+	delay time.Duration
+}
+
+// NewAuthorityEngine returns the proof-of-authority engine for the authority
+// set of params, sealing with key when it belongs to one of them
+func NewAuthorityEngine(params Params, key crypto.PrivKey) (*AuthorityEngine, error){
+	authorities, err := parseAuthorities(params)
+	if err != nil{
+		return nil, err
+	}
+
+	engine := &AuthorityEngine{authorities: authorities, delay: params.TargetInterval}
+
+	if key != nil{
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil{
+			return nil, err
+		}
+		if engine.rank(id) >= 0{
+			engine.key = key
+			engine.id = id
+		}
+	}
+	return engine, nil
+}
+
+// parseAuthorities decodes the authority set of params. Authorities must
+// have peer IDs that embed their public key, as Ed25519 ones do.
+func parseAuthorities(params Params) ([]peer.ID, error){
+	if len(params.Authorities) == 0{
+		return nil, fmt.Errorf("network %s has no authorities", params.Name)
+	}
+
+	authorities := []peer.ID{}
+	for _, encoded := range params.Authorities{
+		id, err := peer.Decode(encoded)
+		if err != nil{
+			return nil, fmt.Errorf("authority %q: %w", encoded, err)
+		}
+		if _, err := id.ExtractPublicKey(); err != nil{
+			return nil, fmt.Errorf("authority %s does not embed its public key: %w", id, err)
+		}
+		authorities = append(authorities, id)
+	}
+	return authorities, nil
+}
+
+// rank returns the position of an authority in the authority set, or -1
+func (e *AuthorityEngine) rank(id peer.ID) int{
+	for i, authority := range e.authorities{
+		if authority == id{
+			return i
+		}
+	}
+	return -1
+}
+
+// turnDistance returns how many authorities come before id for a height,
+// starting with the one in turn
+func (e *AuthorityEngine) turnDistance(height uint64, id peer.ID) int{
+	count := len(e.authorities)
+	inTurn := int(height % uint64(count))
+	return (e.rank(id) - inTurn + count) % count
+}
+
+func (e *AuthorityEngine) CanSeal() bool{
+	return e.key != nil
+}
+
+func (e *AuthorityEngine) Prepare(reader HeaderReader, parent *Block, block *Block) error{
+	if e.key == nil{
+		return ErrNotAuthorized
+	}
+	if err := e.checkRecent(reader, parent, e.id); err != nil{
+		return err
+	}
+	block.Signer = []byte(e.id)
+	block.Difficulty = outOfTurnDifficulty
+	distance := e.turnDistance(block.Height, e.id)
+	if distance == 0{
+		block.Difficulty = inTurnDifficulty
+	}
+	block.Timestamp = max(block.Timestamp, parent.Timestamp+e.turnDelay(distance).Milliseconds())
+	return nil
+}
+
+// turnDelay is how long after its parent an authority distance places after
+// the one in turn may timestamp a block
+func (e *AuthorityEngine) turnDelay(distance int) time.Duration{
+	return time.Duration(distance) * e.delay
+}
+
+// checkRecent refuses signer when it sealed parent or one of the ancestors
+// before it, up to len(authorities)/2 blocks
+func (e *AuthorityEngine) checkRecent(reader HeaderReader, parent *Block, signer peer.ID) error{
+	limit := len(e.authorities) / 2
+	block := parent
+	for i := 0; i < limit && block.Height > 0; i++{
+		if bytes.Equal(block.Signer, []byte(signer)){
+			return fmt.Errorf("%w: %s sealed block %d, one of the last %d", ErrSignedRecently, signer, block.Height, limit)
+		}
+		if i+1 < limit{
+			var err error
+			if block, err = reader.GetBlock(block.PrevHash); err != nil{
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Seal signs the block hash. The genesis block is left unsigned.
+func (e *AuthorityEngine) Seal(ctx context.Context, block *Block) error{
+	if block.Height == 0{
+		block.Hash = e.Hash(block)
+		return nil
+	}
+	if e.key == nil{
+		return ErrNotAuthorized
+	}
+
+	if wait := e.turnDistance(block.Height, e.id); wait > 0{
+		timer := time.NewTimer(time.Duration(wait) * e.delay)
+		defer timer.Stop()
+		select{
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	hash := e.Hash(block)
+	signature, err := e.key.Sign(hash)
+	if err != nil{
+		return err
+	}
+	block.Hash = hash
+	block.Signature = signature
+	return nil
+}
+
+func (e *AuthorityEngine) Hash(block *Block) []byte{
+	return headerHash(block)
+}
+
+// headerHash is the block hash of the signature based engines, the hash of
+// the header bytes. These engines leave the nonce at zero.
+func headerHash(block *Block) []byte{
+	if block.Version == 0{
+		return legacyHeaderHash(block)
+	}
+	hash := sha256.Sum256(block.HeaderBytes())
+	return hash[:]
+}
+
+func (e *AuthorityEngine) VerifySeal(block *Block) error{
+	return verifySigned(block, e.authorities)
+}
+
+// verifySigned checks the hash of a block and its signature by one of
+// authorities. The genesis block must be unsigned.
+func verifySigned(block *Block, authorities []peer.ID) error{
+	if !bytes.Equal(headerHash(block), block.Hash){
+		return fmt.Errorf("%w: hash does not match the block contents", ErrInvalidSeal)
+	}
+	if block.Height == 0 && len(block.PrevHash) == 0{
+		if len(block.Signer) != 0 || len(block.Signature) != 0{
+			return fmt.Errorf("%w: genesis block is signed", ErrInvalidSeal)
+		}
+		return nil
+	}
+
+	signer, err := peer.IDFromBytes(block.Signer)
+	if err != nil{
+		return fmt.Errorf("%w: invalid signer: %v", ErrInvalidSeal, err)
+	}
+	known := false
+	for _, authority := range authorities{
+		known = known || authority == signer
+	}
+	if !known{
+		return fmt.Errorf("%w: signer %s is not an authority", ErrInvalidSeal, signer)
+	}
+	pubKey, err := signer.ExtractPublicKey()
+	if err != nil{
+		return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	ok, err := pubKey.Verify(block.Hash, block.Signature)
+	if err != nil || !ok{
+		return fmt.Errorf("%w: bad signature from %s", ErrInvalidSeal, signer)
+	}
+	return nil
+}
+
+func (e *AuthorityEngine) VerifyHeader(reader HeaderReader, parent *Block, block *Block) error{
+	signer, err := peer.IDFromBytes(block.Signer)
+	if err != nil{
+		return fmt.Errorf("%w: invalid signer: %v", ErrInvalidSeal, err)
+	}
+	difficulty := uint32(outOfTurnDifficulty)
+	if e.turnDistance(block.Height, signer) == 0{
+		difficulty = inTurnDifficulty
+	}
+	if block.Difficulty != difficulty{
+		return fmt.Errorf("%w: difficulty %d, expected %d for signer %s", ErrInvalidDifficulty, block.Difficulty, difficulty, signer)
+	}
+	if err := checkTimestamp(parent, block); err != nil{
+		return err
+	}
+	distance := e.turnDistance(block.Height, signer)
+	if delay := e.turnDelay(distance); block.Timestamp < parent.Timestamp+delay.Milliseconds(){
+		return fmt.Errorf("%w: signer %s is %d turns late and must seal %v after the parent, not %dms", ErrInvalidSeal, signer, distance, delay, block.Timestamp-parent.Timestamp)
+	}
+	return e.checkRecent(reader, parent, signer)
+}
+
+func (e *AuthorityEngine) Work(block *Block) *big.Int{
+	return big.NewInt(int64(block.Difficulty))
+}
@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// authorityChain opens a proof-of-authority chain of three authorities and
+// returns it with an engine sealing for each of them, in turn order
+func authorityChain(t *testing.T) (*BlockChain, []*AuthorityEngine){
+	t.Helper()
+	keys := []crypto.PrivKey{}
+	params := Params{Name: "poa-test", Consensus: ConsensusPoA, TargetInterval: 20 * time.Millisecond}
+	for i := 0; i < 3; i++{
+		key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil{
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil{
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		params.Authorities = append(params.Authorities, id.String())
+	}
+
+	engines := []*AuthorityEngine{}
+	for _, key := range keys{
+		engine, err := NewAuthorityEngine(params, key)
+		if err != nil{
+			t.Fatal(err)
+		}
+		engines = append(engines, engine)
+	}
+	chain, err := openBlockChain(t.TempDir(), params, engines[0])
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ chain.Database.Close() })
+	return chain, engines
+}
+
+// sealAuthority seals a child of the chain tip by engine, timestamped delay
+// after the tip
+func sealAuthority(t *testing.T, chain *BlockChain, engine *AuthorityEngine, delay time.Duration) *Block{
+	t.Helper()
+	lastHash, height := chain.Tip()
+	parent, err := chain.GetBlockByHash(lastHash)
+	if err != nil{
+		t.Fatal(err)
+	}
+	block := NewBlock(nil, nil, nil, lastHash, height+1, parent.Timestamp+delay.Milliseconds())
+	block.Signer = []byte(engine.id)
+	block.Difficulty = outOfTurnDifficulty
+	if engine.turnDistance(block.Height, engine.id) == 0{
+		block.Difficulty = inTurnDifficulty
+	}
+	if err := engine.Seal(context.Background(), block); err != nil{
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestAuthoritySealsConsecutiveBlocks(t *testing.T){
+	chain, engines := authorityChain(t)
+	// authority 1 is in turn at height 1, authority 2 at height 2
+	if err := chain.InsertBlock(sealAuthority(t, chain, engines[1], 0)); err != nil{
+		t.Fatal(err)
+	}
+
+	again := sealAuthority(t, chain, engines[1], time.Second)
+	if err := chain.InsertBlock(again); !errors.Is(err, ErrSignedRecently){
+		t.Fatalf("second block in a row by the same authority: %v", err)
+	}
+	if _, err := chain.CreateBlock(context.Background(), nil, nil, nil); err != nil{
+		t.Fatal(err)
+	}
+	chain.engine = engines[1]
+	if _, err := chain.CreateBlock(context.Background(), nil, nil, nil); !errors.Is(err, ErrSignedRecently){
+		t.Fatalf("prepared a second block in a row: %v", err)
+	}
+
+	early := sealAuthority(t, chain, engines[0], engines[0].delay-time.Millisecond)
+	if err := chain.InsertBlock(early); !errors.Is(err, ErrInvalidSeal){
+		t.Fatalf("out of turn block sealed before its turn delay: %v", err)
+	}
+	if err := chain.InsertBlock(sealAuthority(t, chain, engines[0], engines[0].delay)); err != nil{
+		t.Fatalf("out of turn block sealed after its turn delay: %v", err)
+	}
+}
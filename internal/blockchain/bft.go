@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Vote types signed by BFT validators
+const(
+	VotePrevote byte = 1
+	VotePrecommit byte = 2
+)
+
+// voteDomain separates vote signatures from any other use of the keys
+var voteDomain = []byte("bc/bft/vote")
+
+// CommitSig is the precommit signature of a validator for a block
+type CommitSig struct{
+	Validator []byte `json:"validator"`
+	Round uint32 `json:"round"`
+	Signature []byte `json:"signature"`
+}
+
+// VoteSignBytes returns the bytes a validator signs to vote for a block hash
+// at a height and round. An empty hash is a vote for no block.
+func VoteSignBytes(voteType byte, height uint64, round uint32, hash []byte) []byte{
+	return bytes.Join(
+		[][]byte{
+			voteDomain,
+			{voteType},
+			ToHex(int64(height)),
+			ToHex(int64(round)),
+			hash,
+		},
+		[]byte{},
+	)
+}
+
+// Quorum returns the number of validators out of n needed to commit, more
+// than two thirds of them. With n = 3f+1 validators that is 2f+1.
+func Quorum(n int) int{
+	return 2*n/3 + 1
+}
+
+// BFTEngine checks blocks finalized by the validators in params.Authorities.
+// Blocks are not sealed alone: the proposer sets itself as Signer, and the
+// block is final once Commit holds precommits from a quorum of validators,
+// which the bft package collects. Every block has difficulty and work 1, as
+// finalized blocks never compete.
+type BFTEngine struct{
+	validators []peer.ID
+	key crypto.PrivKey
+	id peer.ID
+}
+
+func NewBFTEngine(params Params, key crypto.PrivKey) (*BFTEngine, error){
+	validators, err := parseAuthorities(params)
+	if err != nil{
+		return nil, err
+	}
+
+	engine := &BFTEngine{validators: validators}
+	if key != nil{
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil{
+			return nil, err
+		}
+		engine.key = key
+		engine.id = id
+	}
+	return engine, nil
+}
+
+// Validators returns the validator set in order
+func (e *BFTEngine) Validators() []peer.ID{
+	return append([]peer.ID{}, e.validators...)
+}
+
+func (e *BFTEngine) isValidator(id peer.ID) bool{
+	for _, validator := range e.validators{
+		if validator == id{
+			return true
+		}
+	}
+	return false
+}
+
+// CanSeal is false: blocks are produced by the bft package, not mined
+func (e *BFTEngine) CanSeal() bool{
+	return false
+}
+
+func (e *BFTEngine) Prepare(reader HeaderReader, parent *Block, block *Block) error{
+	if e.key == nil || !e.isValidator(e.id){
+		return ErrNotAuthorized
+	}
+	block.Signer = []byte(e.id)
+	block.Difficulty = 1
+	return nil
+}
+
+// Seal only sets the hash; the block becomes valid once its commit is set
+func (e *BFTEngine) Seal(ctx context.Context, block *Block) error{
+	block.Hash = e.Hash(block)
+	return nil
+}
+
+func (e *BFTEngine) Hash(block *Block) []byte{
+	return headerHash(block)
+}
+
+// VerifySeal checks that a quorum of distinct validators precommitted the
+// block. The genesis block has no commit.
+func (e *BFTEngine) VerifySeal(block *Block) error{
+	if !bytes.Equal(e.Hash(block), block.Hash){
+		return fmt.Errorf("%w: hash does not match the block contents", ErrInvalidSeal)
+	}
+	if block.Height == 0 && len(block.PrevHash) == 0{
+		if len(block.Signer) != 0 || len(block.Commit) != 0{
+			return fmt.Errorf("%w: genesis block is signed", ErrInvalidSeal)
+		}
+		return nil
+	}
+
+	proposer, err := peer.IDFromBytes(block.Signer)
+	if err != nil || !e.isValidator(proposer){
+		return fmt.Errorf("%w: proposer is not a validator", ErrInvalidSeal)
+	}
+
+	signed := map[peer.ID]bool{}
+	for _, sig := range block.Commit{
+		validator, err := peer.IDFromBytes(sig.Validator)
+		if err != nil || !e.isValidator(validator) || signed[validator]{
+			continue
+		}
+		pubKey, err := validator.ExtractPublicKey()
+		if err != nil{
+			continue
+		}
+		ok, err := pubKey.Verify(VoteSignBytes(VotePrecommit, block.Height, sig.Round, block.Hash), sig.Signature)
+		if err == nil && ok{
+			signed[validator] = true
+		}
+	}
+	if quorum := Quorum(len(e.validators)); len(signed) < quorum{
+		return fmt.Errorf("%w: %d valid precommits, %d needed", ErrInvalidSeal, len(signed), quorum)
+	}
+	return nil
+}
+
+func (e *BFTEngine) VerifyHeader(reader HeaderReader, parent *Block, block *Block) error{
+	if block.Difficulty != 1{
+		return fmt.Errorf("%w: difficulty %d, expected 1", ErrInvalidDifficulty, block.Difficulty)
+	}
+	return nil
+}
+
+func (e *BFTEngine) Work(block *Block) *big.Int{
+	return big.NewInt(int64(block.Difficulty))
+}
@@ -2,17 +2,27 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
-	"log"
-	"time"
+	"context"
 )
 
 type Block struct{
+	// Version is the schema version of the block encoding, see SchemaVersion
+	Version uint32 `json:"version"`
 	Hash []byte  `json:"hash"`
 	PrevHash []byte `json:"prev_hash"`
 	Nonce int `json:"nonce"`
+	Difficulty uint32 `json:"difficulty"`
+	Height uint64 `json:"height"`
 	Timestamp int64 `json:"timestamp"` 
-	Data BlockData `json:"data"`
+	MerkleRoot []byte `json:"merkle_root"`
+	Signer []byte `json:"signer,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+	Commit []CommitSig `json:"commit,omitempty"`
+	Data []BlockData `json:"data"`
+	// Notaries are the notary registry transactions of the block
+	Notaries []NotaryTx `json:"notaries,omitempty"`
+	// Statuses revoke or supersede documents anchored earlier
+	Statuses []StatusTx `json:"statuses,omitempty"`
 }
 
 type BlockData struct{
@@ -21,69 +31,89 @@ type BlockData struct{
 	NotaryID string `json:"notaryId"`
 	UserID string	`json:"userId"`
 	CNPJ string `json:"cnpj"`
+	// PublicKey is the DER encoded public key of the notary, and Signature
+	// its signature of SigningBytes
+	PublicKey []byte `json:"publicKey,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
 }
 
-func (bd *BlockData) Serialize() []byte{
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
+// genesisTimestamp is the fixed timestamp of the genesis block, so that
+// every node of a network derives the same genesis block
+const genesisTimestamp = 0
 
-	err := encoder.Encode(bd)
-	Handle(err)
-	return res.Bytes()
+// NewBlock returns an unsealed block of the current schema version for the
+// data entries, registry transactions and status transactions. The consensus
+// engine fills in the remaining fields when sealing it.
+func NewBlock(data []BlockData, notaries []NotaryTx, statuses []StatusTx, PrevHash []byte, height uint64, timestamp int64) *Block{
+	return newBlock(SchemaVersion, data, notaries, statuses, PrevHash, height, timestamp)
 }
 
-func CreateBlock(data *BlockData, PrevHash []byte) *Block{
-	block := &Block{
+func newBlock(version uint32, data []BlockData, notaries []NotaryTx, statuses []StatusTx, PrevHash []byte, height uint64, timestamp int64) *Block{
+	return &Block{
+		version,
 		[]byte{}, 
 		PrevHash, 
 		0,
-		time.Now().UnixMilli(),
-		*data, 
+		0,
+		height,
+		timestamp,
+		MerkleRoot(version, data, notaries, statuses),
+		nil,
+		nil,
+		nil,
+		data, 
+		notaries,
+		statuses,
 	}
-	
-	pow := NewProof(block)
-	nonce, hash := pow.Run()
-
-	block.Hash = hash 
-	block.Nonce = nonce
-
-	return block
 }
 
-func Genesis() *Block{
+// Genesis returns the genesis block of a network. It keeps schema version 0
+// so that the networks created before the canonical encoding keep their
+// genesis block, and with it their identity.
+func Genesis(params Params, engine Engine) (*Block, error){
 	blockData := BlockData{
 		[]byte{},
 		"Genesis",
 		"Genesis",
 		"Genesis",
 		"Genesis",
+		nil,
+		nil,
 	}
-	return CreateBlock(&blockData, []byte{})
+	block := newBlock(0, []BlockData{blockData}, nil, nil, []byte{}, 0, genesisTimestamp)
+	block.Difficulty = params.InitialDifficulty
+	if err := engine.Seal(context.Background(), block); err != nil{
+		return nil, err
+	}
+	return block, nil
 }
 
-func (b *Block) Serialize() []byte{
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
-
-	err := encoder.Encode(b)
-	Handle(err)
-
-	return res.Bytes()
+// FindData returns the index of the entry anchoring the document with the
+// given hash, or -1 if the block does not contain it
+func (b *Block) FindData(fileHash []byte) int{
+	for i := range b.Data{
+		if bytes.Equal(b.Data[i].Hash, fileHash){
+			return i
+		}
+	}
+	return -1
 }
 
-func Deserialize(data []byte) *Block{
-	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-
-	err := decoder.Decode(&block)
-	Handle(err)
-
-	return &block
+// IsFinal reports whether the block carries a BFT commit. Blocks are only
+// stored once their commit is checked, so a stored block with a commit can
+// never be reverted.
+func (b *Block) IsFinal() bool{
+	return len(b.Commit) > 0
 }
 
-
-func Handle(err error){
-	if err != nil{
-		log.Panic(err)
+// HasValidMerkleRoot reports whether MerkleRoot commits to the block data,
+// registry transactions and status transactions.
+// The proof-of-work only covers the root, so blocks from peers must pass
+// this check too. Blocks of the first release have no root, their
+// proof-of-work covers their entry.
+func (b *Block) HasValidMerkleRoot() bool{
+	if b.isFirstRelease(){
+		return true
 	}
+	return bytes.Equal(MerkleRoot(b.Version, b.Data, b.Notaries, b.Statuses), b.MerkleRoot)
 }
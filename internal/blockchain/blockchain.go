@@ -2,9 +2,13 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/hex"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -15,186 +19,262 @@ const(
 
 type BlockChain struct{
 	LastHash []byte
-	height uint64 
+	height uint64
 	Database *badger.DB
+	mu sync.RWMutex
+	params Params
+	engine Engine
+	// admins are the DER encoded keys allowed to sign registry transactions
+	admins [][]byte
 }
 
 
-func (chain *BlockChain) CreateInsertBlock(data *BlockData) *Block{
-	var lastHash []byte
-	
-	err := chain.Database.View(func(txn *badger.Txn) error{
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
+// CreateInsertBlock mines a block for the data entries, registry transactions
+// and status transactions on top of the current tip and inserts it. If another block took the tip while mining, the new
+// block ends up on a side branch; callers can check ContainsFileHash to find
+// out. Mining stops with ctx.Err() when ctx is done.
+func (chain *BlockChain) CreateInsertBlock(ctx context.Context, data []BlockData, notaries []NotaryTx, statuses []StatusTx) (*Block, error){
+	block, err := chain.CreateBlock(ctx, data, notaries, statuses)
+	if err != nil{
+		return nil, err
+	}
+	if err := chain.InsertBlock(block); err != nil{
+		return nil, err
+	}
+	return block, nil
+}
 
-		err = item.Value(func(val []byte) error{
-			lastHash = val 
+// CreateBlock prepares and seals a block for the data entries, registry
+// transactions and status transactions on top of the current tip without
+// inserting it
+func (chain *BlockChain) CreateBlock(ctx context.Context, data []BlockData, notaries []NotaryTx, statuses []StatusTx) (*Block, error){
+	lastHash, height := chain.Tip()
+
+	block := NewBlock(data, notaries, statuses, lastHash, height+1, time.Now().UnixMilli())
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		parent, err := getBlock(txn, lastHash)
+		if err != nil{
 			return err
-		})
-		return err
+		}
+		return chain.engine.Prepare(txnReader{txn}, parent, block)
 	})
-	Handle(err)
+	if err != nil{
+		return nil, err
+	}
+	if err := chain.engine.Seal(ctx, block); err != nil{
+		return nil, err
+	}
+	return block, nil
+}
 
-	block := CreateBlock(data, lastHash)
-	chain.InsertBlock(block)
-	return block
+func (chain *BlockChain) InsertBlock(block *Block) error{
+	_, err := chain.AcceptBlock(block)
+	return err
 }
 
-func (chain *BlockChain) InsertBlock(block *Block) {
-	err := chain.Database.Update(func(txn *badger.Txn) error{
-		err := txn.Set([]byte(block.Hash), block.Serialize())
-		Handle(err)
-		err = txn.Set([]byte("lh"), block.Hash)
-		Handle(err)
+// Tip returns the hash and height of the last main chain block
+func (chain *BlockChain) Tip() ([]byte, uint64){
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	return chain.LastHash, chain.height
+}
 
-		chain.LastHash = block.Hash
-		return err 
-	})
-	Handle(err)
-	chain.height += 1
+// Params returns the consensus parameters the chain was opened with
+func (chain *BlockChain) Params() Params{
+	return chain.params
+}
+
+// Engine returns the consensus engine of the chain
+func (chain *BlockChain) Engine() Engine{
+	return chain.engine
 }
 
 func (chain *BlockChain) Height() uint64{
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
 	return chain.height
 }
 
-func (chain *BlockChain) ContainsBlock(hash  []byte) bool{
-	var block *Block
-	iter := chain.Iterator()
-
-	for{
-		block = iter.Next()
-
-		if bytes.Equal(block.Hash, hash){
-			return true
-		}
-		if len(block.PrevHash) == 0{
-			break
-		}
+// ContainsBlock reports whether a block is stored, on the main chain or on a
+// side branch
+func (chain *BlockChain) ContainsBlock(hash  []byte) (bool, error){
+	_, err := chain.GetBlockByHash(hash)
+	if errors.Is(err, ErrBlockNotFound){
+		return false, nil
 	}
-	return false
+	return err == nil, err
 }
 
-func (chain *BlockChain) GetBlockByHash(hash []byte) *Block{
-	var block *Block 
-	iter := chain.Iterator()
-
-	for{
-		block = iter.Next()
-
-		if bytes.Equal(block.Hash, hash){
-			return block
-		}
+func (chain *BlockChain) GetBlockByHash(hash []byte) (*Block, error){
+	var block *Block
 
-		if len(block.Hash) == 0{
-			break
-		}
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		var err error
+		block, err = getBlock(txn, hash)
+		return err
+	})
+	if err != nil{
+		return nil, err
 	}
-	return nil
+
+	return block, nil
 }
 
-func (chain *BlockChain) ListBlocks() []*Block{
+func (chain *BlockChain) ListBlocks() ([]*Block, error){
 	blocks := []*Block{}
-	var block *Block 
 
 	iter := chain.Iterator()
-	counter := 1
 	for{
-		block = iter.Next()
+		block, err := iter.Next()
+		if err != nil{
+			return nil, err
+		}
 		blocks = append(blocks, block)
-		log.Printf("\nBLOCK %d: %s", counter, hex.EncodeToString(block.Hash))
-		log.Printf("PREVHASH: %s\n", hex.EncodeToString(block.PrevHash))
-		counter++
 		if len(block.PrevHash) == 0{
 			break
 		}
 	}
 
-	return blocks
+	return blocks, nil
 }
 
-func (chain *BlockChain) ContainsFileHash(hash []byte) bool{
-	var block *Block 
-
-	iter := chain.Iterator()
-	for{
-		block = iter.Next()
-		fileHash := block.Data.Hash
-		if bytes.Equal(hash, fileHash){
-			return true
-		}
-
-		if len(block.PrevHash) == 0{
-			break
-		}
+func (chain *BlockChain) ContainsFileHash(hash []byte) (bool, error){
+	_, err := chain.GetBlockHashByFileHash(hash)
+	if errors.Is(err, ErrBlockNotFound){
+		return false, nil
 	}
-
-	return false
+	return err == nil, err
 }
 
 
-func InitBlockChain(id int) *BlockChain{
+// InitBlockChain opens the database of node id, creating the genesis block of
+// the network described by params if it is empty. A database created for
+// another network is refused.
+func InitBlockChain(id int, params Params, engine Engine) (*BlockChain, error){
+	return openBlockChain(baseDBPath+strconv.Itoa(id), params, engine)
+}
+
+func openBlockChain(dbPath string, params Params, engine Engine) (*BlockChain, error){
 	var lastHash []byte
+	admins, err := parseAdmins(params)
+	if err != nil{
+		return nil, err
+	}
+	genesis, err := Genesis(params, engine)
+	if err != nil{
+		return nil, fmt.Errorf("create %s genesis block: %w", params.Name, err)
+	}
 
-	dbPath := baseDBPath + strconv.Itoa(id) 
 	opts := badger.DefaultOptions(dbPath)
 	opts.ValueLogFileSize = 1 << 25
 
 	db, err := badger.Open(opts)
-	Handle(err)
+	if err != nil{
+		return nil, fmt.Errorf("open database %s: %w", dbPath, err)
+	}
+	if err := migrateStorage(db); err != nil{
+		db.Close()
+		return nil, fmt.Errorf("migrate database %s: %w", dbPath, err)
+	}
 
 	err = db.Update(func(txn *badger.Txn) error{
-		if _, err := txn.Get([]byte("lh")); err == badger.ErrKeyNotFound{
+		item, err := txn.Get([]byte("lh"))
+		if err == badger.ErrKeyNotFound{
 			log.Println("No Existing blockchain found, creating one...")
-			genesis := Genesis()
-
-			err := txn.Set(genesis.Hash, genesis.Serialize())
-			Handle(err)
-			err = txn.Set([]byte("lh"), genesis.Hash)
-
 			lastHash = genesis.Hash
+			return insertGenesis(txn, genesis, engine)
+		}
+		if err != nil{
 			return err
-		} 
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		err = item.Value(func(val []byte) error{
-			lastHash = val
-			return err
-		})
+		}
 
+		lastHash, err = item.ValueCopy(nil)
 		return err
 	})
-		
-	blockchain := BlockChain{lastHash, 1,db}
-	return &blockchain
+	if err != nil{
+		db.Close()
+		return nil, fmt.Errorf("load last hash: %w", err)
+	}
+
+	blockchain := BlockChain{LastHash: lastHash, Database: db, params: params, engine: engine, admins: admins}
+
+	hasIndex, err := blockchain.hasIndex()
+	if err == nil && !hasIndex{
+		err = blockchain.rebuildIndex()
+	} else if err == nil{
+		var tip *Block
+		tip, err = blockchain.GetBlockByHash(lastHash)
+		if err == nil{
+			blockchain.height = tip.Height
+		}
+	}
+	if err != nil{
+		db.Close()
+		return nil, fmt.Errorf("load chain index: %w", err)
+	}
+
+	stored, err := blockchain.GetBlockHashByHeight(0)
+	if err != nil{
+		db.Close()
+		return nil, fmt.Errorf("load genesis block: %w", err)
+	}
+	firstRelease := params.FirstRelease && bytes.Equal(stored, firstReleaseGenesis().Hash)
+	if !bytes.Equal(stored, genesis.Hash) && !firstRelease{
+		db.Close()
+		return nil, fmt.Errorf("database %s does not belong to the %s network", dbPath, params.Name)
+	}
+
+	return &blockchain, nil
+}
+
+func insertGenesis(txn *badger.Txn, genesis *Block, engine Engine) error{
+	serialized, err := genesis.Serialize()
+	if err != nil{
+		return err
+	}
+	if err := txn.Set(genesis.Hash, serialized); err != nil{
+		return err
+	}
+	if err := indexBlock(txn, genesis); err != nil{
+		return err
+	}
+	if err := setWork(txn, genesis.Hash, engine.Work(genesis)); err != nil{
+		return err
+	}
+	if err := setIndexVersion(txn); err != nil{
+		return err
+	}
+	if err := setStorageVersion(txn); err != nil{
+		return err
+	}
+	return txn.Set([]byte("lh"), genesis.Hash)
 }
 
 
 type BlockChainIterator struct{
-	CurrentHash []byte 
+	CurrentHash []byte
 	Database *badger.DB
 }
 
 func (chain *BlockChain) Iterator() *BlockChainIterator{
-	iter := &BlockChainIterator{chain.LastHash, chain.Database}
+	lastHash, _ := chain.Tip()
+	iter := &BlockChainIterator{lastHash, chain.Database}
 	return iter
 }
 
-func (iter *BlockChainIterator) Next() *Block{
+func (iter *BlockChainIterator) Next() (*Block, error){
 	var block *Block
 
 	err := iter.Database.View(func(txn *badger.Txn) error{
-		item, err := txn.Get(iter.CurrentHash)
-		Handle(err)
-		err = item.Value(func(val []byte) error{
-			block = Deserialize(val)
-			return err
-		})
+		var err error
+		block, err = getBlock(txn, iter.CurrentHash)
 		return err
-	})	
-	Handle(err)
-		
+	})
+	if err != nil{
+		return nil, err
+	}
+
 	iter.CurrentHash = block.PrevHash
 
-	return block
+	return block, nil
 }
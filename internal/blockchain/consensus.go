@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// Consensus modes, set in Params.Consensus
+const(
+	ConsensusPoW = "pow"
+	ConsensusPoA = "poa"
+	ConsensusBFT = "bft"
+	ConsensusRaft = "raft"
+)
+
+// ErrInvalidSeal is returned when a block's proof-of-work or signature does
+// not hold
+var ErrInvalidSeal = errors.New("invalid block seal")
+
+// HeaderReader gives an engine access to the stored ancestors of a block
+type HeaderReader interface{
+	GetBlock(hash []byte) (*Block, error)
+}
+
+type txnReader struct{
+	txn *badger.Txn
+}
+
+func (r txnReader) GetBlock(hash []byte) (*Block, error){
+	return getBlock(r.txn, hash)
+}
+
+// checkTimestamp refuses a block timestamped before its parent or more than
+// maxClockDrift ahead of the local clock. The retarget and the turns of the
+// authorities are timed from the timestamps, so a sealer must not pick them.
+func checkTimestamp(parent *Block, block *Block) error{
+	if block.Timestamp < parent.Timestamp{
+		return fmt.Errorf("%w: %d is before parent timestamp %d", ErrInvalidTimestamp, block.Timestamp, parent.Timestamp)
+	}
+	if limit := time.Now().Add(maxClockDrift).UnixMilli(); block.Timestamp > limit{
+		return fmt.Errorf("%w: %d is more than %v ahead of the local clock", ErrInvalidTimestamp, block.Timestamp, maxClockDrift)
+	}
+	return nil
+}
+
+// Engine is the consensus rule set of a chain: how new blocks are sealed,
+// how the seal of any block is checked and how much a block weighs when
+// picking the main chain
+type Engine interface{
+	// CanSeal reports whether this node may produce blocks
+	CanSeal() bool
+	// Prepare sets the consensus fields of block, a new child of parent
+	Prepare(reader HeaderReader, parent *Block, block *Block) error
+	// Seal sets the hash of a prepared block and makes it valid, returning
+	// ctx.Err() if ctx is done first
+	Seal(ctx context.Context, block *Block) error
+	// Hash recomputes the hash of a block from its contents
+	Hash(block *Block) []byte
+	// VerifySeal checks a block on its own, without its ancestors
+	VerifySeal(block *Block) error
+	// VerifyHeader checks the consensus fields of block against its parent
+	VerifyHeader(reader HeaderReader, parent *Block, block *Block) error
+	// Work returns the weight of a block in the fork choice
+	Work(block *Block) *big.Int
+}
+
+// NewEngine returns the engine for the consensus mode of params. key is the
+// node's identity key; it may be nil when the chain is only read.
+func NewEngine(params Params, key crypto.PrivKey) (Engine, error){
+	switch params.Consensus{
+	case ConsensusPoW, "":
+		if err := params.validate(); err != nil{
+			return nil, err
+		}
+		return &PowEngine{params}, nil
+	case ConsensusPoA:
+		return NewAuthorityEngine(params, key)
+	case ConsensusBFT:
+		return NewBFTEngine(params, key)
+	case ConsensusRaft:
+		return NewRaftEngine(params, key)
+	}
+	return nil, fmt.Errorf("unknown consensus %q", params.Consensus)
+}
@@ -0,0 +1,166 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Difficulties are counted in leading zero bits of the block hash
+const(
+	MinDifficulty = 1
+	MaxDifficulty = 255
+)
+
+// Params are the consensus parameters of a network. Nodes only agree on a
+// chain when they run with the same parameters, since the genesis block and
+// the difficulty of every block derive from them.
+type Params struct{
+	Name string
+	// Consensus is ConsensusPoW, ConsensusPoA, ConsensusBFT or ConsensusRaft
+	Consensus string
+	// Authorities are the libp2p peer IDs allowed to seal blocks under
+	// proof-of-authority, in turn order, or the BFT validators
+	Authorities []string
+	// InitialDifficulty is the difficulty of the genesis block and of the
+	// blocks before the first retarget
+	InitialDifficulty uint32
+	// MinDifficulty and MaxDifficulty bound the retarget. Blocks are mined on
+	// demand, so an idle chain drifts down to MinDifficulty.
+	MinDifficulty uint32
+	MaxDifficulty uint32
+	// TargetInterval is the block interval the retarget aims for. Under
+	// proof-of-authority it is how long each authority waits for the one
+	// before it to seal.
+	TargetInterval time.Duration
+	// RetargetWindow is the number of blocks between retargets, and the
+	// number of blocks whose timestamps are measured
+	RetargetWindow uint64
+	// Admins are the base64 encoded DER public keys allowed to sign notary
+	// registry transactions. The registry is disabled without them.
+	Admins []string
+	// FirstRelease marks the network the first release of the service ran
+	// before networks existed. Its databases keep the genesis block of that
+	// release when they are migrated.
+	FirstRelease bool
+}
+
+// Networks holds the parameters of the known networks by name
+var Networks = map[string]Params{
+	"main": {
+		Name: "main",
+		Consensus: ConsensusPoW,
+		InitialDifficulty: 12,
+		MinDifficulty: 8,
+		MaxDifficulty: 32,
+		TargetInterval: 10 * time.Second,
+		RetargetWindow: 16,
+		FirstRelease: true,
+	},
+	"test": {
+		Name: "test",
+		Consensus: ConsensusPoW,
+		InitialDifficulty: 8,
+		MinDifficulty: 4,
+		MaxDifficulty: 24,
+		TargetInterval: 2 * time.Second,
+		RetargetWindow: 8,
+	},
+	"dev": {
+		Name: "dev",
+		Consensus: ConsensusPoW,
+		InitialDifficulty: 4,
+		MinDifficulty: 1,
+		MaxDifficulty: 16,
+		TargetInterval: 500 * time.Millisecond,
+		RetargetWindow: 4,
+	},
+	// the authorities of the poa network are taken from peers.json unless
+	// they are set here
+	"poa": {
+		Name: "poa",
+		Consensus: ConsensusPoA,
+		TargetInterval: 2 * time.Second,
+	},
+	// like poa, the validators of the bft network default to peers.json
+	"bft": {
+		Name: "bft",
+		Consensus: ConsensusBFT,
+	},
+	// the members of the raft network default to peers.json too
+	"raft": {
+		Name: "raft",
+		Consensus: ConsensusRaft,
+	},
+}
+
+// NetworkParams returns the parameters of a known network
+func NetworkParams(name string) (Params, error){
+	params, ok := Networks[name]
+	if !ok{
+		names := make([]string, 0, len(Networks))
+		for name := range Networks{
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Params{}, fmt.Errorf("unknown network %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if err := params.validate(); err != nil{
+		return Params{}, err
+	}
+	return params, nil
+}
+
+// validate checks the proof-of-work parameters: a retarget window of at least
+// one block and difficulties within the bounds of the network, themselves
+// within MinDifficulty and MaxDifficulty. The other consensus modes do not
+// use them.
+func (params Params) validate() error{
+	if params.Consensus != ConsensusPoW && params.Consensus != ""{
+		return nil
+	}
+	if params.RetargetWindow == 0{
+		return fmt.Errorf("network %q: the retarget window must be at least one block", params.Name)
+	}
+	if params.MinDifficulty < MinDifficulty || params.MaxDifficulty > MaxDifficulty || params.MinDifficulty > params.MaxDifficulty{
+		return fmt.Errorf("network %q: difficulty bounds %d to %d are not within %d to %d", params.Name, params.MinDifficulty, params.MaxDifficulty, MinDifficulty, MaxDifficulty)
+	}
+	if params.InitialDifficulty < params.MinDifficulty || params.InitialDifficulty > params.MaxDifficulty{
+		return fmt.Errorf("network %q: initial difficulty %d is not within %d to %d", params.Name, params.InitialDifficulty, params.MinDifficulty, params.MaxDifficulty)
+	}
+	return nil
+}
+
+// nextDifficulty keeps the parent difficulty except at every RetargetWindow
+// heights, where it is raised by one bit when the last window was mined in
+// under half the target time and lowered by one bit when it took more than
+// twice as long. A window starting at genesis is skipped, so the first
+// retarget happens at height 2*RetargetWindow.
+func nextDifficulty(params Params, reader HeaderReader, parent *Block) (uint32, error){
+	height := parent.Height + 1
+	if height%params.RetargetWindow != 0 || height < 2*params.RetargetWindow{
+		return parent.Difficulty, nil
+	}
+
+	first := parent
+	for first.Height > height-params.RetargetWindow{
+		var err error
+		first, err = reader.GetBlock(first.PrevHash)
+		if err != nil{
+			return 0, err
+		}
+	}
+
+	span := time.Duration(parent.Timestamp-first.Timestamp) * time.Millisecond
+	target := params.TargetInterval * time.Duration(params.RetargetWindow-1)
+
+	difficulty := parent.Difficulty
+	switch{
+	case span < target/2 && difficulty < params.MaxDifficulty:
+		difficulty++
+	case span > target*2 && difficulty > params.MinDifficulty:
+		difficulty--
+	}
+	return difficulty, nil
+}
@@ -0,0 +1,79 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNetworksValid(t *testing.T){
+	for name := range Networks{
+		if _, err := NetworkParams(name); err != nil{
+			t.Errorf("network %s: %v", name, err)
+		}
+	}
+}
+
+func TestInvalidPowParams(t *testing.T){
+	dev := Networks["dev"]
+	noWindow := dev
+	noWindow.RetargetWindow = 0
+	inverted := dev
+	inverted.MinDifficulty, inverted.MaxDifficulty = dev.MaxDifficulty, dev.MinDifficulty
+	tooHard := dev
+	tooHard.InitialDifficulty = dev.MaxDifficulty + 1
+
+	for name, params := range map[string]Params{
+		"zero params": {},
+		"no retarget window": noWindow,
+		"inverted bounds": inverted,
+		"initial difficulty out of bounds": tooHard,
+	}{
+		if _, err := NewEngine(params, nil); err == nil{
+			t.Errorf("NewEngine accepted %s", name)
+		}
+	}
+
+	Networks["broken"] = noWindow
+	defer delete(Networks, "broken")
+	if _, err := NetworkParams("broken"); err == nil{
+		t.Error("NetworkParams returned a network without a retarget window")
+	}
+}
+
+// resealed returns a block of chain at height 1 timestamped at timestamp
+func resealed(t *testing.T, chain *BlockChain, timestamp int64) *Block{
+	t.Helper()
+	block, err := chain.CreateBlock(context.Background(), nil, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	block.Timestamp = timestamp
+	if err := chain.engine.Seal(context.Background(), block); err != nil{
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestBlockTimestampRefused(t *testing.T){
+	chain := devChain(t)
+	first, err := chain.CreateInsertBlock(context.Background(), nil, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	backdated := resealed(t, chain, first.Timestamp-1)
+	if err := chain.InsertBlock(backdated); !errors.Is(err, ErrInvalidTimestamp){
+		t.Fatalf("block timestamped before its parent: %v", err)
+	}
+
+	future := resealed(t, chain, time.Now().Add(maxClockDrift+time.Minute).UnixMilli())
+	if err := chain.InsertBlock(future); !errors.Is(err, ErrInvalidTimestamp){
+		t.Fatalf("block timestamped in the future: %v", err)
+	}
+
+	if err := chain.InsertBlock(resealed(t, chain, first.Timestamp)); err != nil{
+		t.Fatalf("block timestamped with its parent: %v", err)
+	}
+}
@@ -0,0 +1,407 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"blockchain-service/internal/codec"
+)
+
+// SchemaVersion is the version of the block encoding written by this node.
+// Version 0 are the blocks mined before the encoding was introduced: they
+// were hashed over gob and are only kept so that migrated databases still
+// verify (see legacy.go). The messages and their field numbers are defined
+// in proto/blockchain.proto.
+const SchemaVersion = 1
+
+// Field numbers of the Block message
+const(
+	blockVersion = iota + 1
+	blockHash
+	blockPrevHash
+	blockNonce
+	blockDifficulty
+	blockHeight
+	blockTimestamp
+	blockMerkleRoot
+	blockSigner
+	blockSignature
+	blockCommit
+	blockData
+	blockNotaries
+	blockStatuses
+)
+
+// Field numbers of the BlockData message
+const(
+	dataHash = iota + 1
+	dataDocumentID
+	dataNotaryID
+	dataUserID
+	dataCNPJ
+	dataPublicKey
+	dataSignature
+)
+
+// Field numbers of the NotaryTx message
+const(
+	notaryTxOp = iota + 1
+	notaryTxNotaryID
+	notaryTxPublicKey
+	notaryTxTimestamp
+	notaryTxAdmin
+	notaryTxSignature
+)
+
+// Field numbers of the StatusTx message
+const(
+	statusTxOp = iota + 1
+	statusTxTarget
+	statusTxReplacement
+	statusTxReason
+	statusTxNotaryID
+	statusTxTimestamp
+	statusTxPublicKey
+	statusTxSignature
+)
+
+// Field numbers of the CommitSig message
+const(
+	commitValidator = iota + 1
+	commitRound
+	commitSignature
+)
+
+// checkVersion checks that a block is not of an older schema version than
+// its parent. Blocks only move to a newer version once, and blocks of the
+// first release only follow each other.
+func checkVersion(parent *Block, block *Block) error{
+	if block.isFirstRelease() && !parent.isFirstRelease(){
+		return fmt.Errorf("%w: block of the first release after a newer block", ErrInvalidVersion)
+	}
+	if block.Version > SchemaVersion{
+		return fmt.Errorf("%w: version %d is newer than %d", ErrInvalidVersion, block.Version, SchemaVersion)
+	}
+	if block.Version < parent.Version{
+		return fmt.Errorf("%w: version %d after parent version %d", ErrInvalidVersion, block.Version, parent.Version)
+	}
+	return nil
+}
+
+// header writes the fields of a block covered by its hash
+func (b *Block) header(e *codec.Encoder){
+	b.headerBeforeNonce(e)
+	e.Int(blockNonce, int64(b.Nonce))
+	b.headerAfterNonce(e)
+}
+
+func (b *Block) headerBeforeNonce(e *codec.Encoder){
+	e.Uint(blockVersion, uint64(b.Version))
+	e.Bytes(blockPrevHash, b.PrevHash)
+}
+
+func (b *Block) headerAfterNonce(e *codec.Encoder){
+	e.Uint(blockDifficulty, uint64(b.Difficulty))
+	e.Uint(blockHeight, b.Height)
+	e.Int(blockTimestamp, b.Timestamp)
+	e.Bytes(blockMerkleRoot, b.MerkleRoot)
+	e.Bytes(blockSigner, b.Signer)
+}
+
+// HeaderBytes returns the bytes a block hash is computed over: the canonical
+// encoding of the block without its hash, signature, commit and entries. The
+// entries are covered by the merkle root.
+func (b *Block) HeaderBytes() []byte{
+	var e codec.Encoder
+	b.header(&e)
+	return e.Encoded()
+}
+
+// Serialize returns the canonical encoding of the block, used for storage and
+// on the wire
+func (b *Block) Serialize() ([]byte, error){
+	var e codec.Encoder
+	e.Uint(blockVersion, uint64(b.Version))
+	e.Bytes(blockHash, b.Hash)
+	e.Bytes(blockPrevHash, b.PrevHash)
+	e.Int(blockNonce, int64(b.Nonce))
+	e.Uint(blockDifficulty, uint64(b.Difficulty))
+	e.Uint(blockHeight, b.Height)
+	e.Int(blockTimestamp, b.Timestamp)
+	e.Bytes(blockMerkleRoot, b.MerkleRoot)
+	e.Bytes(blockSigner, b.Signer)
+	e.Bytes(blockSignature, b.Signature)
+	for i := range b.Commit{
+		e.Message(blockCommit, b.Commit[i].Serialize())
+	}
+	for i := range b.Data{
+		e.Message(blockData, b.Data[i].Serialize())
+	}
+	for i := range b.Notaries{
+		e.Message(blockNotaries, b.Notaries[i].Serialize())
+	}
+	for i := range b.Statuses{
+		e.Message(blockStatuses, b.Statuses[i].Serialize())
+	}
+	return e.Encoded(), nil
+}
+
+// Deserialize decodes a block from its canonical encoding. Blocks of a newer
+// schema version than SchemaVersion are refused.
+func Deserialize(data []byte) (*Block, error){
+	block, err := decodeBlock(data)
+	if err != nil{
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	return block, nil
+}
+
+func decodeBlock(data []byte) (*Block, error){
+	var block Block
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case blockVersion:
+			block.Version = d.Uint32()
+		case blockHash:
+			block.Hash = d.Bytes()
+		case blockPrevHash:
+			block.PrevHash = d.Bytes()
+		case blockNonce:
+			block.Nonce = int(d.Int())
+		case blockDifficulty:
+			block.Difficulty = d.Uint32()
+		case blockHeight:
+			block.Height = d.Uint()
+		case blockTimestamp:
+			block.Timestamp = d.Int()
+		case blockMerkleRoot:
+			block.MerkleRoot = d.Bytes()
+		case blockSigner:
+			block.Signer = d.Bytes()
+		case blockSignature:
+			block.Signature = d.Bytes()
+		case blockCommit:
+			commit, err := decodeCommitSig(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			block.Commit = append(block.Commit, *commit)
+		case blockData:
+			data, err := decodeBlockData(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			block.Data = append(block.Data, *data)
+		case blockNotaries:
+			tx, err := decodeNotaryTx(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			block.Notaries = append(block.Notaries, *tx)
+		case blockStatuses:
+			tx, err := decodeStatusTx(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			block.Statuses = append(block.Statuses, *tx)
+		default:
+			d.Skip()
+		}
+	}
+	if err := d.Err(); err != nil{
+		return nil, err
+	}
+	if block.Version > SchemaVersion{
+		return nil, fmt.Errorf("schema version %d is newer than %d", block.Version, SchemaVersion)
+	}
+
+	encoded, _ := block.Serialize()
+	if err := codec.Canonical(data, encoded); err != nil{
+		return nil, err
+	}
+	return &block, nil
+}
+
+// Serialize returns the canonical encoding of the entry. It is the merkle
+// leaf of the entry in blocks of the current schema version.
+func (bd *BlockData) Serialize() []byte{
+	var e codec.Encoder
+	e.Bytes(dataHash, bd.Hash)
+	e.Text(dataDocumentID, bd.DocumentID)
+	e.Text(dataNotaryID, bd.NotaryID)
+	e.Text(dataUserID, bd.UserID)
+	e.Text(dataCNPJ, bd.CNPJ)
+	e.Bytes(dataPublicKey, bd.PublicKey)
+	e.Bytes(dataSignature, bd.Signature)
+	return e.Encoded()
+}
+
+// DeserializeBlockData decodes an entry from its canonical encoding
+func DeserializeBlockData(data []byte) (*BlockData, error){
+	bd, err := decodeBlockData(data)
+	if err != nil{
+		return nil, err
+	}
+	if err := codec.Canonical(data, bd.Serialize()); err != nil{
+		return nil, err
+	}
+	return bd, nil
+}
+
+func decodeBlockData(data []byte) (*BlockData, error){
+	var bd BlockData
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case dataHash:
+			bd.Hash = d.Bytes()
+		case dataDocumentID:
+			bd.DocumentID = d.Text()
+		case dataNotaryID:
+			bd.NotaryID = d.Text()
+		case dataUserID:
+			bd.UserID = d.Text()
+		case dataCNPJ:
+			bd.CNPJ = d.Text()
+		case dataPublicKey:
+			bd.PublicKey = d.Bytes()
+		case dataSignature:
+			bd.Signature = d.Bytes()
+		default:
+			d.Skip()
+		}
+	}
+	return &bd, d.Err()
+}
+
+// Serialize returns the canonical encoding of the transaction. It is the
+// merkle leaf of the transaction in blocks of the current schema version.
+func (tx *NotaryTx) Serialize() []byte{
+	var e codec.Encoder
+	e.Text(notaryTxOp, tx.Op)
+	e.Text(notaryTxNotaryID, tx.NotaryID)
+	e.Bytes(notaryTxPublicKey, tx.PublicKey)
+	e.Int(notaryTxTimestamp, tx.Timestamp)
+	e.Bytes(notaryTxAdmin, tx.Admin)
+	e.Bytes(notaryTxSignature, tx.Signature)
+	return e.Encoded()
+}
+
+// DeserializeNotaryTx decodes a registry transaction from its canonical
+// encoding
+func DeserializeNotaryTx(data []byte) (*NotaryTx, error){
+	tx, err := decodeNotaryTx(data)
+	if err != nil{
+		return nil, err
+	}
+	if err := codec.Canonical(data, tx.Serialize()); err != nil{
+		return nil, err
+	}
+	return tx, nil
+}
+
+func decodeNotaryTx(data []byte) (*NotaryTx, error){
+	var tx NotaryTx
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case notaryTxOp:
+			tx.Op = d.Text()
+		case notaryTxNotaryID:
+			tx.NotaryID = d.Text()
+		case notaryTxPublicKey:
+			tx.PublicKey = d.Bytes()
+		case notaryTxTimestamp:
+			tx.Timestamp = d.Int()
+		case notaryTxAdmin:
+			tx.Admin = d.Bytes()
+		case notaryTxSignature:
+			tx.Signature = d.Bytes()
+		default:
+			d.Skip()
+		}
+	}
+	return &tx, d.Err()
+}
+
+// Serialize returns the canonical encoding of the transaction. It is the
+// merkle leaf of the transaction in blocks of the current schema version.
+func (tx *StatusTx) Serialize() []byte{
+	var e codec.Encoder
+	e.Text(statusTxOp, tx.Op)
+	e.Bytes(statusTxTarget, tx.Target)
+	e.Bytes(statusTxReplacement, tx.Replacement)
+	e.Text(statusTxReason, tx.Reason)
+	e.Text(statusTxNotaryID, tx.NotaryID)
+	e.Int(statusTxTimestamp, tx.Timestamp)
+	e.Bytes(statusTxPublicKey, tx.PublicKey)
+	e.Bytes(statusTxSignature, tx.Signature)
+	return e.Encoded()
+}
+
+// DeserializeStatusTx decodes a status transaction from its canonical
+// encoding
+func DeserializeStatusTx(data []byte) (*StatusTx, error){
+	tx, err := decodeStatusTx(data)
+	if err != nil{
+		return nil, err
+	}
+	if err := codec.Canonical(data, tx.Serialize()); err != nil{
+		return nil, err
+	}
+	return tx, nil
+}
+
+func decodeStatusTx(data []byte) (*StatusTx, error){
+	var tx StatusTx
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case statusTxOp:
+			tx.Op = d.Text()
+		case statusTxTarget:
+			tx.Target = d.Bytes()
+		case statusTxReplacement:
+			tx.Replacement = d.Bytes()
+		case statusTxReason:
+			tx.Reason = d.Text()
+		case statusTxNotaryID:
+			tx.NotaryID = d.Text()
+		case statusTxTimestamp:
+			tx.Timestamp = d.Int()
+		case statusTxPublicKey:
+			tx.PublicKey = d.Bytes()
+		case statusTxSignature:
+			tx.Signature = d.Bytes()
+		default:
+			d.Skip()
+		}
+	}
+	return &tx, d.Err()
+}
+
+func (c *CommitSig) Serialize() []byte{
+	var e codec.Encoder
+	e.Bytes(commitValidator, c.Validator)
+	e.Uint(commitRound, uint64(c.Round))
+	e.Bytes(commitSignature, c.Signature)
+	return e.Encoded()
+}
+
+func decodeCommitSig(data []byte) (*CommitSig, error){
+	var c CommitSig
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case commitValidator:
+			c.Validator = d.Bytes()
+		case commitRound:
+			c.Round = d.Uint32()
+		case commitSignature:
+			c.Signature = d.Bytes()
+		default:
+			d.Skip()
+		}
+	}
+	return &c, d.Err()
+}
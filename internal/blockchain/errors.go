@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"errors"
+)
+
+var(
+	// ErrBlockNotFound is returned when a block, or an index entry pointing to
+	// one, is not in the database
+	ErrBlockNotFound = errors.New("block not found")
+	// ErrCorruptBlock is returned when a stored value cannot be decoded
+	ErrCorruptBlock = errors.New("corrupt block")
+	ErrUnknownParent = errors.New("parent block not found")
+	ErrInvalidHeight = errors.New("block height does not follow its parent")
+	ErrInvalidDifficulty = errors.New("block difficulty does not match the consensus rules")
+	ErrInvalidMerkleRoot = errors.New("merkle root does not match the block data")
+	// ErrInvalidTimestamp is returned for a block timestamped before its
+	// parent or too far ahead of the local clock
+	ErrInvalidTimestamp = errors.New("invalid block timestamp")
+	// ErrInvalidVersion is returned for a block of an older schema version
+	// than its parent, or of a newer one than the node supports
+	ErrInvalidVersion = errors.New("invalid block schema version")
+	// ErrInvalidHash is returned for a document hash of an unknown algorithm
+	// or of the wrong length for its algorithm
+	ErrInvalidHash = errors.New("invalid document hash")
+	// ErrInvalidSignature is returned when a document is not signed by the
+	// key it carries
+	ErrInvalidSignature = errors.New("invalid document signature")
+	// ErrInvalidNotaryTx is returned for a registry transaction that is not
+	// signed by an admin or does not apply to the registry state
+	ErrInvalidNotaryTx = errors.New("invalid notary registry transaction")
+	ErrRegistryDisabled = errors.New("notary registry is disabled, no registry admins are configured")
+	ErrNotaryNotFound = errors.New("notary not found in the registry")
+	// ErrUnauthorizedNotary is returned when a document's notary is not
+	// active in the registry with the key that signed it
+	ErrUnauthorizedNotary = errors.New("notary is not authorized")
+	// ErrDocumentAnchored is returned for a block anchoring a document that a
+	// main chain block already anchors
+	ErrDocumentAnchored = errors.New("document is already anchored")
+	// ErrInvalidStatusTx is returned for a revocation or supersession that is
+	// not signed by the notary of its document or does not apply to it
+	ErrInvalidStatusTx = errors.New("invalid document status transaction")
+	// ErrInvalidBranch is returned for a block of a side branch that failed
+	// to become the main chain, or that extends one
+	ErrInvalidBranch = errors.New("block is on an invalid branch")
+)
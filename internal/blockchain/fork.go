@@ -0,0 +1,447 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const(
+	workPrefix = "w:"
+	invalidPrefix = "x:"
+)
+
+// workKey returns the badger key holding the cumulative work of the branch
+// ending at the given block
+func workKey(hash []byte) []byte{
+	return append([]byte(workPrefix), hash...)
+}
+
+// invalidKey returns the badger key marking a block whose branch failed to
+// become the main chain
+func invalidKey(hash []byte) []byte{
+	return append([]byte(invalidPrefix), hash...)
+}
+
+// branchError is returned when blocks are refused for their branch, with the
+// blocks to mark invalid so that their descendants are refused right away
+type branchError struct{
+	blocks [][]byte
+	err error
+}
+
+func (e *branchError) Error() string{
+	return e.err.Error()
+}
+
+func (e *branchError) Unwrap() error{
+	return e.err
+}
+
+// refusedByState reports whether a block failed to join the main chain
+// because its transactions do not apply to the state, rather than because of
+// the database
+func refusedByState(err error) bool{
+	for _, target := range []error{ErrDocumentAnchored, ErrUnauthorizedNotary, ErrNotaryNotFound, ErrRegistryDisabled, ErrInvalidNotaryTx, ErrInvalidStatusTx}{
+		if errors.Is(err, target){
+			return true
+		}
+	}
+	return false
+}
+
+// markInvalid records blocks of an invalid branch. It runs after the
+// transaction that found them failed, so a failure to record them is only
+// logged: the branch is then checked again.
+func (chain *BlockChain) markInvalid(blocks [][]byte){
+	err := chain.Database.Update(func(txn *badger.Txn) error{
+		for _, hash := range blocks{
+			if err := txn.Set(invalidKey(hash), []byte{}); err != nil{
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil{
+		log.Printf("Failed to mark %d blocks invalid: %v", len(blocks), err)
+	}
+}
+
+func getBlock(txn *badger.Txn, hash []byte) (*Block, error){
+	var block *Block
+
+	item, err := txn.Get(hash)
+	if err == badger.ErrKeyNotFound{
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, hash)
+	}
+	if err != nil{
+		return nil, err
+	}
+	err = item.Value(func(val []byte) error{
+		var err error
+		block, err = Deserialize(val)
+		return err
+	})
+	return block, err
+}
+
+func getWork(txn *badger.Txn, hash []byte) (*big.Int, error){
+	item, err := txn.Get(workKey(hash))
+	if err != nil{
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil{
+		return nil, err
+	}
+	return new(big.Int).SetBytes(val), nil
+}
+
+func setWork(txn *badger.Txn, hash []byte, work *big.Int) error{
+	return txn.Set(workKey(hash), work.Bytes())
+}
+
+// unindexBlock removes the secondary index entries of a block leaving the
+// main chain and reverts its registry and status transactions. File hash entries are
+// only removed if they still point to the block.
+func unindexBlock(txn *badger.Txn, block *Block) error{
+	if err := txn.Delete(heightKey(block.Height)); err != nil{
+		return err
+	}
+	if err := unindexStatuses(txn, block); err != nil{
+		return err
+	}
+	if err := unindexNotaries(txn, block); err != nil{
+		return err
+	}
+
+	for _, data := range block.Data{
+		if len(data.Hash) == 0{
+			continue
+		}
+
+		item, err := txn.Get(fileHashKey(data.Hash))
+		if err == badger.ErrKeyNotFound{
+			continue
+		}
+		if err != nil{
+			return err
+		}
+		anchor, err := item.ValueCopy(nil)
+		if err != nil{
+			return err
+		}
+		if !bytes.Equal(anchor, block.Hash){
+			continue
+		}
+		if err := txn.Delete(fileHashKey(data.Hash)); err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+// Work returns the cumulative work of the branch ending at the given block
+func (chain *BlockChain) Work(hash []byte) (*big.Int, error){
+	var work *big.Int
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		var err error
+		work, err = getWork(txn, hash)
+		return err
+	})
+	if err == badger.ErrKeyNotFound{
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, hash)
+	}
+	if err != nil{
+		return nil, err
+	}
+
+	return work, nil
+}
+
+// AcceptBlock checks and stores a block whose parent is already known. The
+// seal, the merkle root, the document signatures, the registry and status
+// transactions and the consensus fields are checked, the seal and consensus fields against the chain's engine. A block that
+// does not extend the current tip is kept as a side branch, and once a side
+// branch carries more cumulative work than the main chain the chain is
+// reorganized onto it. Registry and status transactions are applied when
+// their block joins the main chain, and a block whose transactions do not
+// apply to the state is refused then. The documents and transactions of the
+// blocks that left the main chain and are not included by the new branch
+// are returned so they can be mined again. When the blocks of a branch do
+// not apply, the branch is marked invalid from the first of them and its
+// descendants are refused with ErrInvalidBranch without being checked again.
+func (chain *BlockChain) AcceptBlock(block *Block) (*Orphans, error){
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	orphaned := &Orphans{}
+	newTip := false
+
+	err := chain.Database.Update(func(txn *badger.Txn) error{
+		if _, err := txn.Get(invalidKey(block.Hash)); err == nil{
+			return fmt.Errorf("%w: block %x", ErrInvalidBranch, block.Hash)
+		}
+		if _, err := txn.Get(block.Hash); err == nil{
+			return nil
+		}
+
+		if _, err := txn.Get(invalidKey(block.PrevHash)); err == nil{
+			if err := chain.engine.VerifySeal(block); err != nil{
+				return err
+			}
+			// only a sealed block is marked, so that a forgery carrying the
+			// hash of a valid block cannot get it refused
+			return &branchError{[][]byte{block.Hash}, fmt.Errorf("%w: parent %x", ErrInvalidBranch, block.PrevHash)}
+		}
+
+		parent, err := getBlock(txn, block.PrevHash)
+		if errors.Is(err, ErrBlockNotFound){
+			return ErrUnknownParent
+		}
+		if err != nil{
+			return err
+		}
+		if block.Height != parent.Height+1{
+			return fmt.Errorf("%w: height %d, parent height %d", ErrInvalidHeight, block.Height, parent.Height)
+		}
+		if err := checkVersion(parent, block); err != nil{
+			return err
+		}
+		if err := chain.engine.VerifySeal(block); err != nil{
+			return err
+		}
+		if !block.HasValidMerkleRoot(){
+			return ErrInvalidMerkleRoot
+		}
+		if err := verifyDocuments(block); err != nil{
+			return err
+		}
+		if err := verifyNotaries(block, chain.admins); err != nil{
+			return err
+		}
+		if err := verifyStatuses(block); err != nil{
+			return err
+		}
+		if err := chain.engine.VerifyHeader(txnReader{txn}, parent, block); err != nil{
+			return err
+		}
+
+		parentWork, err := getWork(txn, parent.Hash)
+		if err != nil{
+			return err
+		}
+		work := new(big.Int).Add(parentWork, chain.engine.Work(block))
+
+		serialized, err := block.Serialize()
+		if err != nil{
+			return err
+		}
+		if err := txn.Set(block.Hash, serialized); err != nil{
+			return err
+		}
+		if err := setWork(txn, block.Hash, work); err != nil{
+			return err
+		}
+
+		if !bytes.Equal(block.PrevHash, chain.LastHash){
+			tipWork, err := getWork(txn, chain.LastHash)
+			if err != nil{
+				return err
+			}
+			if work.Cmp(tipWork) <= 0{
+				log.Printf("Stored side branch block %x at height %d", block.Hash, block.Height)
+				return nil
+			}
+
+			orphaned, err = chain.reorg(txn, block)
+			if err != nil{
+				return err
+			}
+		} else if err := chain.connectBlock(txn, block); err != nil{
+			return err
+		}
+
+		newTip = true
+		return txn.Set([]byte("lh"), block.Hash)
+	})
+	var branch *branchError
+	if errors.As(err, &branch){
+		chain.markInvalid(branch.blocks)
+	}
+	if err != nil{
+		return nil, err
+	}
+
+	if newTip{
+		chain.LastHash = block.Hash
+		chain.height = block.Height
+	}
+	return orphaned, nil
+}
+
+// CheckBlock runs the checks of AcceptBlock that do not depend on the seal,
+// for blocks that are only sealed after agreeing on them. The registry and
+// status transactions are checked against the state after the parent, which
+// must be the tip.
+func (chain *BlockChain) CheckBlock(block *Block) error{
+	return chain.Database.View(func(txn *badger.Txn) error{
+		parent, err := getBlock(txn, block.PrevHash)
+		if errors.Is(err, ErrBlockNotFound){
+			return ErrUnknownParent
+		}
+		if err != nil{
+			return err
+		}
+		if block.Height != parent.Height+1{
+			return fmt.Errorf("%w: height %d, parent height %d", ErrInvalidHeight, block.Height, parent.Height)
+		}
+		if err := checkVersion(parent, block); err != nil{
+			return err
+		}
+		if !bytes.Equal(chain.engine.Hash(block), block.Hash){
+			return fmt.Errorf("%w: hash does not match the block contents", ErrInvalidSeal)
+		}
+		if !block.HasValidMerkleRoot(){
+			return ErrInvalidMerkleRoot
+		}
+		if err := verifyDocuments(block); err != nil{
+			return err
+		}
+		if err := verifyNotaries(block, chain.admins); err != nil{
+			return err
+		}
+		if err := checkAnchors(txn, block); err != nil{
+			return err
+		}
+		if err := chain.authorizeDocuments(txn, block); err != nil{
+			return err
+		}
+		if _, err := applyNotaries(txn, block); err != nil{
+			return err
+		}
+		if err := verifyStatuses(block); err != nil{
+			return err
+		}
+		if err := checkStatuses(txn, block); err != nil{
+			return err
+		}
+		return chain.engine.VerifyHeader(txnReader{txn}, parent, block)
+	})
+}
+
+// connectBlock indexes a block joining the main chain inside txn. A block
+// anchoring a document again, or whose documents are not authorized by the
+// registry state after its parent, is refused.
+func (chain *BlockChain) connectBlock(txn *badger.Txn, block *Block) error{
+	if err := checkAnchors(txn, block); err != nil{
+		return err
+	}
+	if err := chain.authorizeDocuments(txn, block); err != nil{
+		return err
+	}
+	return indexBlock(txn, block)
+}
+
+// reorg moves the main chain indexes inside txn from the current tip to the
+// branch ending at newTip and returns the orphaned entries
+func (chain *BlockChain) reorg(txn *badger.Txn, newTip *Block) (*Orphans, error){
+	branch := []*Block{newTip}
+	var fork *Block
+
+	for current := newTip; fork == nil;{
+		parent, err := getBlock(txn, current.PrevHash)
+		if err != nil{
+			return nil, err
+		}
+
+		item, err := txn.Get(heightKey(parent.Height))
+		if err != nil && err != badger.ErrKeyNotFound{
+			return nil, err
+		}
+		if err == nil{
+			mainHash, err := item.ValueCopy(nil)
+			if err != nil{
+				return nil, err
+			}
+			if bytes.Equal(mainHash, parent.Hash){
+				fork = parent
+				break
+			}
+		}
+
+		branch = append(branch, parent)
+		current = parent
+	}
+
+	disconnected := []*Block{}
+	for hash := chain.LastHash; !bytes.Equal(hash, fork.Hash);{
+		block, err := getBlock(txn, hash)
+		if err != nil{
+			return nil, err
+		}
+		if err := unindexBlock(txn, block); err != nil{
+			return nil, err
+		}
+		disconnected = append(disconnected, block)
+		hash = block.PrevHash
+	}
+
+	anchored := map[string]bool{}
+	applied := map[string]bool{}
+	changed := map[string]bool{}
+	for i := len(branch) - 1; i >= 0; i--{
+		if err := chain.connectBlock(txn, branch[i]); err != nil{
+			if !refusedByState(err){
+				return nil, err
+			}
+			invalid := [][]byte{}
+			for _, block := range branch[:i+1]{
+				invalid = append(invalid, block.Hash)
+			}
+			return nil, &branchError{invalid, fmt.Errorf("block %x at height %d: %w", branch[i].Hash, branch[i].Height, err)}
+		}
+		for _, data := range branch[i].Data{
+			anchored[string(data.Hash)] = true
+		}
+		for j := range branch[i].Notaries{
+			applied[string(branch[i].Notaries[j].Hash())] = true
+		}
+		for j := range branch[i].Statuses{
+			changed[string(branch[i].Statuses[j].Hash())] = true
+		}
+	}
+
+	orphaned := &Orphans{Data: []BlockData{}}
+	for i := len(disconnected) - 1; i >= 0; i--{
+		for _, data := range disconnected[i].Data{
+			if len(data.Hash) == 0 || anchored[string(data.Hash)]{
+				continue
+			}
+			orphaned.Data = append(orphaned.Data, data)
+		}
+		for _, tx := range disconnected[i].Notaries{
+			if applied[string(tx.Hash())]{
+				continue
+			}
+			orphaned.Notaries = append(orphaned.Notaries, tx)
+		}
+		for _, tx := range disconnected[i].Statuses{
+			if changed[string(tx.Hash())]{
+				continue
+			}
+			orphaned.Statuses = append(orphaned.Statuses, tx)
+		}
+	}
+
+	log.Printf(
+		"Reorganized chain at height %d: %d blocks disconnected, %d connected, new tip %x",
+		fork.Height, len(disconnected), len(branch), newTip.Hash,
+	)
+	return orphaned, nil
+}
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// sideBlock returns a sealed block extending parent, which need not be the
+// tip of chain
+func sideBlock(t *testing.T, chain *BlockChain, parent *Block, data []BlockData) *Block{
+	t.Helper()
+	block := NewBlock(data, nil, nil, parent.Hash, parent.Height+1, time.Now().UnixMilli())
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		return chain.engine.Prepare(txnReader{txn}, parent, block)
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.engine.Seal(context.Background(), block); err != nil{
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestFailedReorgMarksBranchInvalid(t *testing.T){
+	chain := devChain(t)
+	ctx := context.Background()
+	genesis, err := chain.GetBlockByHeight(0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := chain.CreateInsertBlock(ctx, []BlockData{document(t, "deed.pdf")}, nil, nil); err != nil{
+		t.Fatal(err)
+	}
+	tip, err := chain.CreateInsertBlock(ctx, nil, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	// the side branch anchors deed.pdf twice, which is only found when it
+	// outgrows the main chain
+	first := sideBlock(t, chain, genesis, []BlockData{document(t, "deed.pdf")})
+	again := sideBlock(t, chain, first, []BlockData{document(t, "deed.pdf")})
+	for _, block := range []*Block{first, again}{
+		if err := chain.InsertBlock(block); err != nil{
+			t.Fatalf("side block %d: %v", block.Height, err)
+		}
+	}
+	heavier := sideBlock(t, chain, again, nil)
+	if err := chain.InsertBlock(heavier); !errors.Is(err, ErrDocumentAnchored){
+		t.Fatalf("reorg onto a branch anchoring a document twice: %v", err)
+	}
+	if lastHash, _ := chain.Tip(); !bytes.Equal(lastHash, tip.Hash){
+		t.Fatalf("tip moved to %x after a failed reorg", lastHash)
+	}
+
+	// neither the branch tip nor any block extending the branch from the
+	// invalid block is checked again
+	sibling := sideBlock(t, chain, again, []BlockData{document(t, "will.pdf")})
+	for _, test := range []struct{
+		name string
+		block *Block
+	}{
+		{"branch tip", heavier},
+		{"sibling of the branch tip", sibling},
+		{"child of the branch tip", sideBlock(t, chain, heavier, nil)},
+		{"child of the sibling", sideBlock(t, chain, sibling, nil)},
+	}{
+		if err := chain.InsertBlock(test.block); !errors.Is(err, ErrInvalidBranch){
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+
+	// the valid part of the branch can still be extended
+	other := sideBlock(t, chain, first, []BlockData{document(t, "will.pdf")})
+	if err := chain.InsertBlock(other); err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.InsertBlock(sideBlock(t, chain, other, nil)); err != nil{
+		t.Fatal(err)
+	}
+	if _, height := chain.Tip(); height != 3{
+		t.Fatalf("tip at height %d after reorg onto the valid branch, want 3", height)
+	}
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/multiformats/go-multihash"
+	mhcore "github.com/multiformats/go-multihash/core"
+	_ "github.com/multiformats/go-multihash/register/blake3"
+	_ "github.com/multiformats/go-multihash/register/sha3"
+)
+
+// Hash algorithms of anchored documents. SHA-256 hashes are stored as their
+// raw digest, as they always were, and the other ones as multihashes, so
+// that the algorithm is covered by the notary's signature, the merkle leaves
+// and the index. A stored hash is thus told apart by its length alone.
+const(
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashSHA3_256 = "sha3-256"
+	HashBLAKE3 = "blake3"
+)
+
+// hashAlgorithm is the multihash code and digest size of an algorithm
+type hashAlgorithm struct{
+	code uint64
+	size int
+}
+
+var hashAlgorithms = map[string]hashAlgorithm{
+	HashSHA256: {multihash.SHA2_256, 32},
+	HashSHA512: {multihash.SHA2_512, 64},
+	HashSHA3_256: {multihash.SHA3_256, 32},
+	HashBLAKE3: {multihash.BLAKE3, 32},
+}
+
+// HashAlgorithms lists the supported algorithms
+func HashAlgorithms() []string{
+	return []string{HashSHA256, HashSHA512, HashSHA3_256, HashBLAKE3}
+}
+
+// DocumentHash returns the stored form of a digest of a document computed
+// with algorithm, checking its length
+func DocumentHash(algorithm string, digest []byte) ([]byte, error){
+	alg, ok := hashAlgorithms[algorithm]
+	if !ok{
+		return nil, fmt.Errorf("%w: unknown algorithm %q, expected one of %s", ErrInvalidHash, algorithm, strings.Join(HashAlgorithms(), ", "))
+	}
+	if len(digest) != alg.size{
+		return nil, fmt.Errorf("%w: %s digests are %d bytes, got %d", ErrInvalidHash, algorithm, alg.size, len(digest))
+	}
+	if algorithm == HashSHA256{
+		return bytes.Clone(digest), nil
+	}
+	return multihash.Encode(digest, alg.code)
+}
+
+// ParseDocumentHash returns the algorithm and digest of a stored hash
+func ParseDocumentHash(stored []byte) (string, []byte, error){
+	if len(stored) == sha256.Size{
+		return HashSHA256, stored, nil
+	}
+	decoded, err := multihash.Decode(stored)
+	if err != nil{
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	for name, alg := range hashAlgorithms{
+		// SHA-256 multihashes are not stored, their raw digest is
+		if alg.code == decoded.Code && name != HashSHA256{
+			if decoded.Length != alg.size{
+				return "", nil, fmt.Errorf("%w: %s digests are %d bytes, got %d", ErrInvalidHash, name, alg.size, decoded.Length)
+			}
+			return name, decoded.Digest, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: unsupported multihash code 0x%x", ErrInvalidHash, decoded.Code)
+}
+
+// CheckHash checks that the hash of a document is a digest of a supported
+// algorithm, in its stored form
+func (bd *BlockData) CheckHash() error{
+	_, _, err := ParseDocumentHash(bd.Hash)
+	return err
+}
+
+// NewDocumentHasher returns a hash computing digests of a document with
+// algorithm
+func NewDocumentHasher(algorithm string) (hash.Hash, error){
+	alg, ok := hashAlgorithms[algorithm]
+	if !ok{
+		return nil, fmt.Errorf("%w: unknown algorithm %q, expected one of %s", ErrInvalidHash, algorithm, strings.Join(HashAlgorithms(), ", "))
+	}
+	return mhcore.GetHasher(alg.code)
+}
+
+// ParseHashString decodes a document hash as written in the API: the hex
+// encoded digest, prefixed with its algorithm and a colon unless it is
+// SHA-256
+func ParseHashString(encoded string) ([]byte, error){
+	algorithm, digestHex, found := strings.Cut(encoded, ":")
+	if !found{
+		algorithm, digestHex = HashSHA256, encoded
+	}
+	digest, err := hex.DecodeString(digestHex)
+	if err != nil{
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	return DocumentHash(strings.ToLower(algorithm), digest)
+}
+
+// FormatHash encodes a stored document hash as written in the API. Hashes
+// that do not parse are written as hex.
+func FormatHash(stored []byte) string{
+	algorithm, digest, err := ParseDocumentHash(stored)
+	if err != nil || algorithm == HashSHA256{
+		return hex.EncodeToString(stored)
+	}
+	return algorithm + ":" + hex.EncodeToString(digest)
+}
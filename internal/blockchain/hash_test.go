@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+)
+
+func TestHashRoundTrip(t *testing.T){
+	for _, algorithm := range HashAlgorithms(){
+		hasher, err := NewDocumentHasher(algorithm)
+		if err != nil{
+			t.Fatal(err)
+		}
+		hasher.Write([]byte("deed.pdf"))
+		digest := hasher.Sum(nil)
+
+		stored, err := DocumentHash(algorithm, digest)
+		if err != nil{
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		name, parsed, err := ParseDocumentHash(stored)
+		if err != nil || name != algorithm || !bytes.Equal(parsed, digest){
+			t.Fatalf("%s: parsed %s %x (%v)", algorithm, name, parsed, err)
+		}
+
+		encoded := FormatHash(stored)
+		if algorithm == HashSHA256{
+			if encoded != hex.EncodeToString(digest){
+				t.Fatalf("sha256 formatted as %s", encoded)
+			}
+		} else if encoded != algorithm+":"+hex.EncodeToString(digest){
+			t.Fatalf("%s formatted as %s", algorithm, encoded)
+		}
+		decoded, err := ParseHashString(encoded)
+		if err != nil || !bytes.Equal(decoded, stored){
+			t.Fatalf("%s: %s decoded as %x (%v)", algorithm, encoded, decoded, err)
+		}
+	}
+}
+
+func TestSHA256StoredRaw(t *testing.T){
+	digest := bytes.Repeat([]byte{0xab}, 32)
+	for _, encoded := range []string{hex.EncodeToString(digest), "sha256:" + hex.EncodeToString(digest)}{
+		stored, err := ParseHashString(encoded)
+		if err != nil || !bytes.Equal(stored, digest){
+			t.Fatalf("%s stored as %x (%v)", encoded, stored, err)
+		}
+	}
+
+	// any 32 bytes are a SHA-256 digest, even those that decode as a multihash
+	sha3, err := multihash.Encode(make([]byte, 30), multihash.SHA3_256)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if name, _, err := ParseDocumentHash(sha3); err != nil || name != HashSHA256{
+		t.Fatalf("32 byte multihash parsed as %s (%v)", name, err)
+	}
+
+	mh, err := multihash.Encode(digest, multihash.SHA2_256)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, _, err := ParseDocumentHash(mh); !errors.Is(err, ErrInvalidHash){
+		t.Fatalf("SHA-256 multihash accepted: %v", err)
+	}
+}
+
+func TestUppercasePrefix(t *testing.T){
+	digest := bytes.Repeat([]byte{0xcd}, 64)
+	stored, err := ParseHashString("SHA512:" + strings.ToUpper(hex.EncodeToString(digest)))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if encoded := FormatHash(stored); encoded != "sha512:"+hex.EncodeToString(digest){
+		t.Fatalf("upper case hash formatted as %s", encoded)
+	}
+}
+
+func TestInvalidHashes(t *testing.T){
+	short, err := multihash.Encode(make([]byte, 20), multihash.SHA2_512)
+	if err != nil{
+		t.Fatal(err)
+	}
+	unsupported, err := multihash.Encode(make([]byte, 20), multihash.SHA1)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	for name, stored := range map[string][]byte{
+		"empty": nil,
+		"31 bytes": make([]byte, 31),
+		"sha512 multihash of 20 bytes": short,
+		"sha1 multihash": unsupported,
+	}{
+		if _, _, err := ParseDocumentHash(stored); !errors.Is(err, ErrInvalidHash){
+			t.Errorf("ParseDocumentHash accepted %s: %v", name, err)
+		}
+	}
+
+	for _, encoded := range []string{
+		"",
+		strings.Repeat("ab", 31),
+		strings.Repeat("ab", 33),
+		"sha512:" + strings.Repeat("ab", 32),
+		"blake3:" + strings.Repeat("ab", 64),
+		"md5:" + strings.Repeat("ab", 16),
+		"sha1:" + strings.Repeat("ab", 20),
+		"sha256:" + strings.Repeat("zz", 32),
+		":" + strings.Repeat("ab", 32),
+	}{
+		if _, err := ParseHashString(encoded); !errors.Is(err, ErrInvalidHash){
+			t.Errorf("ParseHashString accepted %q: %v", encoded, err)
+		}
+	}
+
+	if _, err := DocumentHash("md5", make([]byte, 16)); !errors.Is(err, ErrInvalidHash){
+		t.Errorf("DocumentHash accepted md5: %v", err)
+	}
+	if _, err := NewDocumentHasher("md5"); !errors.Is(err, ErrInvalidHash){
+		t.Errorf("NewDocumentHasher accepted md5: %v", err)
+	}
+	if encoded := FormatHash(unsupported); encoded != hex.EncodeToString(unsupported){
+		t.Errorf("unsupported hash formatted as %s", encoded)
+	}
+}
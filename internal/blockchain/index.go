@@ -0,0 +1,277 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const(
+	fileHashPrefix = "fh:"
+	heightPrefix = "h:"
+	indexVersionKey = "idx"
+	// indexVersion must be bumped whenever a new secondary index is added so
+	// that existing databases get rebuilt on startup
+	indexVersion = 7
+)
+
+// fileHashKey returns the badger key mapping a document hash to the hash of
+// the block that anchors it
+func fileHashKey(fileHash []byte) []byte{
+	return append([]byte(fileHashPrefix), fileHash...)
+}
+
+// heightKey returns the badger key mapping a main chain height to a block hash
+func heightKey(height uint64) []byte{
+	key := make([]byte, len(heightPrefix)+8)
+	copy(key, heightPrefix)
+	binary.BigEndian.PutUint64(key[len(heightPrefix):], height)
+	return key
+}
+
+// indexBlock writes the secondary index entries of block inside txn and
+// applies its registry and status transactions. A document keeps the block
+// that anchored it first.
+func indexBlock(txn *badger.Txn, block *Block) error{
+	if err := txn.Set(heightKey(block.Height), block.Hash); err != nil{
+		return err
+	}
+	if err := indexNotaries(txn, block); err != nil{
+		return err
+	}
+	for _, data := range block.Data{
+		if len(data.Hash) == 0{
+			continue
+		}
+		_, err := txn.Get(fileHashKey(data.Hash))
+		if err == nil{
+			continue
+		}
+		if err != badger.ErrKeyNotFound{
+			return err
+		}
+		if err := txn.Set(fileHashKey(data.Hash), block.Hash); err != nil{
+			return err
+		}
+	}
+	return indexStatuses(txn, block)
+}
+
+// checkAnchors refuses a block that anchors a document twice or anchors a
+// document already anchored on the main chain. Blocks of the first release
+// predate the rule, and indexBlock keeps the first anchor of their documents.
+func checkAnchors(txn *badger.Txn, block *Block) error{
+	if block.isFirstRelease(){
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, data := range block.Data{
+		if len(data.Hash) == 0{
+			continue
+		}
+		if seen[string(data.Hash)]{
+			return fmt.Errorf("%w: %x appears twice in the block", ErrDocumentAnchored, data.Hash)
+		}
+		seen[string(data.Hash)] = true
+
+		_, err := txn.Get(fileHashKey(data.Hash))
+		if err == nil{
+			return fmt.Errorf("%w: %x", ErrDocumentAnchored, data.Hash)
+		}
+		if err != badger.ErrKeyNotFound{
+			return err
+		}
+	}
+	return nil
+}
+
+func setIndexVersion(txn *badger.Txn) error{
+	return txn.Set([]byte(indexVersionKey), ToHex(indexVersion))
+}
+
+// rebuildIndex walks the chain from LastHash back to genesis and rewrites the
+// secondary indexes, the notary registry, the document statuses and the
+// cumulative work of every main chain block. It is
+// run on startup when the index is missing or was written by an older
+// version. Heights are assigned from the position in the chain so that
+// databases created before blocks carried a height are indexed correctly too.
+func (chain *BlockChain) rebuildIndex() error{
+	log.Println("Block index missing or outdated, rebuilding...")
+
+	hashes := [][]byte{}
+	iter := chain.Iterator()
+	for{
+		block, err := iter.Next()
+		if err != nil{
+			return err
+		}
+		hashes = append(hashes, block.Hash)
+		if len(block.PrevHash) == 0{
+			break
+		}
+	}
+
+	for _, prefix := range []string{fileHashPrefix, notaryPrefix, notaryTxPrefix, statusPrefix, replacementPrefix}{
+		if err := chain.Database.DropPrefix([]byte(prefix)); err != nil{
+			return err
+		}
+	}
+
+	wb := chain.Database.NewWriteBatch()
+	defer wb.Cancel()
+
+	work := new(big.Int)
+	notaries := map[string]*NotaryRecord{}
+	anchored := map[string]bool{}
+	for i := len(hashes) - 1; i >= 0; i--{
+		block, err := chain.GetBlockByHash(hashes[i])
+		if err != nil{
+			return err
+		}
+		height := uint64(len(hashes) - 1 - i)
+		work.Add(work, chain.engine.Work(block))
+
+		if err := wb.Set(heightKey(height), block.Hash); err != nil{
+			return err
+		}
+		if err := wb.Set(workKey(block.Hash), work.Bytes()); err != nil{
+			return err
+		}
+		for _, data := range block.Data{
+			if len(data.Hash) == 0 || anchored[string(data.Hash)]{
+				continue
+			}
+			anchored[string(data.Hash)] = true
+			if err := wb.Set(fileHashKey(data.Hash), block.Hash); err != nil{
+				return err
+			}
+		}
+		for j := range block.Notaries{
+			tx := &block.Notaries[j]
+			record, err := tx.apply(notaries[tx.NotaryID], height)
+			if err != nil{
+				return fmt.Errorf("block %x: %w", block.Hash, err)
+			}
+			notaries[tx.NotaryID] = record
+			val, err := encodeNotaryRecord(record)
+			if err != nil{
+				return err
+			}
+			if err := wb.Set(notaryKey(record.NotaryID, height), val); err != nil{
+				return err
+			}
+			if err := wb.Set(notaryTxKey(record.TxHash), block.Hash); err != nil{
+				return err
+			}
+		}
+	}
+
+	if err := wb.Set([]byte(indexVersionKey), ToHex(indexVersion)); err != nil{
+		return err
+	}
+	if err := wb.Flush(); err != nil{
+		return err
+	}
+
+	// status transactions are checked against the indexes written above, so
+	// they are applied once these are flushed
+	for i := len(hashes) - 1; i >= 0; i--{
+		block, err := chain.GetBlockByHash(hashes[i])
+		if err != nil{
+			return err
+		}
+		if len(block.Statuses) == 0{
+			continue
+		}
+		err = chain.Database.Update(func(txn *badger.Txn) error{
+			return indexStatuses(txn, block)
+		})
+		if err != nil{
+			return fmt.Errorf("block %x: %w", block.Hash, err)
+		}
+	}
+
+	chain.height = uint64(len(hashes) - 1)
+	log.Printf("Indexed %d blocks", len(hashes))
+	return nil
+}
+
+func (chain *BlockChain) hasIndex() (bool, error){
+	var version int64
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		item, err := txn.Get([]byte(indexVersionKey))
+		if err != nil{
+			return err
+		}
+		return item.Value(func(val []byte) error{
+			if len(val) == 8{
+				version = int64(binary.BigEndian.Uint64(val))
+			}
+			return nil
+		})
+	})
+	if err == badger.ErrKeyNotFound{
+		return false, nil
+	}
+	if err != nil{
+		return false, err
+	}
+	return version >= indexVersion, nil
+}
+
+func (chain *BlockChain) getIndexed(key []byte) ([]byte, error){
+	var value []byte
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		item, err := txn.Get(key)
+		if err != nil{
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound{
+		return nil, ErrBlockNotFound
+	}
+	if err != nil{
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// GetBlockHashByFileHash returns the hash of the block anchoring the document
+// with the given hash, or ErrBlockNotFound if the document is not in the chain
+func (chain *BlockChain) GetBlockHashByFileHash(fileHash []byte) ([]byte, error){
+	return chain.getIndexed(fileHashKey(fileHash))
+}
+
+// GetBlockByFileHash returns the block anchoring the document with the given
+// hash, or ErrBlockNotFound if the document is not in the chain
+func (chain *BlockChain) GetBlockByFileHash(fileHash []byte) (*Block, error){
+	blockHash, err := chain.GetBlockHashByFileHash(fileHash)
+	if err != nil{
+		return nil, err
+	}
+	return chain.GetBlockByHash(blockHash)
+}
+
+// GetBlockHashByHeight returns the hash of the main chain block at the given
+// height, or ErrBlockNotFound if the chain is shorter than that
+func (chain *BlockChain) GetBlockHashByHeight(height uint64) ([]byte, error){
+	return chain.getIndexed(heightKey(height))
+}
+
+// GetBlockByHeight returns the main chain block at the given height, or
+// ErrBlockNotFound if the chain is shorter than that
+func (chain *BlockChain) GetBlockByHeight(height uint64) (*Block, error){
+	blockHash, err := chain.GetBlockHashByHeight(height)
+	if err != nil{
+		return nil, err
+	}
+	return chain.GetBlockByHash(blockHash)
+}
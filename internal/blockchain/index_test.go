@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func devChain(t *testing.T) *BlockChain{
+	t.Helper()
+	params, err := NetworkParams("dev")
+	if err != nil{
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(params, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	chain, err := openBlockChain(t.TempDir(), params, engine)
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ chain.Database.Close() })
+	return chain
+}
+
+func document(t *testing.T, name string) BlockData{
+	t.Helper()
+	notary := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	return signedDocument(t, notary, "21122ee1-a5bc-4fcc-bead-065acfc38edf", name)
+}
+
+func TestReanchoringRefused(t *testing.T){
+	chain := devChain(t)
+	ctx := context.Background()
+	first, err := chain.CreateInsertBlock(ctx, []BlockData{document(t, "deed.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	again, err := chain.CreateBlock(ctx, []BlockData{document(t, "deed.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.CheckBlock(again); !errors.Is(err, ErrDocumentAnchored){
+		t.Fatalf("CheckBlock of an anchored document: %v", err)
+	}
+	if err := chain.InsertBlock(again); !errors.Is(err, ErrDocumentAnchored){
+		t.Fatalf("AcceptBlock of an anchored document: %v", err)
+	}
+
+	twice, err := chain.CreateBlock(ctx, []BlockData{document(t, "will.pdf"), document(t, "will.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.InsertBlock(twice); !errors.Is(err, ErrDocumentAnchored){
+		t.Fatalf("AcceptBlock of a document anchored twice in a block: %v", err)
+	}
+
+	anchor, err := chain.GetBlockHashByFileHash(document(t, "deed.pdf").Hash)
+	if err != nil || !bytes.Equal(anchor, first.Hash){
+		t.Fatalf("deed.pdf anchored by %x (%v), want %x", anchor, err, first.Hash)
+	}
+}
+
+// Blocks stored before re-anchoring was refused may anchor a document again.
+// The first anchor is kept when indexing, unindexing and rebuilding.
+func TestFirstAnchorKept(t *testing.T){
+	chain := devChain(t)
+	ctx := context.Background()
+	first, err := chain.CreateInsertBlock(ctx, []BlockData{document(t, "deed.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	again, err := chain.CreateBlock(ctx, []BlockData{document(t, "deed.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	serialized, err := again.Serialize()
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	anchored := func(when string){
+		t.Helper()
+		anchor, err := chain.GetBlockHashByFileHash(document(t, "deed.pdf").Hash)
+		if err != nil || !bytes.Equal(anchor, first.Hash){
+			t.Fatalf("%s: deed.pdf anchored by %x (%v), want %x", when, anchor, err, first.Hash)
+		}
+	}
+
+	err = chain.Database.Update(func(txn *badger.Txn) error{
+		if err := txn.Set(again.Hash, serialized); err != nil{
+			return err
+		}
+		if err := indexBlock(txn, again); err != nil{
+			return err
+		}
+		return txn.Set([]byte("lh"), again.Hash)
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	chain.LastHash = again.Hash
+	anchored("after indexing")
+
+	if err := chain.rebuildIndex(); err != nil{
+		t.Fatal(err)
+	}
+	anchored("after rebuilding")
+
+	err = chain.Database.Update(func(txn *badger.Txn) error{
+		return unindexBlock(txn, again)
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	anchored("after unindexing")
+}
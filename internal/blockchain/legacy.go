@@ -0,0 +1,467 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Blocks of schema version 0 were stored as gob and their merkle leaves and
+// hashes were computed over the encodings below. Their proof-of-work and
+// signatures cover those bytes, so they cannot be re-encoded; nodes only
+// need these functions to verify the blocks of migrated databases.
+//
+// The first release of the service stored blocks of a single entry, without
+// a height or merkle root, and mined them over the gob encoding of that entry
+// at a fixed difficulty. They are kept as version 0 blocks with one entry and
+// no merkle root, see isFirstRelease.
+
+const(
+	// storageVersionKey holds the schema version of the stored blocks. It is
+	// missing from databases written before the canonical encoding.
+	storageVersionKey = "sv"
+	// blockHashLen is the length of the keys blocks are stored under
+	blockHashLen = sha256.Size
+	// firstReleaseDifficulty is the difficulty every block of the first
+	// release was mined at
+	firstReleaseDifficulty = 12
+)
+
+// Gob type ids of the encodings below. A gob stream names the type of its
+// values with an id that the encoding process hands out in the order it
+// first meets its types, from 64 on; BlockData was the first type nodes
+// encoded, so its id was always 64. The ids are pinned here rather than left
+// to the gob package of this process.
+const(
+	gobBytesID = 5
+	gobStringID = 6
+	gobDataID = 64
+)
+
+// gobField is a field of a gob struct type, with the id of its type
+type gobField struct{
+	name string
+	typeID int64
+}
+
+// legacyDataFields are the fields of BlockData when the canonical encoding
+// was introduced, and firstReleaseDataFields those of the first release
+var(
+	legacyDataFields = []gobField{
+		{"Hash", gobBytesID},
+		{"DocumentID", gobStringID},
+		{"NotaryID", gobStringID},
+		{"UserID", gobStringID},
+		{"CNPJ", gobStringID},
+		{"PublicKey", gobBytesID},
+		{"Signature", gobBytesID},
+	}
+	firstReleaseDataFields = legacyDataFields[:5]
+)
+
+func gobUint(buf []byte, x uint64) []byte{
+	if x < 0x80{
+		return append(buf, byte(x))
+	}
+	var be [8]byte
+	binary.BigEndian.PutUint64(be[:], x)
+	n := 8
+	for be[8-n] == 0{
+		n--
+	}
+	buf = append(buf, byte(-n))
+	return append(buf, be[8-n:]...)
+}
+
+func gobInt(buf []byte, x int64) []byte{
+	if x < 0{
+		return gobUint(buf, uint64(^x)<<1|1)
+	}
+	return gobUint(buf, uint64(x)<<1)
+}
+
+func gobMessage(buf []byte, content []byte) []byte{
+	buf = gobUint(buf, uint64(len(content)))
+	return append(buf, content...)
+}
+
+// gobStruct is the gob stream of a single struct value whose fields are all
+// byte slices or strings: the definition of its type followed by the value,
+// in which fields holding their zero value are left out
+func gobStruct(name string, fields []gobField, values [][]byte) []byte{
+	def := gobInt(nil, -gobDataID)
+	// wireType.StructT, structType.CommonType, CommonType.Name
+	def = append(def, 3, 1, 1)
+	def = gobUint(def, uint64(len(name)))
+	def = append(def, name...)
+	// CommonType.Id, then the end of CommonType and structType.Field
+	def = append(def, 1)
+	def = gobInt(def, gobDataID)
+	def = append(def, 0, 1)
+	def = gobUint(def, uint64(len(fields)))
+	for _, field := range fields{
+		// fieldType.Name and fieldType.Id
+		def = append(def, 1)
+		def = gobUint(def, uint64(len(field.name)))
+		def = append(def, field.name...)
+		def = append(def, 1)
+		def = gobInt(def, field.typeID)
+		def = append(def, 0)
+	}
+	// end of structType and wireType
+	def = append(def, 0, 0)
+
+	value := gobInt(nil, gobDataID)
+	last := -1
+	for i, field := range values{
+		if len(field) == 0{
+			continue
+		}
+		value = gobUint(value, uint64(i-last))
+		value = gobUint(value, uint64(len(field)))
+		value = append(value, field...)
+		last = i
+	}
+	value = append(value, 0)
+
+	return gobMessage(gobMessage(nil, def), value)
+}
+
+// legacyDataBytes is the gob encoding of an entry
+func legacyDataBytes(bd *BlockData) []byte{
+	return gobStruct("BlockData", legacyDataFields, [][]byte{
+		bd.Hash,
+		[]byte(bd.DocumentID),
+		[]byte(bd.NotaryID),
+		[]byte(bd.UserID),
+		[]byte(bd.CNPJ),
+		bd.PublicKey,
+		bd.Signature,
+	})
+}
+
+// firstReleaseDataBytes is the gob encoding of an entry of the first
+// release, which had no key or signature
+func firstReleaseDataBytes(bd *BlockData) []byte{
+	return gobStruct("BlockData", firstReleaseDataFields, [][]byte{
+		bd.Hash,
+		[]byte(bd.DocumentID),
+		[]byte(bd.NotaryID),
+		[]byte(bd.UserID),
+		[]byte(bd.CNPJ),
+	})
+}
+
+// legacyNotaryBytes is the signing bytes of a registry transaction followed
+// by the admin key and the signature, each length prefixed
+func legacyNotaryBytes(tx *NotaryTx) []byte{
+	buf := bytes.NewBuffer(tx.SigningBytes())
+	for _, field := range [][]byte{tx.Admin, tx.Signature}{
+		binary.Write(buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+// legacyStatusBytes is the signing bytes of a status transaction followed by
+// the public key and the signature, each length prefixed
+func legacyStatusBytes(tx *StatusTx) []byte{
+	buf := bytes.NewBuffer(tx.SigningBytes())
+	for _, field := range [][]byte{tx.PublicKey, tx.Signature}{
+		binary.Write(buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+// legacyPowData is the proof-of-work input of a version 0 block
+func legacyPowData(block *Block, nonce int) []byte{
+	before, after := legacyPowParts(block)
+	return bytes.Join([][]byte{before, ToHex(int64(nonce)), after}, []byte{})
+}
+
+// legacyPowParts returns the bytes of legacyPowData before and after the 8
+// byte nonce
+func legacyPowParts(block *Block) ([]byte, []byte){
+	after := ToHex(int64(block.Difficulty))
+	if block.isFirstRelease(){
+		return bytes.Join([][]byte{block.PrevHash, firstReleaseDataBytes(&block.Data[0])}, []byte{}), after
+	}
+	return bytes.Join(
+		[][]byte{
+			block.PrevHash,
+			block.MerkleRoot,
+			ToHex(int64(block.Height)),
+			ToHex(block.Timestamp),
+		},
+		[]byte{},
+	), after
+}
+
+// legacyHeaderHash is the hash of a version 0 block under the signature
+// based engines
+func legacyHeaderHash(block *Block) []byte{
+	data := bytes.Join(
+		[][]byte{
+			block.PrevHash,
+			block.MerkleRoot,
+			ToHex(int64(block.Height)),
+			ToHex(block.Timestamp),
+			ToHex(int64(block.Difficulty)),
+			block.Signer,
+		},
+		[]byte{},
+	)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// isFirstRelease reports whether the block was mined by the first release:
+// a version 0 block of a single entry and nothing else, without a merkle
+// root. The proof-of-work of these blocks covers their entry directly; their
+// timestamp is not covered at all.
+func (b *Block) isFirstRelease() bool{
+	return b.Version == 0 && len(b.MerkleRoot) == 0 && len(b.Data) == 1 &&
+		len(b.Notaries) == 0 && len(b.Statuses) == 0 && len(b.Signer) == 0
+}
+
+// firstReleaseGenesis is the genesis block of the first release. Its nonce
+// was the first one meeting the target, counting from 0, so every node of
+// that release derived the same block.
+var firstReleaseGenesis = sync.OnceValue(func() *Block{
+	genesis := newBlock(0, []BlockData{{DocumentID: "Genesis", NotaryID: "Genesis", UserID: "Genesis", CNPJ: "Genesis"}}, nil, nil, []byte{}, 0, 0)
+	genesis.MerkleRoot = nil
+	genesis.Difficulty = firstReleaseDifficulty
+	pow := NewProof(genesis)
+	for !pow.Validate(){
+		genesis.Nonce++
+	}
+	genesis.Hash = pow.ComputeHash()
+	return genesis
+})
+
+// legacyDeserialize decodes a block stored as gob
+func legacyDeserialize(data []byte) (*Block, error){
+	var block Block
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block); err != nil{
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	return &block, nil
+}
+
+// firstReleaseBlock is a block as the first release stored it
+type firstReleaseBlock struct{
+	Hash []byte
+	PrevHash []byte
+	Nonce int
+	Timestamp int64
+	Data BlockData
+}
+
+// firstReleaseDeserialize decodes a block stored by the first release into a
+// version 0 block without its height, which the release did not store
+func firstReleaseDeserialize(data []byte) (*Block, error){
+	var stored firstReleaseBlock
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&stored); err != nil{
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	block := newBlock(0, []BlockData{stored.Data}, nil, nil, stored.PrevHash, 0, stored.Timestamp)
+	block.MerkleRoot = nil
+	block.Hash = stored.Hash
+	block.Nonce = stored.Nonce
+	block.Difficulty = firstReleaseDifficulty
+	if !bytes.Equal(NewProof(block).ComputeHash(), block.Hash){
+		return nil, fmt.Errorf("%w: hash does not match the contents of a first release block", ErrCorruptBlock)
+	}
+	return block, nil
+}
+
+// storageVersion returns the schema version of the stored blocks
+func storageVersion(db *badger.DB) (uint64, error){
+	var version uint64
+	err := db.View(func(txn *badger.Txn) error{
+		item, err := txn.Get([]byte(storageVersionKey))
+		if errors.Is(err, badger.ErrKeyNotFound){
+			return nil
+		}
+		if err != nil{
+			return err
+		}
+		return item.Value(func(val []byte) error{
+			if len(val) != 8{
+				return fmt.Errorf("%w: storage version of %d bytes", ErrCorruptBlock, len(val))
+			}
+			version = binary.BigEndian.Uint64(val)
+			return nil
+		})
+	})
+	return version, err
+}
+
+func setStorageVersion(txn *badger.Txn) error{
+	return txn.Set([]byte(storageVersionKey), ToHex(SchemaVersion))
+}
+
+// indexKeyPrefixes are the prefixes of the keys that do not hold blocks. An
+// index key may be as long as a block hash.
+var indexKeyPrefixes = [][]byte{
+	[]byte(fileHashPrefix),
+	[]byte(heightPrefix),
+	[]byte(workPrefix),
+	[]byte(notaryPrefix),
+	[]byte(notaryTxPrefix),
+	[]byte(statusPrefix),
+	[]byte(replacementPrefix),
+}
+
+func isIndexKey(key []byte) bool{
+	for _, prefix := range indexKeyPrefixes{
+		if bytes.HasPrefix(key, prefix){
+			return true
+		}
+	}
+	return false
+}
+
+// migrateStorage rewrites the blocks of a database written before the
+// canonical encoding from gob to the canonical encoding, keeping their
+// schema version 0. Blocks are stored under their hash, so a value is taken
+// for a block when it decodes to a block with that hash. Blocks of the first
+// release are given the height of their position in the chain. A migration
+// that was interrupted is resumed: blocks already rewritten are recognised
+// and left alone. The database is only marked as migrated once every block
+// was decoded.
+func migrateStorage(db *badger.DB) error{
+	version, err := storageVersion(db)
+	if err != nil{
+		return err
+	}
+	if version > SchemaVersion{
+		return fmt.Errorf("blocks are stored with schema version %d, this node supports up to %d", version, SchemaVersion)
+	}
+	if version == SchemaVersion{
+		return nil
+	}
+	empty := false
+	err = db.View(func(txn *badger.Txn) error{
+		_, err := txn.Get([]byte("lh"))
+		if errors.Is(err, badger.ErrKeyNotFound){
+			empty = true
+			return nil
+		}
+		return err
+	})
+	if err != nil || empty{
+		return err
+	}
+
+	log.Println("Migrating stored blocks to the canonical encoding...")
+
+	blocks := map[string]*Block{}
+	firstRelease := map[string]*Block{}
+	undecodable := [][]byte{}
+	err = db.View(func(txn *badger.Txn) error{
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next(){
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if len(key) != blockHashLen{
+				continue
+			}
+			val, err := item.ValueCopy(nil)
+			if err != nil{
+				return err
+			}
+			if block, err := Deserialize(val); err == nil && bytes.Equal(block.Hash, key){
+				continue
+			}
+			if block, err := legacyDeserialize(val); err == nil && bytes.Equal(block.Hash, key){
+				blocks[string(key)] = block
+				continue
+			}
+			if block, err := firstReleaseDeserialize(val); err == nil && bytes.Equal(block.Hash, key){
+				firstRelease[string(key)] = block
+				continue
+			}
+			if !isIndexKey(key){
+				undecodable = append(undecodable, key)
+			}
+		}
+		return nil
+	})
+	if err != nil{
+		return err
+	}
+
+	if err := setFirstReleaseHeights(firstRelease); err != nil{
+		return err
+	}
+	for key, block := range firstRelease{
+		blocks[key] = block
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for key, block := range blocks{
+		serialized, err := block.Serialize()
+		if err != nil{
+			return err
+		}
+		if err := wb.Set([]byte(key), serialized); err != nil{
+			return err
+		}
+	}
+	if len(undecodable) == 0{
+		if err := wb.Set([]byte(storageVersionKey), ToHex(SchemaVersion)); err != nil{
+			return err
+		}
+	}
+	if err := wb.Flush(); err != nil{
+		return err
+	}
+
+	log.Printf("Migrated %d blocks", len(blocks))
+	if len(undecodable) > 0{
+		return fmt.Errorf("%w: %d stored blocks cannot be decoded, the first one under %x", ErrCorruptBlock, len(undecodable), undecodable[0])
+	}
+	return nil
+}
+
+// setFirstReleaseHeights sets the height of blocks of the first release by
+// walking their parents back to the genesis block
+func setFirstReleaseHeights(blocks map[string]*Block) error{
+	known := map[string]bool{}
+	for key, block := range blocks{
+		path := []*Block{}
+		for !known[key] && len(block.PrevHash) > 0{
+			path = append(path, block)
+			parent, ok := blocks[string(block.PrevHash)]
+			if !ok{
+				return fmt.Errorf("%w: parent %x of first release block %x is missing", ErrCorruptBlock, block.PrevHash, block.Hash)
+			}
+			if len(path) > len(blocks){
+				return fmt.Errorf("%w: first release block %x is its own ancestor", ErrCorruptBlock, block.Hash)
+			}
+			key, block = string(block.PrevHash), parent
+		}
+		known[key] = true
+
+		height := block.Height
+		for i := len(path) - 1; i >= 0; i--{
+			height++
+			path[i].Height = height
+			known[string(path[i].Hash)] = true
+		}
+	}
+	return nil
+}
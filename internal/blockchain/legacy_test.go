@@ -0,0 +1,207 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// testdata/first_release.json holds every key and value of a database
+// written by the first release, hex encoded: a genesis block and blocks
+// anchoring the documents below.
+var firstReleaseDocuments = []string{"contract.pdf", "deed.pdf", "will.pdf"}
+
+func openTestDB(t *testing.T, dir string) *badger.DB{
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil{
+		t.Fatal(err)
+	}
+	return db
+}
+
+// firstReleaseDB writes the fixture database into a new directory, along with
+// extra keys and values
+func firstReleaseDB(t *testing.T, extra map[string][]byte) string{
+	t.Helper()
+	data, err := os.ReadFile("testdata/first_release.json")
+	if err != nil{
+		t.Fatal(err)
+	}
+	var pairs [][2]string
+	if err := json.Unmarshal(data, &pairs); err != nil{
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	defer db.Close()
+	err = db.Update(func(txn *badger.Txn) error{
+		for _, pair := range pairs{
+			key, _ := hex.DecodeString(pair[0])
+			val, _ := hex.DecodeString(pair[1])
+			if err := txn.Set(key, val); err != nil{
+				return err
+			}
+		}
+		for key, val := range extra{
+			if err := txn.Set([]byte(key), val); err != nil{
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func openMain(t *testing.T, dir string) (*BlockChain, error){
+	t.Helper()
+	params, err := NetworkParams("main")
+	if err != nil{
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(params, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return openBlockChain(dir, params, engine)
+}
+
+func TestMigrateFirstRelease(t *testing.T){
+	chain, err := openMain(t, firstReleaseDB(t, nil))
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer chain.Database.Close()
+
+	if _, height := chain.Tip(); height != uint64(len(firstReleaseDocuments)){
+		t.Fatalf("tip at height %d, expected %d", height, len(firstReleaseDocuments))
+	}
+	genesis, err := chain.GetBlockByHeight(0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !bytes.Equal(genesis.Hash, firstReleaseGenesis().Hash){
+		t.Fatalf("genesis %x, expected the first release genesis %x", genesis.Hash, firstReleaseGenesis().Hash)
+	}
+	for i, name := range firstReleaseDocuments{
+		hash := sha256.Sum256([]byte(name))
+		block, err := chain.GetBlockByFileHash(hash[:])
+		if err != nil{
+			t.Fatalf("%s: %v", name, err)
+		}
+		if block.Height != uint64(i+1) || block.Data[0].DocumentID != "mom-"+name{
+			t.Fatalf("%s: anchored at height %d as %q", name, block.Height, block.Data[0].DocumentID)
+		}
+	}
+
+	version, err := storageVersion(chain.Database)
+	if err != nil || version != SchemaVersion{
+		t.Fatalf("storage version %d (%v), expected %d", version, err, SchemaVersion)
+	}
+	report, err := chain.Verify()
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !report.Valid{
+		t.Fatalf("migrated chain does not verify: %+v", report.Issues)
+	}
+
+	// new blocks follow the migrated ones
+	_, key, _ := ed25519.GenerateKey(nil)
+	hash := sha256.Sum256([]byte("new.pdf"))
+	data := BlockData{Hash: hash[:], DocumentID: "mom-new.pdf", NotaryID: "notary-1", UserID: "user-1", CNPJ: "58.474.125/0001-33"}
+	if err := data.Sign(key); err != nil{
+		t.Fatal(err)
+	}
+	block, err := chain.CreateInsertBlock(context.Background(), []BlockData{data}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if block.Version != SchemaVersion || block.Height != uint64(len(firstReleaseDocuments)+1){
+		t.Fatalf("new block of version %d at height %d", block.Version, block.Height)
+	}
+}
+
+func TestMigrateUndecodableBlock(t *testing.T){
+	garbage := bytes.Repeat([]byte{0xab}, blockHashLen)
+	dir := firstReleaseDB(t, map[string][]byte{string(garbage): []byte("not a block")})
+
+	_, err := openMain(t, dir)
+	if !errors.Is(err, ErrCorruptBlock){
+		t.Fatalf("opened a database with an undecodable block: %v", err)
+	}
+
+	db := openTestDB(t, dir)
+	defer db.Close()
+	if version, err := storageVersion(db); err != nil || version != 0{
+		t.Fatalf("storage version %d (%v) after a failed migration", version, err)
+	}
+}
+
+func TestFirstReleaseBlockAfterNewerBlock(t *testing.T){
+	genesis := firstReleaseGenesis()
+	if !genesis.isFirstRelease(){
+		t.Fatal("first release genesis is not recognised")
+	}
+	child := *genesis
+	child.PrevHash = genesis.Hash
+	if err := checkVersion(genesis, &child); err != nil{
+		t.Fatalf("first release block refused after its genesis: %v", err)
+	}
+
+	params, _ := NetworkParams("main")
+	engine, _ := NewEngine(params, nil)
+	newer, err := Genesis(params, engine)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := checkVersion(newer, &child); !errors.Is(err, ErrInvalidVersion){
+		t.Fatalf("first release block accepted after a newer block: %v", err)
+	}
+}
+
+func TestLegacyDataBytes(t *testing.T){
+	data := BlockData{
+		Hash: []byte{1, 2},
+		DocumentID: "ab",
+		CNPJ: "c",
+		Signature: []byte{9},
+	}
+	// as encoded by encoding/gob in a process that encoded BlockData first
+	golden := "6b7f03010109426c6f636b4461746101ff80000107010448617368010a00010a446f63756d656e744944010c0001084e6f746172794944010c000106557365724944010c000104434e504a010c0001095075626c69634b6579010a0001095369676e6174757265010a00000011ff80010201020102616203016302010900"
+	encoded := legacyDataBytes(&data)
+	if hex.EncodeToString(encoded) != golden{
+		t.Fatalf("legacy encoding %x, expected %s", encoded, golden)
+	}
+
+	// gob itself must read the bytes back, whatever ids this process uses
+	var decoded BlockData
+	if err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(&decoded); err != nil{
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Serialize(), data.Serialize()){
+		t.Fatalf("decoded %+v, expected %+v", decoded, data)
+	}
+
+	long := BlockData{DocumentID: string(bytes.Repeat([]byte{'x'}, 300))}
+	var decodedLong BlockData
+	if err := gob.NewDecoder(bytes.NewReader(legacyDataBytes(&long))).Decode(&decodedLong); err != nil{
+		t.Fatal(err)
+	}
+	if decodedLong.DocumentID != long.DocumentID{
+		t.Fatal("long field does not round trip")
+	}
+}
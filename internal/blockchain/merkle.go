@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// Leaves and inner nodes are hashed with different prefixes so that an inner
+// node can never be passed off as a document (RFC 6962 style), and registry
+// and status transactions have leaf prefixes of their own. A node without a sibling is
+// promoted to the next level unchanged.
+const(
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+	merkleNotaryPrefix = 0x02
+	merkleStatusPrefix = 0x03
+)
+
+// MerkleStep is one level of an inclusion path: the sibling hash and whether
+// it sits on the left of the running hash
+type MerkleStep struct{
+	Hash []byte `json:"hash"`
+	Left bool `json:"left"`
+}
+
+// The leaves hash the canonical encoding of their entry, or its legacy
+// encoding in blocks of schema version 0
+func merkleLeaf(version uint32, data *BlockData) []byte{
+	encoded := data.Serialize()
+	if version == 0{
+		encoded = legacyDataBytes(data)
+	}
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, encoded...))
+	return hash[:]
+}
+
+func merkleNotaryLeaf(version uint32, tx *NotaryTx) []byte{
+	encoded := tx.Serialize()
+	if version == 0{
+		encoded = legacyNotaryBytes(tx)
+	}
+	hash := sha256.Sum256(append([]byte{merkleNotaryPrefix}, encoded...))
+	return hash[:]
+}
+
+func merkleStatusLeaf(version uint32, tx *StatusTx) []byte{
+	encoded := tx.Serialize()
+	if version == 0{
+		encoded = legacyStatusBytes(tx)
+	}
+	hash := sha256.Sum256(append([]byte{merkleStatusPrefix}, encoded...))
+	return hash[:]
+}
+
+func merkleNode(left []byte, right []byte) []byte{
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, merkleNodePrefix)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	hash := sha256.Sum256(buf)
+	return hash[:]
+}
+
+func merkleLevel(level [][]byte) [][]byte{
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2{
+		if i+1 == len(level){
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, merkleNode(level[i], level[i+1]))
+	}
+	return next
+}
+
+// merkleLeaves returns the leaves of the documents followed by the leaves of
+// the registry transactions and of the status transactions, so that blocks
+// without transactions keep the root of their documents
+func merkleLeaves(version uint32, data []BlockData, notaries []NotaryTx, statuses []StatusTx) [][]byte{
+	leaves := make([][]byte, 0, len(data)+len(notaries)+len(statuses))
+	for i := range data{
+		leaves = append(leaves, merkleLeaf(version, &data[i]))
+	}
+	for i := range notaries{
+		leaves = append(leaves, merkleNotaryLeaf(version, &notaries[i]))
+	}
+	for i := range statuses{
+		leaves = append(leaves, merkleStatusLeaf(version, &statuses[i]))
+	}
+	return leaves
+}
+
+// MerkleRoot returns the root of the Merkle tree over the block data entries,
+// then the registry transactions and then the status transactions, in order,
+// for a block of the given schema version. An empty block has an empty root.
+func MerkleRoot(version uint32, data []BlockData, notaries []NotaryTx, statuses []StatusTx) []byte{
+	if len(data) == 0 && len(notaries) == 0 && len(statuses) == 0{
+		return []byte{}
+	}
+
+	level := merkleLeaves(version, data, notaries, statuses)
+	for len(level) > 1{
+		level = merkleLevel(level)
+	}
+	return level[0]
+}
+
+// MerkleProof returns the inclusion path of the data entry at index, from the
+// leaf up to the root
+func MerkleProof(version uint32, data []BlockData, notaries []NotaryTx, statuses []StatusTx, index int) []MerkleStep{
+	proof := []MerkleStep{}
+	level := merkleLeaves(version, data, notaries, statuses)
+
+	for len(level) > 1{
+		sibling := index ^ 1
+		if sibling < len(level){
+			proof = append(proof, MerkleStep{level[sibling], sibling < index})
+		}
+		level = merkleLevel(level)
+		index /= 2
+	}
+	return proof
+}
+
+// VerifyMerkleProof checks that data is included under root following proof,
+// in a block of the given schema version
+func VerifyMerkleProof(version uint32, data *BlockData, proof []MerkleStep, root []byte) bool{
+	hash := merkleLeaf(version, data)
+	for _, step := range proof{
+		if step.Left{
+			hash = merkleNode(step.Hash, hash)
+		} else {
+			hash = merkleNode(hash, step.Hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
@@ -2,70 +2,236 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
-	"log"
+	"errors"
+	"fmt"
 	"math"
 	"math/big"
+	"runtime"
+	"sync"
+
+	"blockchain-service/internal/codec"
 )
 
-const Dificulty = 12
+// ctxCheckInterval is the number of hashes a mining worker computes between
+// checks for cancellation
+const ctxCheckInterval = 1 << 12
+
+// ErrNonceExhausted is returned by Run when no nonce meets the target
+var ErrNonceExhausted = errors.New("no nonce meets the target")
 
 type ProofOfWork struct{
 	Block *Block 
 	Target *big.Int
 }
 
-func (pow *ProofOfWork) Run() (int, []byte){
+// PowEngine seals blocks with proof-of-work at the difficulty given by the
+// retarget rule of its network
+type PowEngine struct{
+	params Params
+}
+
+func (e *PowEngine) CanSeal() bool{
+	return true
+}
+
+func (e *PowEngine) Prepare(reader HeaderReader, parent *Block, block *Block) error{
+	// a parent from a peer whose clock is ahead may be timestamped after now
+	block.Timestamp = max(block.Timestamp, parent.Timestamp)
+	difficulty, err := nextDifficulty(e.params, reader, parent)
+	if err != nil{
+		return err
+	}
+	block.Difficulty = difficulty
+	return nil
+}
+
+func (e *PowEngine) Seal(ctx context.Context, block *Block) error{
+	nonce, hash, err := NewProof(block).Run(ctx)
+	if err != nil{
+		return err
+	}
+	block.Hash = hash
+	block.Nonce = nonce
+	return nil
+}
+
+func (e *PowEngine) Hash(block *Block) []byte{
+	return NewProof(block).ComputeHash()
+}
+
+func (e *PowEngine) VerifySeal(block *Block) error{
+	pow := NewProof(block)
+	if !pow.Validate(){
+		return fmt.Errorf("%w: proof-of-work does not meet the target", ErrInvalidSeal)
+	}
+	if !bytes.Equal(pow.ComputeHash(), block.Hash){
+		return fmt.Errorf("%w: hash does not match the block contents", ErrInvalidSeal)
+	}
+	return nil
+}
+
+func (e *PowEngine) VerifyHeader(reader HeaderReader, parent *Block, block *Block) error{
+	if block.isFirstRelease(){
+		if block.Difficulty != firstReleaseDifficulty{
+			return fmt.Errorf("%w: difficulty %d, expected %d", ErrInvalidDifficulty, block.Difficulty, firstReleaseDifficulty)
+		}
+		return nil
+	}
+	if err := checkTimestamp(parent, block); err != nil{
+		return err
+	}
+	difficulty, err := nextDifficulty(e.params, reader, parent)
+	if err != nil{
+		return err
+	}
+	if block.Difficulty != difficulty{
+		return fmt.Errorf("%w: difficulty %d, expected %d", ErrInvalidDifficulty, block.Difficulty, difficulty)
+	}
+	return nil
+}
+
+func (e *PowEngine) Work(block *Block) *big.Int{
+	return NewProof(block).Work()
+}
+
+type powSolution struct{
+	nonce int
+	hash []byte
+}
+
+// Run searches for a nonce meeting the target with one worker per
+// GOMAXPROCS, worker i trying nonces i, i+workers, i+2*workers... It stops
+// all workers and returns ctx.Err() as soon as ctx is done. Workers hash
+// their own encoding of the header and Run returns once they all stopped,
+// so the block can be sealed right after.
+func (pow *ProofOfWork) Run(ctx context.Context) (int, []byte, error){
+	if pow.Target.Sign() == 0{
+		return 0, nil, ErrNonceExhausted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	workers := runtime.GOMAXPROCS(0)
+	found := make(chan powSolution, workers)
+	var wg sync.WaitGroup
+	defer func(){
+		cancel()
+		wg.Wait()
+	}()
+
+	for worker := 0; worker < workers; worker++{
+		wg.Add(1)
+		go func(start int, data func(int) []byte){
+			defer wg.Done()
+			pow.search(ctx, data, start, workers, found)
+		}(worker, pow.nonceData())
+	}
+	go func(){
+		wg.Wait()
+		close(found)
+	}()
+
+	select{
+	case solution, ok := <-found:
+		if !ok{
+			if err := ctx.Err(); err != nil{
+				return 0, nil, err
+			}
+			return 0, nil, ErrNonceExhausted
+		}
+		return solution.nonce, solution.hash, nil
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+func (pow *ProofOfWork) search(ctx context.Context, data func(int) []byte, start int, step int, found chan<- powSolution){
 	var intHash big.Int
-	var hash [32]byte 
 
-	nonce := 0
-	for nonce < math.MaxInt64{
-		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
+	for nonce, tries := start, 0; nonce <= math.MaxInt64-step; nonce, tries = nonce+step, tries+1{
+		if tries%ctxCheckInterval == 0 && ctx.Err() != nil{
+			return
+		}
 
-		log.Printf("\r%x", hash)
+		hash := sha256.Sum256(data(nonce))
 		intHash.SetBytes(hash[:])
-		
 		if intHash.Cmp(pow.Target) == -1{
-				break 
+			found <- powSolution{nonce, hash[:]}
+			return
 		}
-		nonce++
 	}
-
-	return nonce, hash[:]
 }
 
+// NewProof returns the proof-of-work of a block at its stored difficulty. A
+// difficulty out of range gets a zero target, which no hash meets.
 func NewProof(b *Block) *ProofOfWork{
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256 - Dificulty))
+	target := big.NewInt(0)
+	if b.Difficulty >= MinDifficulty && b.Difficulty <= MaxDifficulty{
+		target.Lsh(big.NewInt(1), uint(256 - b.Difficulty))
+	}
 
 	pow := &ProofOfWork{b, target}
 	return pow
 }
 
+// InitData returns the bytes hashed for a nonce: the header bytes of the
+// block with that nonce
 func (pow *ProofOfWork) InitData(nonce int) []byte{
-	data := bytes.Join(
-		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.Data.Serialize(),
-			ToHex(int64(nonce)),
-			ToHex(int64(Dificulty)),
-		},
-		[]byte{},
-	)
+	if pow.Block.Version == 0{
+		return legacyPowData(pow.Block, nonce)
+	}
+	header := *pow.Block
+	header.Nonce = nonce
+	return header.HeaderBytes()
+}
+
+// nonceData returns a function computing InitData for successive nonces. The
+// header is encoded once, when nonceData is called, and each call only
+// writes the nonce into the bytes it returned the previous time.
+func (pow *ProofOfWork) nonceData() func(int) []byte{
+	if pow.Block.Version == 0{
+		before, after := legacyPowParts(pow.Block)
+		data := bytes.Join([][]byte{before, make([]byte, 8), after}, []byte{})
+		return func(nonce int) []byte{
+			binary.BigEndian.PutUint64(data[len(before):], uint64(nonce))
+			return data
+		}
+	}
 
-	return data
+	var e, after codec.Encoder
+	pow.Block.headerBeforeNonce(&e)
+	pow.Block.headerAfterNonce(&after)
+	before := e.Len()
+	return func(nonce int) []byte{
+		e.Truncate(before)
+		e.Int(blockNonce, int64(nonce))
+		e.Append(after.Encoded())
+		return e.Encoded()
+	}
 }
 
 func ToHex(num int64) []byte{
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, num)
-	if err != nil{
-		log.Panic(err)
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, uint64(num))
+	return buff
+}
+
+// ComputeHash recomputes the block hash from its contents and stored nonce
+func (pow *ProofOfWork) ComputeHash() []byte{
+	hash := sha256.Sum256(pow.InitData(pow.Block.Nonce))
+	return hash[:]
+}
+
+// Work returns the expected number of hashes needed to meet the target. It
+// is summed along a branch to pick the heaviest chain.
+func (pow *ProofOfWork) Work() *big.Int{
+	if pow.Target.Sign() == 0{
+		return big.NewInt(0)
 	}
-	return buff.Bytes()
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, pow.Target)
 }
 
 func (pow *ProofOfWork) Validate() bool{
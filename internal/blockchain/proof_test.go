@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"runtime"
+	"testing"
+)
+
+func TestNonceDataMatchesInitData(t *testing.T){
+	current := NewBlock([]BlockData{{Hash: make([]byte, 32), DocumentID: "mom-deed.pdf"}}, nil, nil, make([]byte, 32), 7, 1700000000000)
+	current.Difficulty = 4
+	current.Signer = []byte("signer")
+	legacy := *current
+	legacy.Version = 0
+
+	blocks := map[string]*Block{
+		"current": current,
+		"version 0": &legacy,
+		"first release": firstReleaseGenesis(),
+	}
+	for name, block := range blocks{
+		pow := NewProof(block)
+		data := pow.nonceData()
+		for _, nonce := range []int{0, 1, 127, 128, 1 << 20, math.MaxInt64}{
+			if got, want := data(nonce), pow.InitData(nonce); !bytes.Equal(got, want){
+				t.Fatalf("%s block, nonce %d: nonceData %x, InitData %x", name, nonce, got, want)
+			}
+		}
+	}
+}
+
+// Run with -race: Seal writes the block right after Run returns, while the
+// workers that did not find the nonce may still be hashing
+func TestSealAfterRun(t *testing.T){
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	for i := 0; i < 20; i++{
+		block := NewBlock(nil, nil, nil, make([]byte, 32), 1, int64(i))
+		block.Difficulty = 6
+		engine := &PowEngine{}
+		if err := engine.Seal(context.Background(), block); err != nil{
+			t.Fatal(err)
+		}
+		if err := engine.VerifySeal(block); err != nil{
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package blockchain
+
+// maxPageScan bounds the number of blocks read for a single page so that a
+// filter matching few blocks cannot make one request walk the whole chain.
+// The page then ends early and NextCursor continues the scan.
+var maxPageScan = 10000
+
+// BlockFilter selects blocks by their document fields and timestamp. A block
+// matches when its timestamp is in range and, if any document field is set,
+// at least one of its documents matches all of them. Empty fields and zero
+// timestamps match everything, including blocks without documents.
+type BlockFilter struct{
+	NotaryID string
+	UserID string
+	CNPJ string
+	DocumentID string
+	// Since and Until bound the block timestamp in milliseconds, inclusive
+	Since int64
+	Until int64
+}
+
+func (f *BlockFilter) Match(block *Block) bool{
+	if f.Since != 0 && block.Timestamp < f.Since{
+		return false
+	}
+	if f.Until != 0 && block.Timestamp > f.Until{
+		return false
+	}
+	if f.NotaryID == "" && f.UserID == "" && f.CNPJ == "" && f.DocumentID == ""{
+		return true
+	}
+
+	for i := range block.Data{
+		if f.MatchData(&block.Data[i]){
+			return true
+		}
+	}
+	return false
+}
+
+// MatchData reports whether a single document matches the document fields
+func (f *BlockFilter) MatchData(data *BlockData) bool{
+	switch{
+	case f.NotaryID != "" && data.NotaryID != f.NotaryID:
+		return false
+	case f.UserID != "" && data.UserID != f.UserID:
+		return false
+	case f.CNPJ != "" && data.CNPJ != f.CNPJ:
+		return false
+	case f.DocumentID != "" && data.DocumentID != f.DocumentID:
+		return false
+	}
+	return true
+}
+
+// BlockPageQuery describes one page of main chain blocks. Before and After
+// are exclusive height bounds.
+type BlockPageQuery struct{
+	Limit uint64
+	Ascending bool
+	Before *uint64
+	After *uint64
+	Filter BlockFilter
+}
+
+// BlockPage holds the blocks of a page. NextCursor is the height to pass as
+// Before (descending) or After (ascending) to get the next page, or nil when
+// there are no more blocks in range.
+type BlockPage struct{
+	Blocks []*Block
+	NextCursor *uint64
+}
+
+// ListBlocksPage returns the main chain blocks matching the query, newest
+// first unless Ascending is set
+func (chain *BlockChain) ListBlocksPage(query BlockPageQuery) (*BlockPage, error){
+	page := &BlockPage{Blocks: []*Block{}}
+	_, tip := chain.Tip()
+
+	low, high := uint64(0), tip
+	if query.After != nil{
+		if *query.After >= high{
+			return page, nil
+		}
+		low = *query.After + 1
+	}
+	if query.Before != nil{
+		if *query.Before <= low{
+			return page, nil
+		}
+		high = min(high, *query.Before-1)
+	}
+	if low > high || query.Limit == 0{
+		return page, nil
+	}
+
+	height, step, last := high, int64(-1), low
+	if query.Ascending{
+		height, step, last = low, 1, high
+	}
+
+	for scanned := 0; ; scanned++{
+		if scanned == maxPageScan || uint64(len(page.Blocks)) == query.Limit{
+			cursor := uint64(int64(height) - step)
+			page.NextCursor = &cursor
+			break
+		}
+
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil{
+			return nil, err
+		}
+		if query.Filter.Match(block){
+			page.Blocks = append(page.Blocks, block)
+		}
+
+		if height == last{
+			break
+		}
+		height = uint64(int64(height) + step)
+	}
+
+	return page, nil
+}
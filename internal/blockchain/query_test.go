@@ -0,0 +1,195 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListBlocksWithoutDocuments(t *testing.T){
+	chain := devChain(t)
+	ctx := context.Background()
+	deed := document(t, "deed.pdf")
+	anchored, err := chain.CreateInsertBlock(ctx, []BlockData{deed}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := chain.CreateInsertBlock(ctx, nil, nil, nil); err != nil{
+		t.Fatal(err)
+	}
+	if _, err := chain.CreateInsertBlock(ctx, nil, nil, []StatusTx{supersede(t, deed, document(t, "will.pdf").Hash, 1)}); err != nil{
+		t.Fatal(err)
+	}
+
+	page, err := chain.ListBlocksPage(BlockPageQuery{Limit: 10})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(page.Blocks) != 4{
+		t.Fatalf("listed %d blocks without a filter, want 4", len(page.Blocks))
+	}
+
+	page, err = chain.ListBlocksPage(BlockPageQuery{Limit: 10, Filter: BlockFilter{NotaryID: deed.NotaryID}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(page.Blocks) != 1 || page.Blocks[0].Height != anchored.Height{
+		t.Fatalf("listed %d blocks for a notary filter, want block %d", len(page.Blocks), anchored.Height)
+	}
+}
+
+// pagedChain returns a chain of 7 blocks, block n being timestamped n seconds
+// after the returned time. Notary A anchors deed.pdf at height 1, lease.pdf
+// at height 4 and sale.pdf at height 6, notary B will.pdf at height 3, and
+// blocks 2 and 5 are empty.
+func pagedChain(t *testing.T) (*BlockChain, int64){
+	t.Helper()
+	chain := devChain(t)
+	start := time.Now().Add(-time.Hour).UnixMilli()
+	notary := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed(append([]byte{1}, make([]byte, ed25519.SeedSize-1)...))
+	notaryA, notaryB := "21122ee1-a5bc-4fcc-bead-065acfc38edf", "8f2d6f3e-7d40-4c55-9a3b-4f6e0c2b1a90"
+
+	for height, data := range [][]BlockData{
+		1: {signedDocument(t, notary, notaryA, "deed.pdf")},
+		2: nil,
+		3: {signedDocument(t, other, notaryB, "will.pdf")},
+		4: {signedDocument(t, notary, notaryA, "lease.pdf")},
+		5: nil,
+		6: {signedDocument(t, notary, notaryA, "sale.pdf")},
+	}{
+		if height == 0{
+			continue
+		}
+		block, err := chain.CreateBlock(context.Background(), data, nil, nil)
+		if err != nil{
+			t.Fatal(err)
+		}
+		block.Timestamp = start + int64(height)*1000
+		if err := chain.engine.Seal(context.Background(), block); err != nil{
+			t.Fatal(err)
+		}
+		if err := chain.InsertBlock(block); err != nil{
+			t.Fatal(err)
+		}
+	}
+	return chain, start
+}
+
+func heights(page *BlockPage) []uint64{
+	heights := []uint64{}
+	for _, block := range page.Blocks{
+		heights = append(heights, block.Height)
+	}
+	return heights
+}
+
+func cursor(height uint64) *uint64{
+	return &height
+}
+
+func TestListBlocksPage(t *testing.T){
+	chain, start := pagedChain(t)
+
+	for _, test := range []struct{
+		name string
+		query BlockPageQuery
+		heights []uint64
+		cursor *uint64
+	}{
+		{"newest first", BlockPageQuery{Limit: 3}, []uint64{6, 5, 4}, cursor(4)},
+		{"before", BlockPageQuery{Limit: 3, Before: cursor(4)}, []uint64{3, 2, 1}, cursor(1)},
+		{"before the last page", BlockPageQuery{Limit: 3, Before: cursor(1)}, []uint64{0}, nil},
+		{"oldest first", BlockPageQuery{Limit: 3, Ascending: true}, []uint64{0, 1, 2}, cursor(2)},
+		{"after", BlockPageQuery{Limit: 3, Ascending: true, After: cursor(2)}, []uint64{3, 4, 5}, cursor(5)},
+		{"after the last page", BlockPageQuery{Limit: 3, Ascending: true, After: cursor(5)}, []uint64{6}, nil},
+		{"limit reached on the last block", BlockPageQuery{Limit: 3, After: cursor(3)}, []uint64{6, 5, 4}, nil},
+		{"between", BlockPageQuery{Limit: 10, After: cursor(1), Before: cursor(5)}, []uint64{4, 3, 2}, nil},
+		{"between oldest first", BlockPageQuery{Limit: 10, Ascending: true, After: cursor(1), Before: cursor(5)}, []uint64{2, 3, 4}, nil},
+		{"after the tip", BlockPageQuery{Limit: 10, After: cursor(6)}, []uint64{}, nil},
+		{"before genesis", BlockPageQuery{Limit: 10, Before: cursor(0)}, []uint64{}, nil},
+		{"empty range", BlockPageQuery{Limit: 10, After: cursor(3), Before: cursor(4)}, []uint64{}, nil},
+		{"no limit", BlockPageQuery{}, []uint64{}, nil},
+		{"notary", BlockPageQuery{Limit: 2, Filter: BlockFilter{NotaryID: "21122ee1-a5bc-4fcc-bead-065acfc38edf"}}, []uint64{6, 4}, cursor(4)},
+		{"other notary", BlockPageQuery{Limit: 10, Filter: BlockFilter{NotaryID: "8f2d6f3e-7d40-4c55-9a3b-4f6e0c2b1a90"}}, []uint64{3}, nil},
+		{"document", BlockPageQuery{Limit: 10, Filter: BlockFilter{DocumentID: "mom-lease.pdf"}}, []uint64{4}, nil},
+		{"notary and document", BlockPageQuery{Limit: 10, Filter: BlockFilter{NotaryID: "8f2d6f3e-7d40-4c55-9a3b-4f6e0c2b1a90", DocumentID: "mom-lease.pdf"}}, []uint64{}, nil},
+		{"since and until", BlockPageQuery{Limit: 10, Filter: BlockFilter{Since: start + 2000, Until: start + 4000}}, []uint64{4, 3, 2}, nil},
+		{"since oldest first", BlockPageQuery{Limit: 2, Ascending: true, Filter: BlockFilter{Since: start + 5000}}, []uint64{5, 6}, nil},
+	}{
+		page, err := chain.ListBlocksPage(test.query)
+		if err != nil{
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := heights(page); !reflect.DeepEqual(got, test.heights){
+			t.Errorf("%s: listed %v, want %v", test.name, got, test.heights)
+		}
+		if !reflect.DeepEqual(page.NextCursor, test.cursor){
+			t.Errorf("%s: next cursor %v, want %v", test.name, page.NextCursor, test.cursor)
+		}
+	}
+}
+
+func TestListBlocksPageCursor(t *testing.T){
+	chain, _ := pagedChain(t)
+
+	for _, ascending := range []bool{false, true}{
+		listed := []uint64{}
+		query := BlockPageQuery{Limit: 2, Ascending: ascending}
+		for pages := 0; ; pages++{
+			if pages == 10{
+				t.Fatalf("ascending %v: the cursor does not end", ascending)
+			}
+			page, err := chain.ListBlocksPage(query)
+			if err != nil{
+				t.Fatal(err)
+			}
+			listed = append(listed, heights(page)...)
+			if page.NextCursor == nil{
+				break
+			}
+			if ascending{
+				query.After = page.NextCursor
+			} else {
+				query.Before = page.NextCursor
+			}
+		}
+
+		want := []uint64{6, 5, 4, 3, 2, 1, 0}
+		if ascending{
+			want = []uint64{0, 1, 2, 3, 4, 5, 6}
+		}
+		if !reflect.DeepEqual(listed, want){
+			t.Fatalf("ascending %v: listed %v, want %v", ascending, listed, want)
+		}
+	}
+}
+
+func TestListBlocksPageScanLimit(t *testing.T){
+	chain, _ := pagedChain(t)
+	defer func(scan int){ maxPageScan = scan }(maxPageScan)
+	maxPageScan = 3
+
+	// the page ends after 3 blocks even though it is not full, and the
+	// cursor resumes the scan where it stopped
+	query := BlockPageQuery{Limit: 10, Filter: BlockFilter{NotaryID: "8f2d6f3e-7d40-4c55-9a3b-4f6e0c2b1a90"}}
+	for _, want := range []struct{
+		heights []uint64
+		cursor *uint64
+	}{
+		{[]uint64{}, cursor(4)},
+		{[]uint64{3}, cursor(1)},
+		{[]uint64{}, nil},
+	}{
+		page, err := chain.ListBlocksPage(query)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if got := heights(page); !reflect.DeepEqual(got, want.heights) || !reflect.DeepEqual(page.NextCursor, want.cursor){
+			t.Fatalf("before %v: listed %v up to %v, want %v up to %v", query.Before, got, page.NextCursor, want.heights, want.cursor)
+		}
+		query.Before = page.NextCursor
+	}
+}
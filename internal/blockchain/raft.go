@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RaftEngine checks blocks ordered by the raft package among the members in
+// params.Authorities. The elected leader builds and signs every block, and
+// the other members take them from the replicated log, so there are no forks:
+// every block has difficulty and work 1.
+type RaftEngine struct{
+	members []peer.ID
+	key crypto.PrivKey
+	id peer.ID
+}
+
+func NewRaftEngine(params Params, key crypto.PrivKey) (*RaftEngine, error){
+	members, err := parseAuthorities(params)
+	if err != nil{
+		return nil, err
+	}
+
+	engine := &RaftEngine{members: members}
+	if key != nil{
+		id, err := peer.IDFromPrivateKey(key)
+		if err != nil{
+			return nil, err
+		}
+		engine.key = key
+		engine.id = id
+	}
+	return engine, nil
+}
+
+// Members returns the cluster members in order
+func (e *RaftEngine) Members() []peer.ID{
+	return append([]peer.ID{}, e.members...)
+}
+
+func (e *RaftEngine) isMember(id peer.ID) bool{
+	for _, member := range e.members{
+		if member == id{
+			return true
+		}
+	}
+	return false
+}
+
+// CanSeal is false: only the raft leader builds blocks, not a miner
+func (e *RaftEngine) CanSeal() bool{
+	return false
+}
+
+func (e *RaftEngine) Prepare(reader HeaderReader, parent *Block, block *Block) error{
+	if e.key == nil || !e.isMember(e.id){
+		return ErrNotAuthorized
+	}
+	block.Signer = []byte(e.id)
+	block.Difficulty = 1
+	return nil
+}
+
+// Seal signs the block hash. The genesis block is left unsigned.
+func (e *RaftEngine) Seal(ctx context.Context, block *Block) error{
+	hash := e.Hash(block)
+	if block.Height == 0{
+		block.Hash = hash
+		return nil
+	}
+	if e.key == nil{
+		return ErrNotAuthorized
+	}
+
+	signature, err := e.key.Sign(hash)
+	if err != nil{
+		return err
+	}
+	block.Hash = hash
+	block.Signature = signature
+	return nil
+}
+
+func (e *RaftEngine) Hash(block *Block) []byte{
+	return headerHash(block)
+}
+
+func (e *RaftEngine) VerifySeal(block *Block) error{
+	return verifySigned(block, e.members)
+}
+
+func (e *RaftEngine) VerifyHeader(reader HeaderReader, parent *Block, block *Block) error{
+	if block.Difficulty != 1{
+		return fmt.Errorf("%w: difficulty %d, expected 1", ErrInvalidDifficulty, block.Difficulty)
+	}
+	return nil
+}
+
+func (e *RaftEngine) Work(block *Block) *big.Int{
+	return big.NewInt(int64(block.Difficulty))
+}
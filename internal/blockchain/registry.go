@@ -0,0 +1,530 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Operations of a NotaryTx
+const(
+	NotaryRegister = "register"
+	NotaryRotate = "rotate"
+	NotaryRevoke = "revoke"
+)
+
+// Statuses of a NotaryRecord
+const(
+	NotaryActive = "active"
+	NotaryRevoked = "revoked"
+)
+
+const(
+	notaryPrefix = "nr:"
+	notaryTxPrefix = "nx:"
+)
+
+// notaryDomain separates registry signatures from document signatures
+var notaryDomain = []byte("bc/notary/v1")
+
+// NotaryTx is a registry transaction signed by one of the registry admins. It
+// registers a notary with its public key, rotates the key of an active notary
+// or revokes one. Timestamp orders the transactions of a notary: a
+// transaction older than the last one applied to the same notary is refused,
+// so a signed transaction cannot be replayed.
+type NotaryTx struct{
+	Op string `json:"op"`
+	NotaryID string `json:"notaryId"`
+	// PublicKey is the DER encoded key of the notary, empty when revoking
+	PublicKey []byte `json:"publicKey,omitempty"`
+	Timestamp int64 `json:"timestamp"`
+	// Admin is the DER encoded key of the admin, and Signature its signature
+	// of SigningBytes
+	Admin []byte `json:"admin"`
+	Signature []byte `json:"signature"`
+}
+
+// NotaryRecord is the registry state of a notary after a transaction
+type NotaryRecord struct{
+	NotaryID string `json:"notaryId"`
+	PublicKey []byte `json:"publicKey,omitempty"`
+	Status string `json:"status"`
+	// Height is the height of the block that applied the transaction
+	Height uint64 `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+	TxHash []byte `json:"txHash"`
+}
+
+// Orphans holds the entries of the blocks that left the main chain in a
+// reorg and are not included by the new branch
+type Orphans struct{
+	Data []BlockData
+	Notaries []NotaryTx
+	Statuses []StatusTx
+}
+
+// SigningBytes returns the canonical serialization of a transaction that the
+// admin signs: the domain followed by the operation, notary ID and public key,
+// each as a 4 byte big endian length and the bytes themselves, and the
+// timestamp as 8 big endian bytes
+func (tx *NotaryTx) SigningBytes() []byte{
+	var buf bytes.Buffer
+	buf.Write(notaryDomain)
+	for _, field := range [][]byte{
+		[]byte(tx.Op),
+		[]byte(tx.NotaryID),
+		tx.PublicKey,
+	}{
+		binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	binary.Write(&buf, binary.BigEndian, tx.Timestamp)
+	return buf.Bytes()
+}
+
+// Hash identifies the transaction by its signed content
+func (tx *NotaryTx) Hash() []byte{
+	hash := sha256.Sum256(tx.SigningBytes())
+	return hash[:]
+}
+
+// Sign sets Admin and Signature with an Ed25519 or ECDSA P-256 admin key
+func (tx *NotaryTx) Sign(signer crypto.Signer) error{
+	admin, signature, err := signMessage(signer, tx.SigningBytes())
+	if err != nil{
+		return err
+	}
+	tx.Admin = admin
+	tx.Signature = signature
+	return nil
+}
+
+// Verify checks the fields of the transaction and that it is signed by one of
+// admins. Whether it applies to the current registry state is checked when
+// its block is connected.
+func (tx *NotaryTx) Verify(admins [][]byte) error{
+	if len(admins) == 0{
+		return ErrRegistryDisabled
+	}
+	if tx.NotaryID == "" || strings.IndexByte(tx.NotaryID, 0) >= 0{
+		return fmt.Errorf("%w: invalid notary ID %q", ErrInvalidNotaryTx, tx.NotaryID)
+	}
+
+	switch tx.Op{
+	case NotaryRegister, NotaryRotate:
+		if _, err := parsePublicKey(tx.PublicKey); err != nil{
+			return fmt.Errorf("%w: notary %v", ErrInvalidNotaryTx, err)
+		}
+	case NotaryRevoke:
+		if len(tx.PublicKey) > 0{
+			return fmt.Errorf("%w: revoke carries a public key", ErrInvalidNotaryTx)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidNotaryTx, tx.Op)
+	}
+
+	authorized := false
+	for _, admin := range admins{
+		if bytes.Equal(admin, tx.Admin){
+			authorized = true
+			break
+		}
+	}
+	if !authorized{
+		return fmt.Errorf("%w: not signed by a registry admin", ErrInvalidNotaryTx)
+	}
+	if err := verifyKeySignature(tx.Admin, tx.SigningBytes(), tx.Signature); err != nil{
+		return fmt.Errorf("%w: %v", ErrInvalidNotaryTx, err)
+	}
+	return nil
+}
+
+// apply returns the record of the notary after the transaction, given its
+// current record or nil if it was never registered
+func (tx *NotaryTx) apply(current *NotaryRecord, height uint64) (*NotaryRecord, error){
+	if current != nil && tx.Timestamp <= current.Timestamp{
+		return nil, fmt.Errorf("%w: timestamp %d is not after the last update of notary %s at %d", ErrInvalidNotaryTx, tx.Timestamp, tx.NotaryID, current.Timestamp)
+	}
+
+	active := current != nil && current.Status == NotaryActive
+	switch{
+	case tx.Op == NotaryRegister && active:
+		return nil, fmt.Errorf("%w: notary %s is already registered", ErrInvalidNotaryTx, tx.NotaryID)
+	case tx.Op != NotaryRegister && !active:
+		return nil, fmt.Errorf("%w: notary %s is not registered", ErrInvalidNotaryTx, tx.NotaryID)
+	}
+
+	record := &NotaryRecord{
+		NotaryID: tx.NotaryID,
+		PublicKey: tx.PublicKey,
+		Status: NotaryActive,
+		Height: height,
+		Timestamp: tx.Timestamp,
+		TxHash: tx.Hash(),
+	}
+	if tx.Op == NotaryRevoke{
+		record.Status = NotaryRevoked
+		record.PublicKey = current.PublicKey
+	}
+	return record, nil
+}
+
+// parseAdmins decodes the base64 DER encoded admin keys of params
+func parseAdmins(params Params) ([][]byte, error){
+	admins := make([][]byte, 0, len(params.Admins))
+	for _, encoded := range params.Admins{
+		admin, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil{
+			return nil, fmt.Errorf("registry admin %q: %w", encoded, err)
+		}
+		if _, err := parsePublicKey(admin); err != nil{
+			return nil, fmt.Errorf("registry admin %q: %w", encoded, err)
+		}
+		admins = append(admins, admin)
+	}
+	return admins, nil
+}
+
+// verifyNotaries checks the registry transactions of a block against the
+// admin keys
+func verifyNotaries(block *Block, admins [][]byte) error{
+	for i := range block.Notaries{
+		if err := block.Notaries[i].Verify(admins); err != nil{
+			return fmt.Errorf("notary tx %x: %w", block.Notaries[i].Hash(), err)
+		}
+	}
+	return nil
+}
+
+// notaryKey returns the badger key holding the record of a notary written by
+// the main chain block at height
+func notaryKey(notaryID string, height uint64) []byte{
+	key := make([]byte, 0, len(notaryPrefix)+len(notaryID)+9)
+	key = append(key, notaryPrefix...)
+	key = append(key, notaryID...)
+	key = append(key, 0)
+	return binary.BigEndian.AppendUint64(key, height)
+}
+
+// notaryTxKey returns the badger key mapping a registry transaction hash to
+// the hash of the block that applied it
+func notaryTxKey(txHash []byte) []byte{
+	return append([]byte(notaryTxPrefix), txHash...)
+}
+
+func encodeNotaryRecord(record *NotaryRecord) ([]byte, error){
+	var res bytes.Buffer
+	if err := gob.NewEncoder(&res).Encode(record); err != nil{
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+func decodeNotaryRecord(val []byte) (*NotaryRecord, error){
+	var record NotaryRecord
+	if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&record); err != nil{
+		return nil, fmt.Errorf("%w: notary record: %v", ErrCorruptBlock, err)
+	}
+	return &record, nil
+}
+
+// notaryAt returns the record of a notary in the registry state after the
+// main chain block at height, or nil if it was not registered by then
+func notaryAt(txn *badger.Txn, notaryID string, height uint64) (*NotaryRecord, error){
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.Prefix = notaryKey(notaryID, 0)[:len(notaryPrefix)+len(notaryID)+1]
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	it.Seek(notaryKey(notaryID, height))
+	if !it.Valid(){
+		return nil, nil
+	}
+	val, err := it.Item().ValueCopy(nil)
+	if err != nil{
+		return nil, err
+	}
+	return decodeNotaryRecord(val)
+}
+
+// applyNotaries applies the registry transactions of block, in order, on top
+// of the registry state after its parent and returns the resulting record of
+// each transaction
+func applyNotaries(txn *badger.Txn, block *Block) ([]*NotaryRecord, error){
+	if len(block.Notaries) == 0{
+		return nil, nil
+	}
+
+	updated := map[string]*NotaryRecord{}
+	records := make([]*NotaryRecord, 0, len(block.Notaries))
+	for i := range block.Notaries{
+		tx := &block.Notaries[i]
+		current, ok := updated[tx.NotaryID]
+		if !ok{
+			var err error
+			current, err = notaryAt(txn, tx.NotaryID, block.Height-1)
+			if err != nil{
+				return nil, err
+			}
+		}
+		record, err := tx.apply(current, block.Height)
+		if err != nil{
+			return nil, fmt.Errorf("notary tx %x: %w", tx.Hash(), err)
+		}
+		updated[tx.NotaryID] = record
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// indexNotaries applies the registry transactions of a block joining the
+// main chain inside txn. A transaction that does not apply rejects the block.
+func indexNotaries(txn *badger.Txn, block *Block) error{
+	records, err := applyNotaries(txn, block)
+	if err != nil{
+		return err
+	}
+	for _, record := range records{
+		val, err := encodeNotaryRecord(record)
+		if err != nil{
+			return err
+		}
+		if err := txn.Set(notaryKey(record.NotaryID, record.Height), val); err != nil{
+			return err
+		}
+		if err := txn.Set(notaryTxKey(record.TxHash), block.Hash); err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexNotaries reverts the registry transactions of a block leaving the
+// main chain
+func unindexNotaries(txn *badger.Txn, block *Block) error{
+	for i := range block.Notaries{
+		tx := &block.Notaries[i]
+		if err := txn.Delete(notaryKey(tx.NotaryID, block.Height)); err != nil{
+			return err
+		}
+		if err := txn.Delete(notaryTxKey(tx.Hash())); err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+// RegistryEnabled reports whether registry admins are configured. Without
+// them registry transactions are refused and any notary may upload.
+func (chain *BlockChain) RegistryEnabled() bool{
+	return len(chain.admins) > 0
+}
+
+// ContainsNotaryTx reports whether a registry transaction was applied by a
+// main chain block
+func (chain *BlockChain) ContainsNotaryTx(txHash []byte) (bool, error){
+	_, err := chain.getIndexed(notaryTxKey(txHash))
+	if err == ErrBlockNotFound{
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CheckNotaryTxs splits registry transactions into the ones that apply in
+// order on top of the current tip, and the ones that are invalid, already
+// applied or outdated
+func (chain *BlockChain) CheckNotaryTxs(txs []*NotaryTx) ([]NotaryTx, []*NotaryTx){
+	var valid []NotaryTx
+	var rejected []*NotaryTx
+
+	chain.Database.View(func(txn *badger.Txn) error{
+		_, height := chain.Tip()
+		updated := map[string]*NotaryRecord{}
+		for _, tx := range txs{
+			if tx.Verify(chain.admins) != nil{
+				rejected = append(rejected, tx)
+				continue
+			}
+			current, ok := updated[tx.NotaryID]
+			if !ok{
+				var err error
+				if current, err = notaryAt(txn, tx.NotaryID, height); err != nil{
+					rejected = append(rejected, tx)
+					continue
+				}
+			}
+			record, err := tx.apply(current, height+1)
+			if err != nil{
+				rejected = append(rejected, tx)
+				continue
+			}
+			updated[tx.NotaryID] = record
+			valid = append(valid, *tx)
+		}
+		return nil
+	})
+	return valid, rejected
+}
+
+// CheckNotaryTx checks a registry transaction against the admin keys and the
+// registry state at the current tip
+func (chain *BlockChain) CheckNotaryTx(tx *NotaryTx) error{
+	if err := tx.Verify(chain.admins); err != nil{
+		return err
+	}
+	return chain.Database.View(func(txn *badger.Txn) error{
+		_, height := chain.Tip()
+		current, err := notaryAt(txn, tx.NotaryID, height)
+		if err != nil{
+			return err
+		}
+		_, err = tx.apply(current, height+1)
+		return err
+	})
+}
+
+// NotaryAt returns the record of a notary in the registry state after the
+// main chain block at height, or ErrNotaryNotFound if it was not registered
+// by then
+func (chain *BlockChain) NotaryAt(notaryID string, height uint64) (*NotaryRecord, error){
+	var record *NotaryRecord
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		var err error
+		record, err = notaryAt(txn, notaryID, height)
+		return err
+	})
+	if err != nil{
+		return nil, err
+	}
+	if record == nil{
+		return nil, fmt.Errorf("%w: %s", ErrNotaryNotFound, notaryID)
+	}
+	return record, nil
+}
+
+// Notary returns the current record of a notary
+func (chain *BlockChain) Notary(notaryID string) (*NotaryRecord, error){
+	return chain.NotaryAt(notaryID, chain.Height())
+}
+
+// NotaryHistory returns the records of a notary on the main chain, oldest
+// first, or ErrNotaryNotFound if it was never registered
+func (chain *BlockChain) NotaryHistory(notaryID string) ([]*NotaryRecord, error){
+	history := []*NotaryRecord{}
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = notaryKey(notaryID, 0)[:len(notaryPrefix)+len(notaryID)+1]
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next(){
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil{
+				return err
+			}
+			record, err := decodeNotaryRecord(val)
+			if err != nil{
+				return err
+			}
+			history = append(history, record)
+		}
+		return nil
+	})
+	if err != nil{
+		return nil, err
+	}
+	if len(history) == 0{
+		return nil, fmt.Errorf("%w: %s", ErrNotaryNotFound, notaryID)
+	}
+	return history, nil
+}
+
+// AuthorizeNotary checks that the notary of a document is active in the
+// current registry with the key that signed it. Any notary is accepted when
+// the registry is disabled.
+func (chain *BlockChain) AuthorizeNotary(data *BlockData) error{
+	if !chain.RegistryEnabled(){
+		return nil
+	}
+	record, err := chain.Notary(data.NotaryID)
+	if err != nil{
+		return notaryError(err)
+	}
+	return record.authorizes(data)
+}
+
+// authorizeDocuments checks that the notary of every document of a block
+// joining the main chain was active with the key that signed it in the
+// registry state after its parent. Any notary is accepted when the registry
+// is disabled, and the documents of the genesis block and of the first
+// release are not signed.
+func (chain *BlockChain) authorizeDocuments(txn *badger.Txn, block *Block) error{
+	if !chain.RegistryEnabled() || len(block.PrevHash) == 0 || block.isFirstRelease(){
+		return nil
+	}
+	records := map[string]*NotaryRecord{}
+	for i := range block.Data{
+		data := &block.Data[i]
+		record, ok := records[data.NotaryID]
+		if !ok{
+			var err error
+			if record, err = notaryAt(txn, data.NotaryID, block.Height-1); err != nil{
+				return err
+			}
+			records[data.NotaryID] = record
+		}
+		if record == nil{
+			return fmt.Errorf("document %x: %w: notary %s is not registered", data.Hash, ErrUnauthorizedNotary, data.NotaryID)
+		}
+		if err := record.authorizes(data); err != nil{
+			return fmt.Errorf("document %x: %w", data.Hash, err)
+		}
+	}
+	return nil
+}
+
+// NotaryAuthorized reports whether the notary of a document was active with
+// the key that signed it in the registry state before the block at height,
+// along with the notary's record then, if any
+func (chain *BlockChain) NotaryAuthorized(data *BlockData, height uint64) (*NotaryRecord, bool, error){
+	if height == 0{
+		return nil, false, nil
+	}
+	record, err := chain.NotaryAt(data.NotaryID, height-1)
+	if errors.Is(err, ErrNotaryNotFound){
+		return nil, false, nil
+	}
+	if err != nil{
+		return nil, false, err
+	}
+	return record, record.authorizes(data) == nil, nil
+}
+
+func (record *NotaryRecord) authorizes(data *BlockData) error{
+	if record.Status != NotaryActive{
+		return fmt.Errorf("%w: notary %s is %s", ErrUnauthorizedNotary, record.NotaryID, record.Status)
+	}
+	if !bytes.Equal(record.PublicKey, data.PublicKey){
+		return fmt.Errorf("%w: document is not signed with the registered key of notary %s", ErrUnauthorizedNotary, record.NotaryID)
+	}
+	return nil
+}
+
+// notaryError turns a missing registry record into ErrUnauthorizedNotary
+func notaryError(err error) error{
+	if errors.Is(err, ErrNotaryNotFound){
+		return fmt.Errorf("%w: %v", ErrUnauthorizedNotary, err)
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// registryChain opens a dev chain whose registry is administered by admin
+func registryChain(t *testing.T, admin ed25519.PrivateKey) *BlockChain{
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(admin.Public())
+	if err != nil{
+		t.Fatal(err)
+	}
+	params, err := NetworkParams("dev")
+	if err != nil{
+		t.Fatal(err)
+	}
+	params.Admins = []string{base64.StdEncoding.EncodeToString(der)}
+	engine, err := NewEngine(params, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	chain, err := openBlockChain(t.TempDir(), params, engine)
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ chain.Database.Close() })
+	return chain
+}
+
+func signedDocument(t *testing.T, notary ed25519.PrivateKey, notaryID string, name string) BlockData{
+	t.Helper()
+	hash := sha256.Sum256([]byte(name))
+	data := BlockData{
+		Hash: hash[:],
+		DocumentID: "mom-" + name,
+		NotaryID: notaryID,
+		UserID: "a101fb26-8b78-4e93-9fab-67d291a28fb7",
+		CNPJ: "11.222.333/0001-81",
+	}
+	if err := data.Sign(notary); err != nil{
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUnauthorizedDocumentsRefused(t *testing.T){
+	seed := make([]byte, ed25519.SeedSize)
+	admin := ed25519.NewKeyFromSeed(seed)
+	seed[0] = 1
+	notary := ed25519.NewKeyFromSeed(seed)
+	const notaryID = "21122ee1-a5bc-4fcc-bead-065acfc38edf"
+	chain := registryChain(t, admin)
+	ctx := context.Background()
+
+	early, err := chain.CreateBlock(ctx, []BlockData{signedDocument(t, notary, notaryID, "early.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.CheckBlock(early); !errors.Is(err, ErrUnauthorizedNotary){
+		t.Fatalf("CheckBlock of an unregistered notary's document: %v", err)
+	}
+	if err := chain.InsertBlock(early); !errors.Is(err, ErrUnauthorizedNotary){
+		t.Fatalf("AcceptBlock of an unregistered notary's document: %v", err)
+	}
+
+	key, err := x509.MarshalPKIXPublicKey(notary.Public())
+	if err != nil{
+		t.Fatal(err)
+	}
+	register := NotaryTx{Op: NotaryRegister, NotaryID: notaryID, PublicKey: key, Timestamp: 1}
+	if err := register.Sign(admin); err != nil{
+		t.Fatal(err)
+	}
+	// a document is only authorized by the registry state before its block
+	same, err := chain.CreateBlock(ctx, []BlockData{signedDocument(t, notary, notaryID, "same.pdf")}, []NotaryTx{register}, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.InsertBlock(same); !errors.Is(err, ErrUnauthorizedNotary){
+		t.Fatalf("AcceptBlock of a document in the block registering its notary: %v", err)
+	}
+	if _, err := chain.CreateInsertBlock(ctx, nil, []NotaryTx{register}, nil); err != nil{
+		t.Fatal(err)
+	}
+
+	later, err := chain.CreateBlock(ctx, []BlockData{signedDocument(t, notary, notaryID, "later.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.CheckBlock(later); err != nil{
+		t.Fatalf("CheckBlock of a registered notary's document: %v", err)
+	}
+	if err := chain.InsertBlock(later); err != nil{
+		t.Fatalf("AcceptBlock of a registered notary's document: %v", err)
+	}
+
+	revoke := NotaryTx{Op: NotaryRevoke, NotaryID: notaryID, Timestamp: 2}
+	if err := revoke.Sign(admin); err != nil{
+		t.Fatal(err)
+	}
+	if _, err := chain.CreateInsertBlock(ctx, nil, []NotaryTx{revoke}, nil); err != nil{
+		t.Fatal(err)
+	}
+	revoked, err := chain.CreateBlock(ctx, []BlockData{signedDocument(t, notary, notaryID, "revoked.pdf")}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := chain.InsertBlock(revoked); !errors.Is(err, ErrUnauthorizedNotary){
+		t.Fatalf("AcceptBlock of a revoked notary's document: %v", err)
+	}
+	if ok, err := chain.ContainsFileHash(revoked.Data[0].Hash); err != nil || ok{
+		t.Fatalf("refused document anchored: %v %v", ok, err)
+	}
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// documentDomain separates document signatures from any other use of the
+// notaries' keys
+var documentDomain = []byte("bc/document/v1")
+
+// SigningBytes returns the canonical serialization of a document that its
+// notary signs: the domain followed by the hash, document ID, notary ID, user
+// ID and CNPJ, each as a 4 byte big endian length and the bytes themselves
+func (bd *BlockData) SigningBytes() []byte{
+	var buf bytes.Buffer
+	buf.Write(documentDomain)
+	for _, field := range [][]byte{
+		bd.Hash,
+		[]byte(bd.DocumentID),
+		[]byte(bd.NotaryID),
+		[]byte(bd.UserID),
+		[]byte(bd.CNPJ),
+	}{
+		binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+// VerifySignature checks that Signature is a signature of SigningBytes by
+// PublicKey, a DER encoded SubjectPublicKeyInfo holding an Ed25519 or an
+// ECDSA P-256 key. Ed25519 signs the bytes themselves; ECDSA signs their
+// SHA-256 digest and its signature is either ASN.1 DER or r || s.
+func (bd *BlockData) VerifySignature() error{
+	if len(bd.PublicKey) == 0 || len(bd.Signature) == 0{
+		return fmt.Errorf("%w: document is not signed", ErrInvalidSignature)
+	}
+	return verifyKeySignature(bd.PublicKey, bd.SigningBytes(), bd.Signature)
+}
+
+// Sign sets PublicKey and Signature with an Ed25519 or ECDSA P-256 key
+func (bd *BlockData) Sign(signer crypto.Signer) error{
+	publicKey, signature, err := signMessage(signer, bd.SigningBytes())
+	if err != nil{
+		return err
+	}
+	bd.PublicKey = publicKey
+	bd.Signature = signature
+	return nil
+}
+
+// parsePublicKey decodes a DER encoded SubjectPublicKeyInfo, accepting only
+// Ed25519 and ECDSA P-256 keys
+func parsePublicKey(der []byte) (crypto.PublicKey, error){
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil{
+		return nil, fmt.Errorf("%w: public key: %v", ErrInvalidSignature, err)
+	}
+	switch key := key.(type){
+	case ed25519.PublicKey:
+		return key, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256(){
+			return nil, fmt.Errorf("%w: ECDSA keys must use the P-256 curve", ErrInvalidSignature)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported %T public key", ErrInvalidSignature, key)
+}
+
+// verifyKeySignature checks a signature of message by a DER encoded key
+func verifyKeySignature(der []byte, message []byte, signature []byte) error{
+	key, err := parsePublicKey(der)
+	if err != nil{
+		return err
+	}
+
+	switch key := key.(type){
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, signature){
+			return fmt.Errorf("%w: bad Ed25519 signature", ErrInvalidSignature)
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if !verifyECDSA(key, digest[:], signature){
+			return fmt.Errorf("%w: bad ECDSA signature", ErrInvalidSignature)
+		}
+	}
+	return nil
+}
+
+func verifyECDSA(key *ecdsa.PublicKey, digest []byte, signature []byte) bool{
+	if len(signature) == 64{
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if ecdsa.Verify(key, digest, r, s){
+			return true
+		}
+	}
+	return ecdsa.VerifyASN1(key, digest, signature)
+}
+
+// signMessage signs message with an Ed25519 or ECDSA P-256 key and returns
+// the DER encoded public key with the signature
+func signMessage(signer crypto.Signer, message []byte) ([]byte, []byte, error){
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil{
+		return nil, nil, err
+	}
+
+	var signature []byte
+	switch signer.Public().(type){
+	case ed25519.PublicKey:
+		signature, err = signer.Sign(rand.Reader, message, crypto.Hash(0))
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		signature, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	default:
+		return nil, nil, fmt.Errorf("unsupported %T key", signer.Public())
+	}
+	if err != nil{
+		return nil, nil, err
+	}
+	return publicKey, signature, nil
+}
+
+// verifyDocuments checks the signature of every document of a block. The
+// documents of the genesis block and of the first release are not signed.
+func verifyDocuments(block *Block) error{
+	if len(block.PrevHash) == 0 || block.isFirstRelease(){
+		return nil
+	}
+	for i := range block.Data{
+		if err := block.Data[i].VerifySignature(); err != nil{
+			return fmt.Errorf("document %x: %w", block.Data[i].Hash, err)
+		}
+	}
+	return nil
+}
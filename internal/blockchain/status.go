@@ -0,0 +1,512 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Operations of a StatusTx
+const(
+	StatusRevoke = "revoke"
+	StatusSupersede = "supersede"
+)
+
+// maxReasonLen bounds the reason code of a StatusTx
+const maxReasonLen = 64
+
+const(
+	statusPrefix = "ds:"
+	replacementPrefix = "dr:"
+)
+
+// statusDomain separates status signatures from document and registry
+// signatures
+var statusDomain = []byte("bc/status/v1")
+
+// StatusTx revokes an anchored document, or marks it superseded by the
+// document with hash Replacement, for the reason given by a short code. It is
+// signed by the notary of the target document: with the key that signed the
+// document, or with the notary's current key when the notary is in the
+// registry. A document can only be revoked or superseded once.
+type StatusTx struct{
+	Op string `json:"op"`
+	// Target is the hash of the anchored document
+	Target []byte `json:"target"`
+	// Replacement is the hash of the new document, empty when revoking
+	Replacement []byte `json:"replacement,omitempty"`
+	Reason string `json:"reason"`
+	NotaryID string `json:"notaryId"`
+	Timestamp int64 `json:"timestamp"`
+	// PublicKey is the DER encoded key of the notary, and Signature its
+	// signature of SigningBytes
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+}
+
+// DocumentStatus is the revocation or supersession of a document, as applied
+// by a main chain block
+type DocumentStatus struct{
+	Op string `json:"op"`
+	Target []byte `json:"target"`
+	Replacement []byte `json:"replacement,omitempty"`
+	Reason string `json:"reason"`
+	Height uint64 `json:"height"`
+	BlockHash []byte `json:"blockHash"`
+	// Timestamp is the timestamp of the block that applied the transaction
+	Timestamp int64 `json:"timestamp"`
+	TxHash []byte `json:"txHash"`
+}
+
+// SigningBytes returns the canonical serialization of a transaction that the
+// notary signs: the domain followed by the operation, target, replacement,
+// reason and notary ID, each as a 4 byte big endian length and the bytes
+// themselves, and the timestamp as 8 big endian bytes
+func (tx *StatusTx) SigningBytes() []byte{
+	var buf bytes.Buffer
+	buf.Write(statusDomain)
+	for _, field := range [][]byte{
+		[]byte(tx.Op),
+		tx.Target,
+		tx.Replacement,
+		[]byte(tx.Reason),
+		[]byte(tx.NotaryID),
+	}{
+		binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	binary.Write(&buf, binary.BigEndian, tx.Timestamp)
+	return buf.Bytes()
+}
+
+// Hash identifies the transaction by its signed content
+func (tx *StatusTx) Hash() []byte{
+	hash := sha256.Sum256(tx.SigningBytes())
+	return hash[:]
+}
+
+// Sign sets PublicKey and Signature with an Ed25519 or ECDSA P-256 key
+func (tx *StatusTx) Sign(signer crypto.Signer) error{
+	publicKey, signature, err := signMessage(signer, tx.SigningBytes())
+	if err != nil{
+		return err
+	}
+	tx.PublicKey = publicKey
+	tx.Signature = signature
+	return nil
+}
+
+// Verify checks the fields of the transaction and its signature. Whether the
+// signer may change the status of the target is checked when its block is
+// connected.
+func (tx *StatusTx) Verify() error{
+	switch tx.Op{
+	case StatusRevoke:
+		if len(tx.Replacement) > 0{
+			return fmt.Errorf("%w: revoke carries a replacement", ErrInvalidStatusTx)
+		}
+	case StatusSupersede:
+		if len(tx.Replacement) == 0 || bytes.Equal(tx.Replacement, tx.Target){
+			return fmt.Errorf("%w: supersede needs a replacement other than the target", ErrInvalidStatusTx)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidStatusTx, tx.Op)
+	}
+	if len(tx.Target) == 0{
+		return fmt.Errorf("%w: missing target", ErrInvalidStatusTx)
+	}
+	if tx.Reason == "" || len(tx.Reason) > maxReasonLen{
+		return fmt.Errorf("%w: reason must be 1 to %d bytes", ErrInvalidStatusTx, maxReasonLen)
+	}
+	if tx.NotaryID == ""{
+		return fmt.Errorf("%w: missing notary ID", ErrInvalidStatusTx)
+	}
+	if err := verifyKeySignature(tx.PublicKey, tx.SigningBytes(), tx.Signature); err != nil{
+		return fmt.Errorf("%w: %v", ErrInvalidStatusTx, err)
+	}
+	return nil
+}
+
+// verifyStatuses checks the status transactions of a block
+func verifyStatuses(block *Block) error{
+	for i := range block.Statuses{
+		if err := block.Statuses[i].Verify(); err != nil{
+			return fmt.Errorf("status tx %x: %w", block.Statuses[i].Hash(), err)
+		}
+	}
+	return nil
+}
+
+// statusKey returns the badger key holding the status of a document
+func statusKey(target []byte) []byte{
+	return append([]byte(statusPrefix), target...)
+}
+
+// replacementKey returns the badger key recording that the document with
+// hash replacement supersedes the document with hash target. The replacement
+// is length prefixed, so that the keys of one replacement share the prefix
+// replacementKey(replacement, nil) whatever the length of the hashes.
+func replacementKey(replacement []byte, target []byte) []byte{
+	key := make([]byte, 0, len(replacementPrefix)+1+len(replacement)+len(target))
+	key = append(key, replacementPrefix...)
+	key = append(key, byte(len(replacement)))
+	key = append(key, replacement...)
+	return append(key, target...)
+}
+
+// supersededBy returns the hashes of the documents superseded by the
+// document with hash replacement
+func supersededBy(txn *badger.Txn, replacement []byte) ([][]byte, error){
+	targets := [][]byte{}
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = replacementKey(replacement, nil)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next(){
+		target, err := it.Item().ValueCopy(nil)
+		if err != nil{
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func encodeStatus(status *DocumentStatus) ([]byte, error){
+	var res bytes.Buffer
+	if err := gob.NewEncoder(&res).Encode(status); err != nil{
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+func decodeStatus(val []byte) (*DocumentStatus, error){
+	var status DocumentStatus
+	if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&status); err != nil{
+		return nil, fmt.Errorf("%w: document status: %v", ErrCorruptBlock, err)
+	}
+	return &status, nil
+}
+
+// getStatus returns the status of a document, or nil if it was neither
+// revoked nor superseded
+func getStatus(txn *badger.Txn, target []byte) (*DocumentStatus, error){
+	item, err := txn.Get(statusKey(target))
+	if err == badger.ErrKeyNotFound{
+		return nil, nil
+	}
+	if err != nil{
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil{
+		return nil, err
+	}
+	return decodeStatus(val)
+}
+
+// checkStatusTx checks that tx may change the status of its target, which
+// must be anchored on the main chain at or below height, not revoked or
+// superseded already, and belong to the notary that signed tx
+func checkStatusTx(txn *badger.Txn, tx *StatusTx, height uint64) error{
+	item, err := txn.Get(fileHashKey(tx.Target))
+	if err == badger.ErrKeyNotFound{
+		return fmt.Errorf("%w: document %x is not anchored", ErrInvalidStatusTx, tx.Target)
+	}
+	if err != nil{
+		return err
+	}
+	anchorHash, err := item.ValueCopy(nil)
+	if err != nil{
+		return err
+	}
+	anchor, err := getBlock(txn, anchorHash)
+	if err != nil{
+		return err
+	}
+	index := anchor.FindData(tx.Target)
+	if anchor.Height > height || index < 0{
+		return fmt.Errorf("%w: document %x is not anchored", ErrInvalidStatusTx, tx.Target)
+	}
+	target := &anchor.Data[index]
+
+	status, err := getStatus(txn, tx.Target)
+	if err != nil{
+		return err
+	}
+	if status != nil{
+		return fmt.Errorf("%w: document %x was already %s", ErrInvalidStatusTx, tx.Target, statusPast(status.Op))
+	}
+
+	if tx.NotaryID != target.NotaryID{
+		return fmt.Errorf("%w: document %x belongs to notary %s", ErrInvalidStatusTx, tx.Target, target.NotaryID)
+	}
+	record, err := notaryAt(txn, tx.NotaryID, height-1)
+	if err != nil{
+		return err
+	}
+	if record != nil{
+		if err := record.authorizes(&BlockData{NotaryID: tx.NotaryID, PublicKey: tx.PublicKey}); err != nil{
+			return fmt.Errorf("%w: %v", ErrInvalidStatusTx, err)
+		}
+	} else if !bytes.Equal(tx.PublicKey, target.PublicKey){
+		return fmt.Errorf("%w: not signed with the key of document %x", ErrInvalidStatusTx, tx.Target)
+	}
+	return nil
+}
+
+// statusPast returns the past participle of a status operation
+func statusPast(op string) string{
+	if op == StatusSupersede{
+		return "superseded"
+	}
+	return "revoked"
+}
+
+// checkStatuses checks the status transactions of a block on top of the
+// state after its parent, without applying them
+func checkStatuses(txn *badger.Txn, block *Block) error{
+	targets := map[string]bool{}
+	for i := range block.Statuses{
+		tx := &block.Statuses[i]
+		if targets[string(tx.Target)]{
+			return fmt.Errorf("status tx %x: %w: document %x changes twice", tx.Hash(), ErrInvalidStatusTx, tx.Target)
+		}
+		targets[string(tx.Target)] = true
+		if err := checkStatusTx(txn, tx, block.Height); err != nil{
+			return fmt.Errorf("status tx %x: %w", tx.Hash(), err)
+		}
+	}
+	return nil
+}
+
+// indexStatuses applies the status transactions of a block joining the main
+// chain inside txn, after its documents were indexed. A transaction that does
+// not apply rejects the block.
+func indexStatuses(txn *badger.Txn, block *Block) error{
+	for i := range block.Statuses{
+		tx := &block.Statuses[i]
+		if err := checkStatusTx(txn, tx, block.Height); err != nil{
+			return fmt.Errorf("status tx %x: %w", tx.Hash(), err)
+		}
+		val, err := encodeStatus(&DocumentStatus{
+			Op: tx.Op,
+			Target: tx.Target,
+			Replacement: tx.Replacement,
+			Reason: tx.Reason,
+			Height: block.Height,
+			BlockHash: block.Hash,
+			Timestamp: block.Timestamp,
+			TxHash: tx.Hash(),
+		})
+		if err != nil{
+			return err
+		}
+		if err := txn.Set(statusKey(tx.Target), val); err != nil{
+			return err
+		}
+		if len(tx.Replacement) > 0{
+			if err := txn.Set(replacementKey(tx.Replacement, tx.Target), tx.Target); err != nil{
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unindexStatuses reverts the status transactions of a block leaving the main
+// chain
+func unindexStatuses(txn *badger.Txn, block *Block) error{
+	for i := range block.Statuses{
+		tx := &block.Statuses[i]
+		status, err := getStatus(txn, tx.Target)
+		if err != nil{
+			return err
+		}
+		if status == nil || !bytes.Equal(status.TxHash, tx.Hash()){
+			continue
+		}
+		if err := txn.Delete(statusKey(tx.Target)); err != nil{
+			return err
+		}
+		if len(tx.Replacement) > 0{
+			if err := txn.Delete(replacementKey(tx.Replacement, tx.Target)); err != nil{
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ContainsStatusTx reports whether a status transaction was applied by a
+// main chain block
+func (chain *BlockChain) ContainsStatusTx(tx *StatusTx) (bool, error){
+	status, err := chain.DocumentStatus(tx.Target)
+	if err != nil{
+		return false, err
+	}
+	return status != nil && bytes.Equal(status.TxHash, tx.Hash()), nil
+}
+
+// CheckStatusTx checks a status transaction against the current tip
+func (chain *BlockChain) CheckStatusTx(tx *StatusTx) error{
+	if err := tx.Verify(); err != nil{
+		return err
+	}
+	return chain.Database.View(func(txn *badger.Txn) error{
+		_, height := chain.Tip()
+		return checkStatusTx(txn, tx, height+1)
+	})
+}
+
+// CheckStatusTxs splits status transactions into the ones that apply on top
+// of the current tip, keeping only the first one of each target, and the ones
+// that are invalid, already applied or no longer apply
+func (chain *BlockChain) CheckStatusTxs(txs []*StatusTx) ([]StatusTx, []*StatusTx){
+	var valid []StatusTx
+	var rejected []*StatusTx
+
+	targets := map[string]bool{}
+	for _, tx := range txs{
+		if targets[string(tx.Target)]{
+			// waits for the transaction before it to be mined or dropped
+			continue
+		}
+		if err := chain.CheckStatusTx(tx); err != nil{
+			rejected = append(rejected, tx)
+			continue
+		}
+		targets[string(tx.Target)] = true
+		valid = append(valid, *tx)
+	}
+	return valid, rejected
+}
+
+// DocumentStatus returns the revocation or supersession of a document, or
+// nil if it was neither revoked nor superseded
+func (chain *BlockChain) DocumentStatus(fileHash []byte) (*DocumentStatus, error){
+	var status *DocumentStatus
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		var err error
+		status, err = getStatus(txn, fileHash)
+		return err
+	})
+	return status, err
+}
+
+// Superseded returns the hashes of the documents superseded by the document
+// with the given hash, empty if it does not replace any
+func (chain *BlockChain) Superseded(fileHash []byte) ([][]byte, error){
+	var targets [][]byte
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		var err error
+		targets, err = supersededBy(txn, fileHash)
+		return err
+	})
+	return targets, err
+}
+
+// Events of a document history
+const(
+	EventAnchored = "anchored"
+	EventSupersedes = "supersedes"
+	EventSuperseded = "superseded"
+	EventRevoked = "revoked"
+)
+
+// DocumentEvent is a change of a document on the main chain. Document is the
+// hash of the other document of a supersession: the replacement for
+// EventSuperseded, the superseded document for EventSupersedes.
+type DocumentEvent struct{
+	Event string `json:"event"`
+	Height uint64 `json:"height"`
+	BlockHash []byte `json:"blockHash"`
+	Timestamp int64 `json:"timestamp"`
+	Document []byte `json:"document,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	TxHash []byte `json:"txHash,omitempty"`
+}
+
+// DocumentHistory returns the events of a document on the main chain, oldest
+// first: its anchoring, the supersessions of earlier documents by it, and its
+// own revocation or supersession. The history is empty for unknown documents.
+func (chain *BlockChain) DocumentHistory(fileHash []byte) ([]DocumentEvent, error){
+	events := []DocumentEvent{}
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		item, err := txn.Get(fileHashKey(fileHash))
+		if err != nil && err != badger.ErrKeyNotFound{
+			return err
+		}
+		if err == nil{
+			anchorHash, err := item.ValueCopy(nil)
+			if err != nil{
+				return err
+			}
+			anchor, err := getBlock(txn, anchorHash)
+			if err != nil{
+				return err
+			}
+			events = append(events, DocumentEvent{
+				Event: EventAnchored,
+				Height: anchor.Height,
+				BlockHash: anchor.Hash,
+				Timestamp: anchor.Timestamp,
+			})
+		}
+
+		superseded, err := supersededBy(txn, fileHash)
+		if err != nil{
+			return err
+		}
+		for _, target := range superseded{
+			status, err := getStatus(txn, target)
+			if err != nil{
+				return err
+			}
+			if status != nil{
+				events = append(events, status.event(EventSupersedes, target))
+			}
+		}
+
+		status, err := getStatus(txn, fileHash)
+		if err != nil{
+			return err
+		}
+		if status != nil && status.Op == StatusSupersede{
+			events = append(events, status.event(EventSuperseded, status.Replacement))
+		} else if status != nil{
+			events = append(events, status.event(EventRevoked, nil))
+		}
+		return nil
+	})
+	if err != nil{
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool{
+		return events[i].Height < events[j].Height
+	})
+	return events, nil
+}
+
+func (status *DocumentStatus) event(event string, document []byte) DocumentEvent{
+	return DocumentEvent{
+		Event: event,
+		Height: status.Height,
+		BlockHash: status.BlockHash,
+		Timestamp: status.Timestamp,
+		Document: document,
+		Reason: status.Reason,
+		TxHash: status.TxHash,
+	}
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func supersede(t *testing.T, target BlockData, replacement []byte, timestamp int64) StatusTx{
+	t.Helper()
+	tx := StatusTx{
+		Op: StatusSupersede,
+		Target: target.Hash,
+		Replacement: replacement,
+		Reason: "merged",
+		NotaryID: target.NotaryID,
+		Timestamp: timestamp,
+	}
+	if err := tx.Sign(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))); err != nil{
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestReplacementOfSeveralDocuments(t *testing.T){
+	chain := devChain(t)
+	ctx := context.Background()
+	deed, will := document(t, "deed.pdf"), document(t, "will.pdf")
+	merged := document(t, "merged.pdf").Hash
+	if _, err := chain.CreateInsertBlock(ctx, []BlockData{deed, will}, nil, nil); err != nil{
+		t.Fatal(err)
+	}
+	if _, err := chain.CreateInsertBlock(ctx, nil, nil, []StatusTx{supersede(t, deed, merged, 1)}); err != nil{
+		t.Fatal(err)
+	}
+	second, err := chain.CreateInsertBlock(ctx, nil, nil, []StatusTx{supersede(t, will, merged, 2)})
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	superseded := func(want ...[]byte){
+		t.Helper()
+		got, err := chain.Superseded(merged)
+		if err != nil{
+			t.Fatal(err)
+		}
+		targets := map[string]bool{}
+		for _, target := range got{
+			targets[string(target)] = true
+		}
+		for _, target := range want{
+			if !targets[string(target)]{
+				t.Fatalf("merged.pdf supersedes %x, want %x", got, want)
+			}
+		}
+		if len(got) != len(want){
+			t.Fatalf("merged.pdf supersedes %x, want %x", got, want)
+		}
+		events, err := chain.DocumentHistory(merged)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if len(events) != len(want){
+			t.Fatalf("history of merged.pdf has %d events, want %d", len(events), len(want))
+		}
+	}
+	superseded(deed.Hash, will.Hash)
+
+	err = chain.Database.Update(func(txn *badger.Txn) error{
+		return unindexStatuses(txn, second)
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	superseded(deed.Hash)
+}
@@ -0,0 +1,276 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Names of the checks run by Verify, reported in VerifyIssue.Check
+const(
+	CheckSeal = "seal"
+	CheckDifficulty = "difficulty"
+	CheckHash = "hash"
+	CheckMerkle = "merkle"
+	CheckSignature = "signature"
+	CheckRegistry = "registry"
+	CheckStatus = "status"
+	CheckLink = "link"
+	CheckVersion = "version"
+	CheckTimestamp = "timestamp"
+	CheckIndex = "index"
+	CheckWork = "work"
+)
+
+// maxClockDrift is how far in the future a block timestamp may be before the
+// block is refused, and before Verify reports it
+const maxClockDrift = 2 * time.Minute
+
+// VerifyIssue describes a single failed check of a stored block
+type VerifyIssue struct{
+	Height uint64 `json:"height"`
+	Hash string `json:"hash"`
+	Check string `json:"check"`
+	Message string `json:"message"`
+}
+
+// VerifyReport is the result of a full chain verification
+type VerifyReport struct{
+	Valid bool `json:"valid"`
+	TipHash string `json:"tipHash"`
+	Height uint64 `json:"height"`
+	BlocksChecked uint64 `json:"blocksChecked"`
+	Issues []VerifyIssue `json:"issues"`
+	StartedAt int64 `json:"startedAt"`
+	Duration int64 `json:"durationMs"`
+}
+
+func (r *VerifyReport) add(height uint64, hash []byte, check string, format string, args ...any){
+	r.Valid = false
+	r.Issues = append(r.Issues, VerifyIssue{
+		Height: height,
+		Hash: hex.EncodeToString(hash),
+		Check: check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Verify walks the main chain from the tip back to genesis and checks the
+// seal and consensus fields with the chain's engine, the stored hash against the recomputed
+// one, the merkle root against the block data, the document signatures, the
+// registry and status transaction signatures, the PrevHash and height
+// linkage, that schema versions do not decrease, timestamp monotonicity, and
+// that the height, file hash and work indexes agree with the blocks. Failed
+// checks are collected in the report; an error is only returned when the
+// database cannot be read.
+func (chain *BlockChain) Verify() (*VerifyReport, error){
+	start := time.Now()
+	lastHash, height := chain.Tip()
+
+	report := &VerifyReport{
+		Valid: true,
+		TipHash: hex.EncodeToString(lastHash),
+		Height: height,
+		Issues: []VerifyIssue{},
+		StartedAt: start.UnixMilli(),
+	}
+
+	_, err := chain.GetBlockHashByHeight(height+1)
+	if err == nil{
+		report.add(height+1, nil, CheckIndex, "height index has an entry above the tip")
+	} else if !errors.Is(err, ErrBlockNotFound){
+		return nil, err
+	}
+
+	var child *Block
+	var childWork *big.Int
+	iter := &BlockChainIterator{lastHash, chain.Database}
+	for{
+		expected := height
+		if child != nil{
+			expected = child.Height - 1
+		}
+
+		block, err := iter.Next()
+		if errors.Is(err, ErrBlockNotFound) || errors.Is(err, ErrCorruptBlock){
+			report.add(expected, iter.CurrentHash, CheckLink, "cannot load block: %v", err)
+			break
+		}
+		if err != nil{
+			return nil, err
+		}
+		report.BlocksChecked++
+
+		work, err := chain.verifyBlock(report, block, child, childWork)
+		if err != nil{
+			return nil, err
+		}
+
+		if len(block.PrevHash) == 0{
+			if block.Height != 0{
+				report.add(block.Height, block.Hash, CheckLink, "block without parent at height %d", block.Height)
+			}
+			break
+		}
+		if block.Height == 0{
+			report.add(block.Height, block.Hash, CheckLink, "block at height 0 has a parent")
+			break
+		}
+		child = block
+		childWork = work
+	}
+
+	report.Duration = time.Since(start).Milliseconds()
+	return report, nil
+}
+
+// verifyBlock runs the per-block checks of Verify and returns the stored
+// cumulative work of block, or nil if it is missing
+func (chain *BlockChain) verifyBlock(report *VerifyReport, block *Block, child *Block, childWork *big.Int) (*big.Int, error){
+	if computed := chain.engine.Hash(block); !bytes.Equal(computed, block.Hash){
+		report.add(block.Height, block.Hash, CheckHash, "stored hash differs from recomputed hash %x", computed)
+	} else if err := chain.engine.VerifySeal(block); err != nil{
+		report.add(block.Height, block.Hash, CheckSeal, "%v", err)
+	}
+	if err := chain.verifyHeader(report, block); err != nil{
+		return nil, err
+	}
+	if !block.HasValidMerkleRoot(){
+		report.add(block.Height, block.Hash, CheckMerkle, "merkle root does not match the block data")
+	}
+	if err := verifyDocuments(block); err != nil{
+		report.add(block.Height, block.Hash, CheckSignature, "%v", err)
+	}
+	if err := verifyNotaries(block, chain.admins); err != nil{
+		report.add(block.Height, block.Hash, CheckRegistry, "%v", err)
+	}
+	if err := verifyStatuses(block); err != nil{
+		report.add(block.Height, block.Hash, CheckStatus, "%v", err)
+	}
+
+	if child == nil{
+		if limit := time.Now().Add(maxClockDrift).UnixMilli(); block.Timestamp > limit{
+			report.add(block.Height, block.Hash, CheckTimestamp, "timestamp %d is in the future", block.Timestamp)
+		}
+	} else {
+		if child.Height != block.Height+1{
+			report.add(child.Height, child.Hash, CheckLink, "height %d does not follow parent height %d", child.Height, block.Height)
+		}
+		if err := checkVersion(block, child); err != nil{
+			report.add(child.Height, child.Hash, CheckVersion, "%v", err)
+		}
+		if child.Timestamp < block.Timestamp{
+			report.add(child.Height, child.Hash, CheckTimestamp, "timestamp %d is older than parent timestamp %d", child.Timestamp, block.Timestamp)
+		}
+	}
+
+	indexed, err := chain.GetBlockHashByHeight(block.Height)
+	if err != nil && !errors.Is(err, ErrBlockNotFound){
+		return nil, err
+	}
+	if !bytes.Equal(indexed, block.Hash){
+		report.add(block.Height, block.Hash, CheckIndex, "height index points to %x", indexed)
+	}
+
+	for i := range block.Data{
+		if len(block.Data[i].Hash) == 0{
+			continue
+		}
+		if err := chain.verifyFileIndex(report, block, &block.Data[i]); err != nil{
+			return nil, err
+		}
+	}
+
+	work, err := chain.Work(block.Hash)
+	if errors.Is(err, ErrBlockNotFound){
+		report.add(block.Height, block.Hash, CheckWork, "cumulative work is missing")
+		return nil, nil
+	}
+	if err != nil{
+		return nil, err
+	}
+
+	expected := chain.engine.Work(block)
+	if len(block.PrevHash) == 0 && work.Cmp(expected) != 0{
+		report.add(block.Height, block.Hash, CheckWork, "cumulative work %s, expected %s", work, expected)
+	}
+	if child != nil && childWork != nil{
+		expected = new(big.Int).Add(work, chain.engine.Work(child))
+		if childWork.Cmp(expected) != 0{
+			report.add(child.Height, child.Hash, CheckWork, "cumulative work %s, expected %s", childWork, expected)
+		}
+	}
+
+	return work, nil
+}
+
+// verifyHeader checks the difficulty of the genesis block against the
+// network's initial difficulty, and the consensus fields of any other block
+// against its parent with the chain's engine
+func (chain *BlockChain) verifyHeader(report *VerifyReport, block *Block) error{
+	if len(block.PrevHash) == 0{
+		expected := chain.params.InitialDifficulty
+		if block.isFirstRelease(){
+			expected = firstReleaseDifficulty
+		}
+		if block.Difficulty != expected{
+			report.add(block.Height, block.Hash, CheckDifficulty, "difficulty %d, expected %d", block.Difficulty, expected)
+		}
+		return nil
+	}
+
+	err := chain.Database.View(func(txn *badger.Txn) error{
+		parent, err := getBlock(txn, block.PrevHash)
+		if err != nil{
+			return err
+		}
+		return chain.engine.VerifyHeader(txnReader{txn}, parent, block)
+	})
+	switch{
+	case errors.Is(err, ErrInvalidDifficulty) || errors.Is(err, ErrInvalidSeal) || errors.Is(err, ErrSignedRecently):
+		report.add(block.Height, block.Hash, CheckDifficulty, "%v", err)
+	case errors.Is(err, ErrInvalidTimestamp):
+		// reported by the timestamp checks of verifyBlock
+	case errors.Is(err, ErrBlockNotFound) || errors.Is(err, ErrCorruptBlock):
+		// reported by the link check of the parent
+	case err != nil:
+		return err
+	}
+	return nil
+}
+
+// verifyFileIndex checks that a document of block is indexed, either to the
+// block itself or to another main chain block anchoring the same hash
+func (chain *BlockChain) verifyFileIndex(report *VerifyReport, block *Block, data *BlockData) error{
+	anchor, err := chain.GetBlockHashByFileHash(data.Hash)
+	if errors.Is(err, ErrBlockNotFound){
+		report.add(block.Height, block.Hash, CheckIndex, "document %x is not indexed", data.Hash)
+		return nil
+	}
+	if err != nil || bytes.Equal(anchor, block.Hash){
+		return err
+	}
+
+	other, err := chain.GetBlockByHash(anchor)
+	if errors.Is(err, ErrBlockNotFound) || errors.Is(err, ErrCorruptBlock){
+		report.add(block.Height, block.Hash, CheckIndex, "document %x is indexed to unreadable block %x", data.Hash, anchor)
+		return nil
+	}
+	if err != nil{
+		return err
+	}
+
+	main, err := chain.GetBlockHashByHeight(other.Height)
+	if err != nil && !errors.Is(err, ErrBlockNotFound){
+		return err
+	}
+	if !bytes.Equal(main, other.Hash) || other.FindData(data.Hash) < 0{
+		report.add(block.Height, block.Hash, CheckIndex, "document %x is indexed to block %x outside the main chain", data.Hash, anchor)
+	}
+	return nil
+}
@@ -2,83 +2,155 @@ package cli
 
 import (
 	"blockchain-service/internal/blockchain"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
 	"flag"
 	"fmt"
-	"os"
-	"runtime"
 	"strconv"
 )
 
+// ErrUsage is returned by Run when the arguments do not form a valid command
+var ErrUsage = errors.New("invalid arguments")
+
+// ErrChainInvalid is returned by Run when the verify command finds issues
+var ErrChainInvalid = errors.New("chain verification failed")
+
 type CommandLine struct{
 	blockchain *blockchain.BlockChain
 }
 
+func NewCommandLine(chain *blockchain.BlockChain) *CommandLine{
+	return &CommandLine{chain}
+}
+
 func (cli *CommandLine) printUsage(){
 	fmt.Println("Usage: ")
 	fmt.Println(" add -block BLOCK_DATA  -- Add a block to the blockchain")
 	fmt.Println(" print  -- Print the blocks in the chain")
+	fmt.Println(" verify  -- Check the integrity of the whole chain")
 }
 
-func (cli *CommandLine) validateArgs(){
-	if len(os.Args) < 2{
+func (cli *CommandLine) validateArgs(args []string) error{
+	if len(args) < 1{
 		cli.printUsage()
-		runtime.Goexit()
+		return ErrUsage
 	}
+	return nil
 }
 
-func (cli *CommandLine) addBlock(data string){
-	cli.blockchain.AddBlock(data)
+// addBlock adds a block with a single document. Documents must be signed, so
+// it is signed with a throwaway key.
+func (cli *CommandLine) addBlock(data string) error{
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil{
+		return fmt.Errorf("generate key: %w", err)
+	}
+	blockData := blockchain.BlockData{DocumentID: data}
+	if err := blockData.Sign(key); err != nil{
+		return fmt.Errorf("sign document: %w", err)
+	}
+
+	_, err = cli.blockchain.CreateInsertBlock(context.Background(), []blockchain.BlockData{blockData}, nil, nil)
+	if err != nil{
+		return fmt.Errorf("add block: %w", err)
+	}
 	fmt.Println("Block Added!")
+	return nil
 }
 
-func (cli *CommandLine) printChain(){
+func (cli *CommandLine) printChain() error{
 	iter := cli.blockchain.Iterator()
 
 	for{
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil{
+			return fmt.Errorf("read block: %w", err)
+		}
 
 		fmt.Printf("Prev Hash: %x\n", block.PrevHash)
-		fmt.Printf("Data: %s\n", block.Data)
+		fmt.Printf("Merkle Root: %x\n", block.MerkleRoot)
+		for _, data := range block.Data{
+			fmt.Printf("Data: %s\n", data.DocumentID)
+		}
 		fmt.Printf("Hash: %x\n", block.Hash)
-		
-		pow := blockchain.NewProof(block)
-		fmt.Printf("Pow: %s\n\n", strconv.FormatBool(pow.Validate()))
+
+		err = cli.blockchain.Engine().VerifySeal(block)
+		fmt.Printf("Seal: %s\n\n", strconv.FormatBool(err == nil))
 
 		if len(block.PrevHash) == 0{
 			break
 		}
 	}
+	return nil
 }
 
-func (cli *CommandLine) run(){
-	cli.validateArgs()
+func (cli *CommandLine) verifyChain() error{
+	report, err := cli.blockchain.Verify()
+	if err != nil{
+		return fmt.Errorf("verify chain: %w", err)
+	}
+
+	fmt.Printf(
+		"Checked %d blocks up to height %d (tip %s) in %dms\n",
+		report.BlocksChecked, report.Height, report.TipHash, report.Duration,
+	)
+	for _, issue := range report.Issues{
+		fmt.Printf(" [%s] height %d %s: %s\n", issue.Check, issue.Height, issue.Hash, issue.Message)
+	}
+
+	if !report.Valid{
+		return fmt.Errorf("%w: %d issues", ErrChainInvalid, len(report.Issues))
+	}
+	fmt.Println("Chain OK")
+	return nil
+}
+
+// Run executes the command given in args, without the program name
+func (cli *CommandLine) Run(args []string) error{
+	if err := cli.validateArgs(args); err != nil{
+		return err
+	}
 
 	addBlockCmd := flag.NewFlagSet("add", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("print", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verify", flag.ExitOnError)
 	addBlockData := addBlockCmd.String("block", "", "BlockData")
 
-	switch os.Args[1]{
+	switch args[0]{
 		case "add":
-			err := addBlockCmd.Parse(os.Args[2:])
-			blockchain.Handle(err)
+			if err := addBlockCmd.Parse(args[1:]); err != nil{
+				return err
+			}
 		case "print":
-			err := printChainCmd.Parse(os.Args[2:])
-			blockchain.Handle(err)
+			if err := printChainCmd.Parse(args[1:]); err != nil{
+				return err
+			}
+		case "verify":
+			if err := verifyChainCmd.Parse(args[1:]); err != nil{
+				return err
+			}
 		default:
 			cli.printUsage()
-			runtime.Goexit()
+			return ErrUsage
 	}
 
 	if addBlockCmd.Parsed(){
 		if *addBlockData == ""{
 			cli.printUsage()
-			runtime.Goexit()
+			return ErrUsage
 		}
 
-		cli.blockchain.AddBlock(*addBlockData)
+		return cli.addBlock(*addBlockData)
 	}
 
 	if printChainCmd.Parsed(){
-		cli.printChain()
+		return cli.printChain()
+	}
+
+	if verifyChainCmd.Parsed(){
+		return cli.verifyChain()
 	}
+	return nil
 }
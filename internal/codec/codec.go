@@ -0,0 +1,238 @@
+// Package codec writes and reads the canonical protobuf encoding of the
+// messages in proto/. A message has a single valid encoding: fields are
+// written in ascending field number, repeated fields contiguously and in
+// order, scalars holding their default value (zero, false or empty) are left
+// out, and varints use the fewest bytes. Any protobuf library can read the
+// encoding; the Decoder refuses fields out of order, unknown wire types and
+// overlong varints, and callers re-encode what they decoded to refuse
+// anything else that is not canonical.
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrMalformed is returned for input that is not the canonical encoding of
+// the expected message
+var ErrMalformed = errors.New("malformed encoding")
+
+// Encoder appends the fields of a message in the canonical form. Fields must
+// be added in ascending field number.
+type Encoder struct{
+	buf []byte
+}
+
+// Encoded returns the encoded message
+func (e *Encoder) Encoded() []byte{
+	return e.buf
+}
+
+func (e *Encoder) Uint(num protowire.Number, v uint64){
+	if v == 0{
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.VarintType)
+	e.buf = protowire.AppendVarint(e.buf, v)
+}
+
+// Int writes a protobuf int64: negative values take ten bytes
+func (e *Encoder) Int(num protowire.Number, v int64){
+	e.Uint(num, uint64(v))
+}
+
+func (e *Encoder) Bool(num protowire.Number, v bool){
+	if v{
+		e.Uint(num, 1)
+	}
+}
+
+func (e *Encoder) Bytes(num protowire.Number, v []byte){
+	if len(v) == 0{
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, v)
+}
+
+func (e *Encoder) Text(num protowire.Number, v string){
+	if len(v) == 0{
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendString(e.buf, v)
+}
+
+// Message writes an embedded message. Unlike scalars it is written even when
+// empty, so that every element of a repeated field is kept.
+func (e *Encoder) Message(num protowire.Number, v []byte){
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, v)
+}
+
+// Len returns the number of bytes encoded so far
+func (e *Encoder) Len() int{
+	return len(e.buf)
+}
+
+// Truncate drops what was encoded after the first n bytes, so that the
+// fields following them can be written again
+func (e *Encoder) Truncate(n int){
+	e.buf = e.buf[:n]
+}
+
+// Append writes fields encoded by another Encoder, which must come after the
+// fields written so far
+func (e *Encoder) Append(encoded []byte){
+	e.buf = append(e.buf, encoded...)
+}
+
+// Decoder reads the fields of a message in order:
+//
+//	for d.More(){
+//		switch d.Field(){
+//		case 1:
+//			x.A = d.Uint()
+//		default:
+//			d.Skip()
+//		}
+//	}
+//	return d.Err()
+//
+// The first error sticks; the readers return zero values after it.
+type Decoder struct{
+	buf []byte
+	num protowire.Number
+	typ protowire.Type
+	err error
+}
+
+func NewDecoder(b []byte) *Decoder{
+	return &Decoder{buf: b}
+}
+
+// Err returns the first error met while decoding
+func (d *Decoder) Err() error{
+	return d.err
+}
+
+func (d *Decoder) fail(format string, args ...any){
+	if d.err == nil{
+		d.err = fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+	}
+	d.buf = nil
+}
+
+// More reports whether fields are left to read
+func (d *Decoder) More() bool{
+	return d.err == nil && len(d.buf) > 0
+}
+
+// Field reads the next tag and returns its field number. Field numbers must
+// not decrease; the same number repeats for repeated fields.
+func (d *Decoder) Field() protowire.Number{
+	num, typ, n := protowire.ConsumeTag(d.buf)
+	if n < 0{
+		d.fail("field tag: %v", protowire.ParseError(n))
+		return 0
+	}
+	if num < d.num{
+		d.fail("field %d after field %d", num, d.num)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	d.num = num
+	d.typ = typ
+	return num
+}
+
+func (d *Decoder) varint() uint64{
+	if d.typ != protowire.VarintType{
+		d.fail("field %d is not a varint", d.num)
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(d.buf)
+	if n < 0{
+		d.fail("field %d: %v", d.num, protowire.ParseError(n))
+		return 0
+	}
+	if n != protowire.SizeVarint(v){
+		d.fail("field %d: overlong varint", d.num)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *Decoder) Uint() uint64{
+	return d.varint()
+}
+
+// Uint32 reads a uint32 field, refusing larger values
+func (d *Decoder) Uint32() uint32{
+	v := d.varint()
+	if v > 1<<32-1{
+		d.fail("field %d: %d overflows uint32", d.num, v)
+		return 0
+	}
+	return uint32(v)
+}
+
+func (d *Decoder) Int() int64{
+	return int64(d.varint())
+}
+
+func (d *Decoder) Bool() bool{
+	v := d.varint()
+	if v > 1{
+		d.fail("field %d: %d is not a bool", d.num, v)
+		return false
+	}
+	return v == 1
+}
+
+func (d *Decoder) bytes() []byte{
+	if d.typ != protowire.BytesType{
+		d.fail("field %d is not length delimited", d.num)
+		return nil
+	}
+	v, n := protowire.ConsumeBytes(d.buf)
+	if n < 0{
+		d.fail("field %d: %v", d.num, protowire.ParseError(n))
+		return nil
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// Bytes reads a bytes field into a copy of its value
+func (d *Decoder) Bytes() []byte{
+	return bytes.Clone(d.bytes())
+}
+
+func (d *Decoder) Text() string{
+	return string(d.bytes())
+}
+
+// Message returns the encoding of an embedded message, to decode with a
+// Decoder of its own
+func (d *Decoder) Message() []byte{
+	return d.bytes()
+}
+
+// Skip refuses the current field: a canonical message has no unknown fields
+func (d *Decoder) Skip(){
+	d.fail("unknown field %d", d.num)
+}
+
+// Canonical checks that encoded, the re-encoding of a decoded message, is the
+// input it was decoded from
+func Canonical(input []byte, encoded []byte) error{
+	if !bytes.Equal(input, encoded){
+		return fmt.Errorf("%w: not the canonical encoding", ErrMalformed)
+	}
+	return nil
+}
@@ -2,15 +2,33 @@ package models
 
 import (
 	"blockchain-service/internal/blockchain"
+	"encoding/base64"
 	"encoding/hex"
+
+	"github.com/libp2p/go-libp2p/core/peer"
 ) 
 
 type BlockAPI struct{
+	Version uint32 `json:"version"`
 	Hash string `json:"hash"`
 	PrevHash string `json:"prevHash"`
 	Nonce int `json:"nonce"`
+	Difficulty uint32 `json:"difficulty"`
+	Height uint64 `json:"height"`
 	Timestamp int64 `json:"timestamp"`
-	Data BlockDataAPI `json:"data"`
+	MerkleRoot string `json:"merkleRoot"`
+	Signer string `json:"signer,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Commit []CommitSigAPI `json:"commit,omitempty"`
+	Data []BlockDataAPI `json:"data"`
+	Notaries []NotaryTxAPI `json:"notaries,omitempty"`
+	Statuses []StatusTxAPI `json:"statuses,omitempty"`
+}
+
+type CommitSigAPI struct{
+	Validator string `json:"validator"`
+	Round uint32 `json:"round"`
+	Signature string `json:"signature"`
 }
 
 type BlockDataAPI struct{
@@ -19,10 +37,20 @@ type BlockDataAPI struct{
 	NotaryID string `json:"notaryId"`
 	UserID string `json:"userId"`
 	CNPJ string `json:"cnpj"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
 }
 
 func (bd *BlockDataAPI) ToBlockData() (*blockchain.BlockData, error){
-	hashBytes, err := hex.DecodeString(bd.Hash)
+	hashBytes, err := blockchain.ParseHashString(bd.Hash)
+	if err != nil{
+		return nil, err
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(bd.PublicKey)
+	if err != nil{
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(bd.Signature)
 	if err != nil{
 		return nil, err
 	}
@@ -32,19 +60,23 @@ func (bd *BlockDataAPI) ToBlockData() (*blockchain.BlockData, error){
 		NotaryID: bd.NotaryID,
 		UserID: bd.UserID,
 		CNPJ: bd.CNPJ,
+		PublicKey: publicKey,
+		Signature: signature,
 	}
 
 	return &blockData, nil
 }
 
 func FromBlockData(data *blockchain.BlockData) BlockDataAPI{
-	hashString := hex.EncodeToString(data.Hash)
+	hashString := blockchain.FormatHash(data.Hash)
 	blockAPI := BlockDataAPI{
 		Hash: hashString,
 		DocumentID: data.DocumentID,
 		NotaryID: data.NotaryID,
 		UserID: data.UserID,
 		CNPJ: data.CNPJ,
+		PublicKey: base64.StdEncoding.EncodeToString(data.PublicKey),
+		Signature: base64.StdEncoding.EncodeToString(data.Signature),
 	}
 
 	return blockAPI
@@ -53,15 +85,62 @@ func FromBlockData(data *blockchain.BlockData) BlockDataAPI{
 func FromBlock(block *blockchain.Block) BlockAPI{
 	hashString := hex.EncodeToString(block.Hash)
 	prevHashString := hex.EncodeToString(block.PrevHash)
-	dataAPI := FromBlockData(&block.Data)
+	dataAPI := make([]BlockDataAPI, 0, len(block.Data))
+	for i := range block.Data{
+		dataAPI = append(dataAPI, FromBlockData(&block.Data[i]))
+	}
 
 	blockAPI := BlockAPI{
+		Version: block.Version,
 		Hash: hashString,
 		PrevHash: prevHashString,
 		Nonce: block.Nonce,
+		Difficulty: block.Difficulty,
+		Height: block.Height,
 		Timestamp: block.Timestamp,
+		MerkleRoot: hex.EncodeToString(block.MerkleRoot),
 		Data: dataAPI,
 	}
+	for i := range block.Notaries{
+		blockAPI.Notaries = append(blockAPI.Notaries, FromNotaryTx(&block.Notaries[i]))
+	}
+	for i := range block.Statuses{
+		blockAPI.Statuses = append(blockAPI.Statuses, FromStatusTx(&block.Statuses[i]))
+	}
+	if len(block.Signer) > 0{
+		// the signer is a libp2p peer ID, shown in its usual encoding
+		if signer, err := peer.IDFromBytes(block.Signer); err == nil{
+			blockAPI.Signer = signer.String()
+		}
+		blockAPI.Signature = base64.StdEncoding.EncodeToString(block.Signature)
+	}
+	for _, sig := range block.Commit{
+		commitAPI := CommitSigAPI{
+			Round: sig.Round,
+			Signature: base64.StdEncoding.EncodeToString(sig.Signature),
+		}
+		if validator, err := peer.IDFromBytes(sig.Validator); err == nil{
+			commitAPI.Validator = validator.String()
+		}
+		blockAPI.Commit = append(blockAPI.Commit, commitAPI)
+	}
 
 	return blockAPI
 }
+
+type BlockPageAPI struct{
+	Blocks []BlockAPI `json:"blocks"`
+	NextCursor *uint64 `json:"nextCursor"`
+}
+
+func FromBlockPage(page *blockchain.BlockPage) BlockPageAPI{
+	blocks := make([]BlockAPI, 0, len(page.Blocks))
+	for _, block := range page.Blocks{
+		blocks = append(blocks, FromBlock(block))
+	}
+
+	return BlockPageAPI{
+		Blocks: blocks,
+		NextCursor: page.NextCursor,
+	}
+}
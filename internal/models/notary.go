@@ -0,0 +1,112 @@
+package models
+
+import (
+	"blockchain-service/internal/blockchain"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NotaryTxAPI is a notary registry transaction. Keys are base64 encoded DER
+// SubjectPublicKeyInfo, and Timestamp is in milliseconds.
+type NotaryTxAPI struct{
+	Op string `json:"op"`
+	NotaryID string `json:"notaryId"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Timestamp int64 `json:"timestamp"`
+	Admin string `json:"admin"`
+	Signature string `json:"signature"`
+}
+
+func (tx *NotaryTxAPI) ToNotaryTx() (*blockchain.NotaryTx, error){
+	publicKey, err := base64.StdEncoding.DecodeString(tx.PublicKey)
+	if err != nil{
+		return nil, err
+	}
+	admin, err := base64.StdEncoding.DecodeString(tx.Admin)
+	if err != nil{
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(tx.Signature)
+	if err != nil{
+		return nil, err
+	}
+	notaryTx := blockchain.NotaryTx{
+		Op: tx.Op,
+		NotaryID: tx.NotaryID,
+		PublicKey: publicKey,
+		Timestamp: tx.Timestamp,
+		Admin: admin,
+		Signature: signature,
+	}
+
+	return &notaryTx, nil
+}
+
+func FromNotaryTx(tx *blockchain.NotaryTx) NotaryTxAPI{
+	return NotaryTxAPI{
+		Op: tx.Op,
+		NotaryID: tx.NotaryID,
+		PublicKey: base64.StdEncoding.EncodeToString(tx.PublicKey),
+		Timestamp: tx.Timestamp,
+		Admin: base64.StdEncoding.EncodeToString(tx.Admin),
+		Signature: base64.StdEncoding.EncodeToString(tx.Signature),
+	}
+}
+
+// NotaryRecordAPI is the registry state of a notary after a transaction
+type NotaryRecordAPI struct{
+	NotaryID string `json:"notaryId"`
+	PublicKey string `json:"publicKey"`
+	Status string `json:"status"`
+	Height uint64 `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+	TxHash string `json:"txHash"`
+}
+
+func FromNotaryRecord(record *blockchain.NotaryRecord) NotaryRecordAPI{
+	return NotaryRecordAPI{
+		NotaryID: record.NotaryID,
+		PublicKey: base64.StdEncoding.EncodeToString(record.PublicKey),
+		Status: record.Status,
+		Height: record.Height,
+		Timestamp: record.Timestamp,
+		TxHash: hex.EncodeToString(record.TxHash),
+	}
+}
+
+// NotaryAPI is the current registry record of a notary and every record it
+// had, oldest first
+type NotaryAPI struct{
+	Current NotaryRecordAPI `json:"current"`
+	History []NotaryRecordAPI `json:"history"`
+}
+
+func FromNotaryHistory(history []*blockchain.NotaryRecord) NotaryAPI{
+	records := make([]NotaryRecordAPI, 0, len(history))
+	for _, record := range history{
+		records = append(records, FromNotaryRecord(record))
+	}
+
+	return NotaryAPI{
+		Current: records[len(records)-1],
+		History: records,
+	}
+}
+
+// NotaryStatusAPI tells whether a document's notary was active in the
+// registry with the key that signed the document, in the registry state
+// before the anchoring block. Record is that state, if the notary was
+// registered by then.
+type NotaryStatusAPI struct{
+	Authorized bool `json:"authorized"`
+	Record *NotaryRecordAPI `json:"record,omitempty"`
+}
+
+func FromNotaryStatus(record *blockchain.NotaryRecord, authorized bool) NotaryStatusAPI{
+	status := NotaryStatusAPI{Authorized: authorized}
+	if record != nil{
+		recordAPI := FromNotaryRecord(record)
+		status.Record = &recordAPI
+	}
+	return status
+}
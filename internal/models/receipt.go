@@ -0,0 +1,118 @@
+package models
+
+import (
+	"blockchain-service/internal/blockchain"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// ReceiptVersion is the version of the receipt payload format
+const ReceiptVersion = 1
+
+// AnchorAPI describes where and when a document was anchored
+type AnchorAPI struct{
+	// Version is the schema version of the block, which the merkle leaves
+	// depend on
+	Version uint32 `json:"version"`
+	BlockHash string `json:"blockHash"`
+	Height uint64 `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+	Nonce int `json:"nonce"`
+	Difficulty uint32 `json:"difficulty"`
+	Confirmations uint64 `json:"confirmations"`
+	MerkleRoot string `json:"merkleRoot"`
+	MerkleProof []MerkleStepAPI `json:"merkleProof"`
+	Data BlockDataAPI `json:"data"`
+	// Notary tells whether the notary was authorized by the registry when
+	// the document was anchored, when the registry is enabled
+	Notary *NotaryStatusAPI `json:"notary,omitempty"`
+}
+
+// MerkleStepAPI is one level of the inclusion path of a document, from the
+// leaf up to the block's merkle root
+type MerkleStepAPI struct{
+	Hash string `json:"hash"`
+	Left bool `json:"left"`
+}
+
+// VerifyResponseAPI reports whether a document is anchored, its current
+// Status and the History of its events on the chain
+type VerifyResponseAPI struct{
+	Result bool `json:"result"`
+	Status string `json:"status"`
+	History []DocumentEventAPI `json:"history"`
+	Anchor *AnchorAPI `json:"anchor,omitempty"`
+	Receipt *ReceiptAPI `json:"receipt,omitempty"`
+}
+
+// ReceiptPayloadAPI is the signed content of a receipt. It carries the full
+// anchoring block so that its proof can be rechecked offline.
+type ReceiptPayloadAPI struct{
+	Version int `json:"version"`
+	NodeID string `json:"nodeId"`
+	IssuedAt int64 `json:"issuedAt"`
+	Confirmations uint64 `json:"confirmations"`
+	Block BlockAPI `json:"block"`
+}
+
+// ReceiptAPI is an inclusion receipt signed by a node. Payload holds the
+// base64 encoded JSON bytes that were signed, so third parties can check
+// Signature against PublicKey without re-encoding anything. PublicKey is the
+// raw key of type KeyType, and NodeID is the libp2p peer ID derived from it.
+type ReceiptAPI struct{
+	Payload string `json:"payload"`
+	Signature string `json:"signature"`
+	PublicKey string `json:"publicKey"`
+	KeyType string `json:"keyType"`
+	NodeID string `json:"nodeId"`
+}
+
+// FromAnchor describes the entry of block anchoring fileHash, with its
+// inclusion path. It fails when the block does not contain the document.
+func FromAnchor(block *blockchain.Block, fileHash []byte, confirmations uint64) (AnchorAPI, error){
+	index := block.FindData(fileHash)
+	if index < 0{
+		return AnchorAPI{}, fmt.Errorf("block %x does not anchor document %x", block.Hash, fileHash)
+	}
+	proof := []MerkleStepAPI{}
+	for _, step := range blockchain.MerkleProof(block.Version, block.Data, block.Notaries, block.Statuses, index){
+		proof = append(proof, MerkleStepAPI{hex.EncodeToString(step.Hash), step.Left})
+	}
+
+	return AnchorAPI{
+		Version: block.Version,
+		BlockHash: hex.EncodeToString(block.Hash),
+		Height: block.Height,
+		Timestamp: block.Timestamp,
+		Nonce: block.Nonce,
+		Difficulty: block.Difficulty,
+		Confirmations: confirmations,
+		MerkleRoot: hex.EncodeToString(block.MerkleRoot),
+		MerkleProof: proof,
+		Data: FromBlockData(&block.Data[index]),
+	}, nil
+}
+
+// NewReceiptPayload encodes the receipt payload for signing
+func NewReceiptPayload(nodeID string, issuedAt int64, block *blockchain.Block, confirmations uint64) ([]byte, error){
+	payload := ReceiptPayloadAPI{
+		Version: ReceiptVersion,
+		NodeID: nodeID,
+		IssuedAt: issuedAt,
+		Confirmations: confirmations,
+		Block: FromBlock(block),
+	}
+	return json.Marshal(payload)
+}
+
+func NewReceipt(payload []byte, signature []byte, publicKey []byte, keyType string, nodeID string) ReceiptAPI{
+	return ReceiptAPI{
+		Payload: base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(signature),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		KeyType: keyType,
+		NodeID: nodeID,
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"blockchain-service/internal/blockchain"
+)
+
+func TestFromAnchor(t *testing.T){
+	deed, will := sha256.Sum256([]byte("deed.pdf")), sha256.Sum256([]byte("will.pdf"))
+	block := blockchain.NewBlock([]blockchain.BlockData{{Hash: deed[:], DocumentID: "deed.pdf"}}, nil, nil, make([]byte, 32), 1, 1700000000000)
+	block.Hash = bytes.Repeat([]byte{1}, 32)
+
+	anchor, err := FromAnchor(block, deed[:], 3)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if anchor.Data.Hash != blockchain.FormatHash(deed[:]) || anchor.Confirmations != 3{
+		t.Fatalf("anchor of deed.pdf describes %s with %d confirmations", anchor.Data.Hash, anchor.Confirmations)
+	}
+
+	if _, err := FromAnchor(block, will[:], 3); err == nil{
+		t.Fatal("FromAnchor described a document the block does not hold")
+	}
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"blockchain-service/internal/blockchain"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Current status of a document reported by /verify
+const(
+	StatusNotFound = "not_found"
+	StatusAnchored = "anchored"
+	StatusSuperseded = "superseded"
+	StatusRevoked = "revoked"
+)
+
+// StatusTxAPI revokes or supersedes an anchored document. Target and
+// Replacement are file hashes as written by blockchain.FormatHash, PublicKey the base64 encoded DER
+// key of the notary and Signature its base64 encoded signature.
+type StatusTxAPI struct{
+	Op string `json:"op"`
+	Target string `json:"target"`
+	Replacement string `json:"replacement,omitempty"`
+	Reason string `json:"reason"`
+	NotaryID string `json:"notaryId"`
+	Timestamp int64 `json:"timestamp"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+func (tx *StatusTxAPI) ToStatusTx() (*blockchain.StatusTx, error){
+	target, err := blockchain.ParseHashString(tx.Target)
+	if err != nil{
+		return nil, err
+	}
+	var replacement []byte
+	if tx.Replacement != ""{
+		replacement, err = blockchain.ParseHashString(tx.Replacement)
+		if err != nil{
+			return nil, err
+		}
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(tx.PublicKey)
+	if err != nil{
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(tx.Signature)
+	if err != nil{
+		return nil, err
+	}
+	statusTx := blockchain.StatusTx{
+		Op: tx.Op,
+		Target: target,
+		Replacement: replacement,
+		Reason: tx.Reason,
+		NotaryID: tx.NotaryID,
+		Timestamp: tx.Timestamp,
+		PublicKey: publicKey,
+		Signature: signature,
+	}
+
+	return &statusTx, nil
+}
+
+func FromStatusTx(tx *blockchain.StatusTx) StatusTxAPI{
+	return StatusTxAPI{
+		Op: tx.Op,
+		Target: blockchain.FormatHash(tx.Target),
+		Replacement: formatOptionalHash(tx.Replacement),
+		Reason: tx.Reason,
+		NotaryID: tx.NotaryID,
+		Timestamp: tx.Timestamp,
+		PublicKey: base64.StdEncoding.EncodeToString(tx.PublicKey),
+		Signature: base64.StdEncoding.EncodeToString(tx.Signature),
+	}
+}
+
+// DocumentEventAPI is an event of a document on the chain. Document is the
+// hash of the replacement of a superseded document, or of the document a
+// replacement supersedes.
+type DocumentEventAPI struct{
+	Event string `json:"event"`
+	Height uint64 `json:"height"`
+	BlockHash string `json:"blockHash"`
+	Timestamp int64 `json:"timestamp"`
+	Document string `json:"document,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	TxHash string `json:"txHash,omitempty"`
+}
+
+func FromDocumentEvent(event *blockchain.DocumentEvent) DocumentEventAPI{
+	return DocumentEventAPI{
+		Event: event.Event,
+		Height: event.Height,
+		BlockHash: hex.EncodeToString(event.BlockHash),
+		Timestamp: event.Timestamp,
+		Document: formatOptionalHash(event.Document),
+		Reason: event.Reason,
+		TxHash: hex.EncodeToString(event.TxHash),
+	}
+}
+
+// FromDocumentHistory returns the current status of a document and its
+// events
+func FromDocumentHistory(events []blockchain.DocumentEvent) (string, []DocumentEventAPI){
+	status := StatusNotFound
+	history := make([]DocumentEventAPI, 0, len(events))
+	for i := range events{
+		switch events[i].Event{
+		case blockchain.EventAnchored:
+			status = StatusAnchored
+		case blockchain.EventSuperseded:
+			status = StatusSuperseded
+		case blockchain.EventRevoked:
+			status = StatusRevoked
+		}
+		history = append(history, FromDocumentEvent(&events[i]))
+	}
+	return status, history
+}
+
+// formatOptionalHash formats a document hash that may be missing
+func formatOptionalHash(stored []byte) string{
+	if len(stored) == 0{
+		return ""
+	}
+	return blockchain.FormatHash(stored)
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/p2p"
+	"encoding/hex"
+)
+
+// SubmissionAPI reports the state of an uploaded document. The block fields
+// are only set once the document is mined.
+type SubmissionAPI struct{
+	ID string `json:"submissionId"`
+	Status string `json:"status"`
+	Hash string `json:"hash"`
+	SubmittedAt int64 `json:"submittedAt"`
+	BlockHash string `json:"blockHash,omitempty"`
+	Height *uint64 `json:"height,omitempty"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+func FromSubmission(status *p2p.SubmissionStatus) SubmissionAPI{
+	submissionAPI := SubmissionAPI{
+		ID: status.Submission.ID,
+		Status: status.Status,
+		Hash: blockchain.FormatHash(status.Submission.Data.Hash),
+		SubmittedAt: status.Submission.SubmittedAt,
+		Confirmations: status.Confirmations,
+	}
+	if status.Block != nil{
+		height := status.Block.Height
+		submissionAPI.BlockHash = hex.EncodeToString(status.Block.Hash)
+		submissionAPI.Height = &height
+	}
+
+	return submissionAPI
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"blockchain-service/internal/blockchain"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Bounds of the fields of an uploaded document, which stay on the chain for
+// good
+const(
+	maxDocumentIDLen = 128
+	maxPublicKeyLen = 512
+	maxSignatureLen = 512
+)
+
+// FieldError is the problem with one field of a request
+type FieldError struct{
+	Field string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid fields of a request, in the order of its
+// fields
+type ValidationError struct{
+	Fields []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string{
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields{
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field string, format string, args ...any){
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the fields of an uploaded document before it is signed
+// onto the chain: a hash of a supported algorithm and length, a bounded
+// printable momId, UUID notary and user IDs, a CNPJ with valid check digits
+// and a base64 key and signature. It returns a *ValidationError.
+func (bd *BlockDataAPI) Validate() error{
+	e := &ValidationError{}
+
+	if bd.Hash == ""{
+		e.add("hash", "is required")
+	} else if _, err := blockchain.ParseHashString(bd.Hash); err != nil{
+		e.add("hash", "%s", strings.TrimPrefix(err.Error(), blockchain.ErrInvalidHash.Error()+": "))
+	}
+
+	switch{
+	case bd.DocumentID == "":
+		e.add("momId", "is required")
+	case len(bd.DocumentID) > maxDocumentIDLen:
+		e.add("momId", "must be at most %d bytes", maxDocumentIDLen)
+	case !printable(bd.DocumentID):
+		e.add("momId", "must be printable UTF-8 text")
+	}
+
+	if bd.NotaryID == ""{
+		e.add("notaryId", "is required")
+	} else if !isUUID(bd.NotaryID){
+		e.add("notaryId", "must be a UUID like 21122ee1-a5bc-4fcc-bead-065acfc38edf")
+	}
+	if bd.UserID == ""{
+		e.add("userId", "is required")
+	} else if !isUUID(bd.UserID){
+		e.add("userId", "must be a UUID like a101fb26-8b78-4e93-9fab-67d291a28fb7")
+	}
+
+	if bd.CNPJ == ""{
+		e.add("cnpj", "is required")
+	} else if err := checkCNPJ(bd.CNPJ); err != nil{
+		e.add("cnpj", "%v", err)
+	}
+
+	checkBase64(e, "publicKey", bd.PublicKey, maxPublicKeyLen)
+	checkBase64(e, "signature", bd.Signature, maxSignatureLen)
+
+	if len(e.Fields) > 0{
+		return e
+	}
+	return nil
+}
+
+func checkBase64(e *ValidationError, field string, value string, maxLen int){
+	switch{
+	case value == "":
+		e.add(field, "is required")
+	case len(value) > maxLen:
+		e.add(field, "must be at most %d characters", maxLen)
+	default:
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil{
+			e.add(field, "must be standard base64")
+		}
+	}
+}
+
+// printable reports whether s is valid UTF-8 without control characters
+func printable(s string) bool{
+	if !utf8.ValidString(s){
+		return false
+	}
+	for _, r := range s{
+		if !unicode.IsPrint(r){
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID reports whether s is a UUID in its canonical 8-4-4-4-12 hex form
+func isUUID(s string) bool{
+	if len(s) != 36{
+		return false
+	}
+	for i := 0; i < len(s); i++{
+		c := s[i]
+		switch i{
+		case 8, 13, 18, 23:
+			if c != '-'{
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'){
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkCNPJ checks a CNPJ, either bare (14 characters) or formatted as
+// 00.000.000/0000-00. The first 12 characters may be digits or, for the
+// alphanumeric CNPJs issued since July 2026, upper case letters; the last 2
+// are the check digits.
+func checkCNPJ(cnpj string) error{
+	bare := cnpj
+	if len(cnpj) == 18{
+		if cnpj[2] != '.' || cnpj[6] != '.' || cnpj[10] != '/' || cnpj[15] != '-'{
+			return errors.New("must be formatted as 00.000.000/0000-00 or given as 14 characters")
+		}
+		bare = cnpj[0:2] + cnpj[3:6] + cnpj[7:10] + cnpj[11:15] + cnpj[16:18]
+	}
+	if len(bare) != 14{
+		return errors.New("must be formatted as 00.000.000/0000-00 or given as 14 characters")
+	}
+
+	for i := 0; i < 14; i++{
+		c := bare[i]
+		if '0' <= c && c <= '9' || i < 12 && 'A' <= c && c <= 'Z'{
+			continue
+		}
+		if i < 12{
+			return errors.New("must have digits or upper case letters before the check digits")
+		}
+		return errors.New("must end with 2 check digits")
+	}
+	if strings.Count(bare, bare[:1]) == 14{
+		return errors.New("must not repeat a single digit")
+	}
+	if bare[12] != cnpjCheckDigit(bare[:12]) || bare[13] != cnpjCheckDigit(bare[:13]){
+		return errors.New("has invalid check digits")
+	}
+	return nil
+}
+
+// cnpjCheckDigit computes the modulo 11 check digit of the characters of a
+// CNPJ before it, each worth its ASCII code minus 48, with weights 2 to 9
+// from the right
+func cnpjCheckDigit(s string) byte{
+	sum := 0
+	weight := 2
+	for i := len(s) - 1; i >= 0; i--{
+		sum += int(s[i]-'0') * weight
+		weight++
+		if weight > 9{
+			weight = 2
+		}
+	}
+	if rest := sum % 11; rest >= 2{
+		return byte('0' + 11 - rest)
+	}
+	return '0'
+}
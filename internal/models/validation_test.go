@@ -0,0 +1,129 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckCNPJ(t *testing.T){
+	for _, test := range []struct{
+		cnpj string
+		valid bool
+	}{
+		{"11.222.333/0001-81", true},
+		{"11222333000181", true},
+		{"12.ABC.345/01DE-35", true},
+		{"12ABC34501DE35", true},
+		{"11.222.333/0001-82", false},
+		{"11222333000118", false},
+		{"12ABC34501DE53", false},
+		{"00000000000000", false},
+		{"11111111111111", false},
+		{"11.222.333.0001-81", false},
+		{"11-222-333/0001.81", false},
+		{"1122233300018", false},
+		{"112223330001811", false},
+		{"12abc34501de35", false},
+		{"12.abc.345/01de-35", false},
+		{"12ABC34501DEAB", false},
+		{"12ABC345-1DE35", false},
+	}{
+		err := checkCNPJ(test.cnpj)
+		if test.valid && err != nil{
+			t.Errorf("%s refused: %v", test.cnpj, err)
+		}
+		if !test.valid && err == nil{
+			t.Errorf("%s accepted", test.cnpj)
+		}
+	}
+}
+
+func TestIsUUID(t *testing.T){
+	for s, want := range map[string]bool{
+		"21122ee1-a5bc-4fcc-bead-065acfc38edf": true,
+		"21122EE1-A5BC-4FCC-BEAD-065ACFC38EDF": true,
+		"21122ee1a5bc4fccbead065acfc38edf": false,
+		"21122ee1-a5bc-4fcc-bead-065acfc38ed": false,
+		"21122ee1-a5bc-4fcc-bead-065acfc38edg": false,
+		"21122ee1_a5bc_4fcc_bead_065acfc38edf": false,
+		"{21122ee1-a5bc-4fcc-bead-065acfc38ed}": false,
+		"": false,
+	}{
+		if got := isUUID(s); got != want{
+			t.Errorf("isUUID(%q) = %v", s, got)
+		}
+	}
+}
+
+func TestPrintable(t *testing.T){
+	for s, want := range map[string]bool{
+		"mom-deed.pdf": true,
+		"escritura de compra e venda nº 12": true,
+		"line\nbreak": false,
+		"tab\there": false,
+		"nul\x00": false,
+		"\xff\xfe": false,
+	}{
+		if got := printable(s); got != want{
+			t.Errorf("printable(%q) = %v", s, got)
+		}
+	}
+}
+
+func TestCheckBase64(t *testing.T){
+	for _, test := range []struct{
+		value string
+		message string
+	}{
+		{"c2lnbmF0dXJl", ""},
+		{"", "is required"},
+		{"c2lnbmF0dXJl" + strings.Repeat("A", 8), "must be at most 16 characters"},
+		{"c2lnbmF0dXJl!", "must be standard base64"},
+		{"c2lnbmF0dXJlcw", "must be standard base64"},
+		{"c2lnbmF0dXJl_-", "must be standard base64"},
+	}{
+		e := &ValidationError{}
+		checkBase64(e, "signature", test.value, 16)
+		message := ""
+		if len(e.Fields) > 0{
+			message = e.Fields[0].Message
+		}
+		if message != test.message || len(e.Fields) > 1{
+			t.Errorf("checkBase64(%q) = %v, want %q", test.value, e.Fields, test.message)
+		}
+	}
+}
+
+func TestValidateOrder(t *testing.T){
+	hash := sha256.Sum256([]byte("deed.pdf"))
+	valid := BlockDataAPI{
+		Hash: hex.EncodeToString(hash[:]),
+		DocumentID: "mom-deed.pdf",
+		NotaryID: "21122ee1-a5bc-4fcc-bead-065acfc38edf",
+		UserID: "a101fb26-8b78-4e93-9fab-67d291a28fb7",
+		CNPJ: "11.222.333/0001-81",
+		PublicKey: "cHVibGljS2V5",
+		Signature: "c2lnbmF0dXJl",
+	}
+	if err := valid.Validate(); err != nil{
+		t.Fatal(err)
+	}
+
+	var invalid *ValidationError
+	err := (&BlockDataAPI{DocumentID: "deed\n", UserID: "user", CNPJ: "11.222.333/0001-82", Signature: "!"}).Validate()
+	if !errors.As(err, &invalid){
+		t.Fatalf("Validate returned %v", err)
+	}
+	fields := []string{}
+	for _, field := range invalid.Fields{
+		fields = append(fields, field.Field)
+	}
+	want := []string{"hash", "momId", "notaryId", "userId", "cnpj", "publicKey", "signature"}
+	if !reflect.DeepEqual(fields, want){
+		t.Fatalf("invalid fields %v, want %v", fields, want)
+	}
+}
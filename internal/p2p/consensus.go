@@ -0,0 +1,151 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"blockchain-service/internal/bft"
+	"blockchain-service/internal/blockchain"
+)
+
+// maxBlockDrift is how far in the future a proposed block timestamp may be
+const maxBlockDrift = 30 * time.Second
+
+// newConsensus creates the BFT consensus of the node when the chain runs the
+// bft engine, or returns nil
+func newConsensus(n *BlockchainNode) (*bft.Consensus, error){
+	engine, ok := n.chain.Engine().(*blockchain.BFTEngine)
+	if !ok{
+		return nil, nil
+	}
+	config := bft.DefaultConfig(engine.Validators(), n.p2p.PrivKey())
+	storage := bft.NewStorage(n.chain.Database)
+	return bft.New(config, &bftApp{node: n}, &bftTransport{node: n}, storage)
+}
+
+// runConsensus decides blocks with the validators, waking the consensus up
+// whenever documents are added to the pool
+func (n *BlockchainNode) runConsensus(){
+	go func(){
+		for{
+			select{
+			case <-n.ctx.Done():
+				return
+			case <-n.pool.Ready():
+				n.consensus.Kick()
+			}
+		}
+	}()
+
+	if err := n.consensus.Run(n.ctx); err != nil && !errors.Is(err, context.Canceled){
+		log.Printf("Consensus stopped: %v", err)
+	}
+}
+
+// handleConsensus hands a proposal or vote to the consensus, syncing first
+// when the validators are deciding a height we cannot build on yet
+func (n *BlockchainNode) handleConsensus(pmsg *PeerMessage){
+	msg := pmsg.Msg.Consensus
+	if msg == nil || n.consensus == nil{
+		return
+	}
+	if height := msg.Height(); height > n.chain.Height()+1{
+		n.startSync(pmsg.From, height-1)
+	}
+	n.consensus.Receive(msg)
+}
+
+type bftTransport struct{
+	node *BlockchainNode
+}
+
+func (t *bftTransport) Broadcast(msg *bft.Message){
+	t.node.outbound <- &PeerMessage{Msg: NewConsensusMsg(msg)}
+}
+
+// bftApp connects the consensus to the chain and the pending pool
+type bftApp struct{
+	node *BlockchainNode
+}
+
+func (a *bftApp) LastBlock() (*blockchain.Block, error){
+	return a.node.LatestBlockAPI()
+}
+
+func (a *bftApp) Pending() bool{
+	return a.node.pool.Len() > 0
+}
+
+// ProposeBlock builds a block from the oldest pending documents that are not
+// anchored yet and the pending registry and status transactions. The documents stay in the pool until the block is committed.
+func (a *bftApp) ProposeBlock(parent *blockchain.Block) (*blockchain.Block, error){
+	n := a.node
+	batch := []blockchain.BlockData{}
+	for _, data := range n.pool.Snapshot(){
+		if len(batch) == n.miner.MaxBlockData{
+			break
+		}
+		if !n.minable(data){
+			continue
+		}
+		batch = append(batch, *data)
+	}
+	notaries := n.pendingNotaries()
+	statuses := n.pendingStatuses()
+	if len(batch) == 0 && len(notaries) == 0 && len(statuses) == 0{
+		return nil, nil
+	}
+
+	block, err := n.chain.CreateBlock(n.ctx, batch, notaries, statuses)
+	if err != nil{
+		return nil, err
+	}
+	if !bytes.Equal(block.PrevHash, parent.Hash){
+		return nil, fmt.Errorf("tip moved away from block %x", parent.Hash)
+	}
+	return block, nil
+}
+
+func (a *bftApp) ValidateBlock(parent *blockchain.Block, block *blockchain.Block) error{
+	n := a.node
+	if err := n.chain.CheckBlock(block); err != nil{
+		return err
+	}
+	if block.Timestamp < parent.Timestamp{
+		return fmt.Errorf("timestamp %d before parent timestamp %d", block.Timestamp, parent.Timestamp)
+	}
+	if limit := time.Now().Add(maxBlockDrift).UnixMilli(); block.Timestamp > limit{
+		return fmt.Errorf("timestamp %d is in the future", block.Timestamp)
+	}
+	if len(block.Data) == 0 && len(block.Notaries) == 0 && len(block.Statuses) == 0{
+		return fmt.Errorf("block holds no documents")
+	}
+
+	seen := map[string]bool{}
+	for i := range block.Data{
+		hash := block.Data[i].Hash
+		if seen[string(hash)]{
+			return fmt.Errorf("document %x appears twice", hash)
+		}
+		seen[string(hash)] = true
+		if ok, err := n.chain.ContainsFileHash(hash); err != nil || ok{
+			return fmt.Errorf("document %x is already anchored", hash)
+		}
+	}
+	return nil
+}
+
+// Commit stores a finalized block and gossips it, so that nodes that missed
+// the votes still get it
+func (a *bftApp) Commit(block *blockchain.Block) error{
+	n := a.node
+	if err := n.processBlock(block); err != nil{
+		return err
+	}
+	n.outbound <- &PeerMessage{Msg: NewGossipMsg(block, block.Height)}
+	return nil
+}
@@ -0,0 +1,185 @@
+package p2p
+
+import (
+	"fmt"
+
+	"blockchain-service/internal/bft"
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/codec"
+	"blockchain-service/internal/raft"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// WireVersion is the schema version of the message envelope, defined in
+// proto/p2p.proto. Messages of another version are refused.
+const WireVersion = 1
+
+// Field numbers of the Envelope message
+const(
+	envelopeVersion = iota + 1
+	envelopeType
+	envelopeID
+	envelopeHeight
+	envelopeProtocol
+	envelopePeers
+	envelopeBlockHash
+	envelopeBlock
+	envelopeStartHeight
+	envelopeLimit
+	envelopeBlocks
+	envelopePending
+	envelopeNotaries
+	envelopeStatuses
+	envelopeConsensus
+	envelopeRaft
+)
+
+// Field numbers of the PeerInfo message
+const(
+	peerID = iota + 1
+	peerAddrs
+)
+
+// serialize returns the canonical encoding of the message
+func (msg *Message) serialize() []byte{
+	var e codec.Encoder
+	e.Uint(envelopeVersion, WireVersion)
+	e.Text(envelopeType, msg.Type)
+	e.Text(envelopeID, msg.ID)
+	e.Uint(envelopeHeight, msg.Height)
+	e.Text(envelopeProtocol, msg.Version)
+	for _, info := range msg.Peers{
+		e.Message(envelopePeers, serializePeer(info))
+	}
+	e.Text(envelopeBlockHash, msg.BlockHash)
+	if msg.Block != nil{
+		block, _ := msg.Block.Serialize()
+		e.Message(envelopeBlock, block)
+	}
+	e.Uint(envelopeStartHeight, msg.StartHeight)
+	e.Uint(envelopeLimit, msg.Limit)
+	for _, block := range msg.Blocks{
+		encoded, _ := block.Serialize()
+		e.Message(envelopeBlocks, encoded)
+	}
+	for _, data := range msg.Pending{
+		e.Message(envelopePending, data.Serialize())
+	}
+	for _, tx := range msg.Notaries{
+		e.Message(envelopeNotaries, tx.Serialize())
+	}
+	for _, tx := range msg.Statuses{
+		e.Message(envelopeStatuses, tx.Serialize())
+	}
+	if msg.Consensus != nil{
+		e.Message(envelopeConsensus, msg.Consensus.Serialize())
+	}
+	if msg.Raft != nil{
+		e.Message(envelopeRaft, msg.Raft.Serialize())
+	}
+	return e.Encoded()
+}
+
+// deserializeMessage decodes a message from its canonical encoding
+func deserializeMessage(data []byte) (*Message, error){
+	var msg Message
+	var version uint64
+	d := codec.NewDecoder(data)
+	for d.More(){
+		var err error
+		switch d.Field(){
+		case envelopeVersion:
+			version = d.Uint()
+		case envelopeType:
+			msg.Type = d.Text()
+		case envelopeID:
+			msg.ID = d.Text()
+		case envelopeHeight:
+			msg.Height = d.Uint()
+		case envelopeProtocol:
+			msg.Version = d.Text()
+		case envelopePeers:
+			var info *peer.AddrInfo
+			info, err = deserializePeer(d.Message())
+			msg.Peers = append(msg.Peers, info)
+		case envelopeBlockHash:
+			msg.BlockHash = d.Text()
+		case envelopeBlock:
+			msg.Block, err = blockchain.Deserialize(d.Message())
+		case envelopeStartHeight:
+			msg.StartHeight = d.Uint()
+		case envelopeLimit:
+			msg.Limit = d.Uint()
+		case envelopeBlocks:
+			var block *blockchain.Block
+			block, err = blockchain.Deserialize(d.Message())
+			msg.Blocks = append(msg.Blocks, block)
+		case envelopePending:
+			var data *blockchain.BlockData
+			data, err = blockchain.DeserializeBlockData(d.Message())
+			msg.Pending = append(msg.Pending, data)
+		case envelopeNotaries:
+			var tx *blockchain.NotaryTx
+			tx, err = blockchain.DeserializeNotaryTx(d.Message())
+			msg.Notaries = append(msg.Notaries, tx)
+		case envelopeStatuses:
+			var tx *blockchain.StatusTx
+			tx, err = blockchain.DeserializeStatusTx(d.Message())
+			msg.Statuses = append(msg.Statuses, tx)
+		case envelopeConsensus:
+			msg.Consensus, err = bft.DeserializeMessage(d.Message())
+		case envelopeRaft:
+			msg.Raft, err = raft.DeserializeMessage(d.Message())
+		default:
+			d.Skip()
+		}
+		if err != nil{
+			return nil, err
+		}
+	}
+	if err := d.Err(); err != nil{
+		return nil, err
+	}
+	if version != WireVersion{
+		return nil, fmt.Errorf("%w: wire version %d, expected %d", codec.ErrMalformed, version, WireVersion)
+	}
+	if err := codec.Canonical(data, msg.serialize()); err != nil{
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func serializePeer(info *peer.AddrInfo) []byte{
+	var e codec.Encoder
+	e.Bytes(peerID, []byte(info.ID))
+	for _, addr := range info.Addrs{
+		e.Message(peerAddrs, addr.Bytes())
+	}
+	return e.Encoded()
+}
+
+func deserializePeer(data []byte) (*peer.AddrInfo, error){
+	var info peer.AddrInfo
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case peerID:
+			id, err := peer.IDFromBytes(d.Bytes())
+			if err != nil{
+				return nil, err
+			}
+			info.ID = id
+		case peerAddrs:
+			addr, err := multiaddr.NewMultiaddrBytes(d.Bytes())
+			if err != nil{
+				return nil, err
+			}
+			info.Addrs = append(info.Addrs, addr)
+		default:
+			d.Skip()
+		}
+	}
+	return &info, d.Err()
+}
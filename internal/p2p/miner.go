@@ -0,0 +1,156 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+)
+
+// MinerConfig controls when the node cuts a block from the pending pool
+type MinerConfig struct{
+	// MaxBlockData is the number of pending documents that triggers a block
+	// right away, and the maximum number of documents in a block
+	MaxBlockData int
+	// BlockInterval is the longest a document waits in the pool before a
+	// block is cut with whatever is pending
+	BlockInterval time.Duration
+}
+
+func DefaultMinerConfig() MinerConfig{
+	return MinerConfig{
+		MaxBlockData: 64,
+		BlockInterval: 5 * time.Second,
+	}
+}
+
+// minePending cuts a block from the pending pool whenever MaxBlockData
+// documents are waiting or BlockInterval has passed since the first one
+// arrived
+func (n *BlockchainNode) minePending(){
+	timer := time.NewTimer(n.miner.BlockInterval)
+	timer.Stop()
+	armed := false
+
+	for{
+		select{
+		case <-n.ctx.Done():
+			timer.Stop()
+			return
+		case <-n.pool.Ready():
+			if n.pool.Len() < n.miner.MaxBlockData{
+				if !armed && n.pool.Len() > 0{
+					timer.Reset(n.miner.BlockInterval)
+					armed = true
+				}
+				continue
+			}
+		case <-timer.C:
+		}
+
+		timer.Stop()
+		armed = false
+		n.mineBatch()
+
+		if n.pool.Len() > 0{
+			n.pool.signal()
+		}
+	}
+}
+
+// mineBatch mines the oldest pending documents that are not yet anchored,
+// along with the pending registry and status transactions
+func (n *BlockchainNode) mineBatch(){
+	batch := []blockchain.BlockData{}
+	for _, data := range n.pool.PopN(n.miner.MaxBlockData){
+		if !n.minable(data){
+			continue
+		}
+		batch = append(batch, *data)
+	}
+	notaries := n.pendingNotaries()
+	statuses := n.pendingStatuses()
+	if len(batch) == 0 && len(notaries) == 0 && len(statuses) == 0{
+		return
+	}
+
+	_, err := n.mineBlock(batch, notaries, statuses)
+	if errors.Is(err, context.Canceled){
+		log.Printf("Mining aborted, re-queueing %d pending documents", len(batch))
+	} else if err != nil{
+		log.Printf("Failed to mine %d pending documents: %v", len(batch), err)
+	}
+	if err != nil{
+		n.requeue(batch)
+	}
+}
+
+// requeue puts back in front of the pool the documents of a batch that are
+// still not anchored
+func (n *BlockchainNode) requeue(batch []blockchain.BlockData){
+	pending := []*blockchain.BlockData{}
+	for i := range batch{
+		if ok, err := n.chain.ContainsFileHash(batch[i].Hash); err == nil && ok{
+			continue
+		}
+		pending = append(pending, &batch[i])
+	}
+	n.pool.Requeue(pending)
+}
+
+// mineBlock mines the documents and transactions on top of the current tip
+// and gossips the block. Mining is aborted by abortMining when a peer's block takes the tip or
+// competes for it. If a competing block took the tip meanwhile anyway, the
+// documents it does not anchor go back to the pool. Transactions stay in the
+// pool until they are applied.
+func (n *BlockchainNode) mineBlock(batch []blockchain.BlockData, notaries []blockchain.NotaryTx, statuses []blockchain.StatusTx) (*blockchain.Block, error){
+	ctx, cancel := context.WithCancel(n.ctx)
+	lastHash, _ := n.chain.Tip()
+
+	n.mineLock.Lock()
+	n.mineParent = lastHash
+	n.mineCancel = cancel
+	n.mineLock.Unlock()
+
+	defer func(){
+		n.mineLock.Lock()
+		n.mineParent = nil
+		n.mineCancel = nil
+		n.mineLock.Unlock()
+		cancel()
+	}()
+
+	block, err := n.chain.CreateInsertBlock(ctx, batch, notaries, statuses)
+	if err != nil{
+		return nil, err
+	}
+	n.outbound <- &PeerMessage{Msg: NewGossipMsg(block, block.Height)}
+	n.dropAnchored(block)
+
+	for i := range batch{
+		if ok, err := n.chain.ContainsFileHash(batch[i].Hash); err == nil && ok{
+			continue
+		}
+		log.Printf("Document %x lost the race for the tip, re-queueing", batch[i].Hash)
+		n.pool.Add(&batch[i])
+	}
+	return block, nil
+}
+
+// abortMining stops the block being mined when block was accepted on top of
+// the same parent, or when the tip moved away from that parent
+func (n *BlockchainNode) abortMining(block *blockchain.Block){
+	n.mineLock.Lock()
+	defer n.mineLock.Unlock()
+
+	if n.mineCancel == nil{
+		return
+	}
+	lastHash, _ := n.chain.Tip()
+	if bytes.Equal(block.PrevHash, n.mineParent) || !bytes.Equal(lastHash, n.mineParent){
+		n.mineCancel()
+	}
+}
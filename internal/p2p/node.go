@@ -2,14 +2,21 @@
 package p2p
 
 import (
-	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
+	"errors"
 	"log"
+	"sync"
+	"time"
 
+	"blockchain-service/internal/bft"
 	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/raft"
 	"blockchain-service/internal/utils"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 // BlockchainNode ties together the P2P service and the blockchain logic
@@ -20,7 +27,28 @@ type BlockchainNode struct {
     p2p         *P2PService
     inbound     chan PeerMessage
     outbound    chan *PeerMessage
+    connected   chan peer.AddrInfo
     version     string
+    pool        *PendingPool
+    submissions *Submissions
+    miner       MinerConfig
+
+    // block being mined, guarded by mineLock
+    mineLock    sync.Mutex
+    mineParent  []byte
+    mineCancel  context.CancelFunc
+
+    // BFT consensus, nil unless the chain runs the bft engine
+    consensus   *bft.Consensus
+    // raft member, nil unless the chain runs the raft engine
+    raft        *raft.Raft
+
+    // sync state, only touched from the Run loop
+    syncPeer     *peer.AddrInfo
+    syncTarget   uint64
+    syncStart    uint64
+    syncBack     uint64
+    syncDeadline time.Time
 }
 
 // NewBlockchainNode constructs a new node with given parameters
@@ -29,6 +57,7 @@ func NewBlockchainNode(
     version string,
     listenAddr utils.PeerInfo,
     chain *blockchain.BlockChain,
+    miner MinerConfig,
 ) (*BlockchainNode, error) {
     ctx, cancel := context.WithCancel(parentCtx)
     // instantiate P2P service
@@ -44,7 +73,21 @@ func NewBlockchainNode(
         p2p:         p2pSvc,
         inbound:     p2pSvc.Inbound,
         outbound:    p2pSvc.Outbound,
+        connected:   p2pSvc.Connected,
         version:     version,
+        pool:        NewPendingPool(),
+        submissions: NewSubmissions(),
+        miner:       miner,
+    }
+    node.consensus, err = newConsensus(node)
+    if err != nil {
+        cancel()
+        return nil, fmt.Errorf("failed to create consensus: %w", err)
+    }
+    node.raft, err = newRaft(node)
+    if err != nil {
+        cancel()
+        return nil, fmt.Errorf("failed to create raft member: %w", err)
     }
     return node, nil
 }
@@ -52,12 +95,25 @@ func NewBlockchainNode(
 // Run starts the P2P service and enters the main event loop
 func (n *BlockchainNode) Run(staticPeers []utils.PeerInfo) error {
     n.p2p.Start(staticPeers)
+    switch {
+    case n.consensus != nil:
+        go n.runConsensus()
+    case n.raft != nil:
+        go n.runRaft()
+    case n.chain.Engine().CanSeal():
+        go n.minePending()
+    default:
+        log.Println("Node cannot seal blocks, pending documents are left to peers")
+    }
     for {
         select {
         case <-n.ctx.Done():
             return n.ctx.Err()
         case pm := <-n.inbound:
             n.handlePeerMessage(pm)
+        case info := <-n.connected:
+            n.announceStatus(info)
+            n.sendPending(info)
         }
     }
 }
@@ -77,6 +133,18 @@ func (n *BlockchainNode) handlePeerMessage(pm PeerMessage) {
       n.handleGetBlock(&pm)
     case MsgTypeBlock:
       n.handleBlock(&pm)
+    case MsgTypeStatus:
+      n.handleStatus(&pm)
+    case MsgTypeGetBlocks:
+      n.handleGetBlocks(&pm)
+    case MsgTypeBlocks:
+      n.handleBlocks(&pm)
+    case MsgTypePending:
+      n.handlePending(&pm)
+    case MsgTypeConsensus:
+      n.handleConsensus(&pm)
+    case MsgTypeRaft:
+      n.handleRaft(&pm)
     default:
       n.fallbackHandler(&pm)
     }
@@ -87,8 +155,16 @@ func (n *BlockchainNode) handleGossip(pmsg *PeerMessage){
 }
 
 func (n *BlockchainNode) handleGetBlock(pmsg *PeerMessage){
-  bh := pmsg.Msg.BlockHash
-  blk := n.chain.GetBlockByHash([]byte(bh))
+  bh, err := hex.DecodeString(pmsg.Msg.BlockHash)
+  if err != nil{
+    log.Printf("Invalid GETBLOCK hash %q: %v", pmsg.Msg.BlockHash, err)
+    return
+  }
+  blk, err := n.chain.GetBlockByHash(bh)
+  if err != nil{
+    log.Printf("GETBLOCK %s: %v", pmsg.Msg.BlockHash, err)
+    return
+  }
 
   newMsg := PeerMessage{
     From: pmsg.To,
@@ -100,19 +176,58 @@ func (n *BlockchainNode) handleGetBlock(pmsg *PeerMessage){
 
 func (n *BlockchainNode) handleBlock(pmsg *PeerMessage){
   block := pmsg.Msg.Block
-  pow := blockchain.NewProof(block)
-  if !pow.Validate(){
-    log.Printf("Invalid block POW")
+  if block == nil{
+    log.Printf("Received %s message without a block", pmsg.Msg.Type)
+    return
+  }
+  hasParent, err := n.chain.ContainsBlock(block.PrevHash)
+  if err != nil{
+    log.Printf("Failed to look up parent of block %x: %v", block.Hash, err)
     return
   }
-  if !bytes.Equal(block.PrevHash, n.chain.LastHash){
-    log.Printf("block PrevHash != chain.LastHash")
-    return 
+  if !hasParent{
+    // we are behind or the block belongs to a branch we have not seen
+    n.startSync(pmsg.From, block.Height)
+    return
   }
 
-  n.chain.InsertBlock(block)
+  if err := n.processBlock(block); err != nil{
+    log.Printf("Rejected block %x: %v", block.Hash, err)
+  }
+}
 
+// processBlock hands a block received from a peer to the chain, which
+// validates it, queueing any documents and transactions orphaned by a reorg
+// to be mined again.
+// The consensus, if any, is told that the chain may have advanced.
+func (n *BlockchainNode) processBlock(block *blockchain.Block) error{
+  orphaned, err := n.chain.AcceptBlock(block)
+  if err != nil{
+    return err
+  }
+  n.dropAnchored(block)
+  n.abortMining(block)
+  for i := range orphaned.Data{
+    if ok, err := n.chain.ContainsFileHash(orphaned.Data[i].Hash); err == nil && ok{
+      continue
+    }
+    log.Printf("Re-queueing orphaned document %x", orphaned.Data[i].Hash)
+    n.pool.Add(&orphaned.Data[i])
+  }
+  for i := range orphaned.Notaries{
+    log.Printf("Re-queueing orphaned notary tx %x", orphaned.Notaries[i].Hash())
+    n.pool.AddNotary(&orphaned.Notaries[i])
+  }
+  for i := range orphaned.Statuses{
+    log.Printf("Re-queueing orphaned status tx %x", orphaned.Statuses[i].Hash())
+    n.pool.AddStatus(&orphaned.Statuses[i])
+  }
+  if n.consensus != nil{
+    n.consensus.Kick()
+  }
+  return nil
 }
+
 func (n *BlockchainNode) fallbackHandler(msg *PeerMessage){
 
 }
@@ -123,16 +238,115 @@ func (n *BlockchainNode) Status() (uint64, int) {
     return n.chain.Height(), len(n.p2p.ListPeers())
 }
 
-func (n *BlockchainNode) AddBlockAPI(data *blockchain.BlockData) (*blockchain.Block, error){ 
-	block := n.chain.CreateInsertBlock(data)
-  n.outbound <- &PeerMessage{Msg: NewGossipMsg(block, n.chain.Height())}
-	return block, nil
+// ID returns the peer ID of the node
+func (n *BlockchainNode) ID() peer.ID {
+    return n.p2p.ID()
+}
+
+// Sign signs data with the node's libp2p identity key and returns the
+// signature along with the matching public key
+func (n *BlockchainNode) Sign(data []byte) ([]byte, crypto.PubKey, error) {
+    privKey := n.p2p.PrivKey()
+    if privKey == nil {
+        return nil, nil, fmt.Errorf("node has no identity key")
+    }
+    signature, err := privKey.Sign(data)
+    if err != nil {
+        return nil, nil, err
+    }
+    return signature, privKey.GetPublic(), nil
 }
 
-func (n *BlockchainNode) ListBlocksAPI() ([]*blockchain.Block, error){
-	return n.chain.ListBlocks(), nil	
+// SubmitAPI queues a document for mining without waiting for its block.
+// Submitting a file hash again returns the earlier submission. Documents that
+// are not signed by the key they carry, or whose notary is not active in the
+// registry with that key, are refused.
+func (n *BlockchainNode) SubmitAPI(data *blockchain.BlockData) (*SubmissionStatus, error){ 
+	if err := data.CheckHash(); err != nil{
+		return nil, err
+	}
+	if err := data.VerifySignature(); err != nil{
+		return nil, err
+	}
+	if err := n.chain.AuthorizeNotary(data); err != nil{
+		return nil, err
+	}
+	sub, err := n.submissions.Add(data)
+	if err != nil{
+		return nil, err
+	}
+	// documents that are already anchored are skipped by the miner
+	if n.pool.Add(sub.Data){
+		n.relayPending([]*blockchain.BlockData{sub.Data})
+	}
+	return n.submissionStatus(sub)
+}
+
+// SubmissionAPI returns the current state of a submission
+func (n *BlockchainNode) SubmissionAPI(id string) (*SubmissionStatus, error){
+	sub, ok := n.submissions.Get(id)
+	if !ok{
+		return nil, ErrSubmissionNotFound
+	}
+	return n.submissionStatus(sub)
+}
+
+func (n *BlockchainNode) submissionStatus(sub *Submission) (*SubmissionStatus, error){
+	status := &SubmissionStatus{Submission: sub, Status: SubmissionPending}
+
+	block, confirmations, err := n.FindFileHashAPI(sub.Data.Hash)
+	if errors.Is(err, blockchain.ErrBlockNotFound){
+		return status, nil
+	}
+	if err != nil{
+		return nil, err
+	}
+
+	status.Block = block
+	status.Confirmations = confirmations
+	status.Status = SubmissionMined
+	if confirmations >= ConfirmedDepth || n.isFinal(block){
+		status.Status = SubmissionConfirmed
+	}
+	return status, nil
 }
 
-func (n *BlockchainNode) ContainsFileHashAPI(hash []byte) bool{ 
+func (n *BlockchainNode) ListBlocksPageAPI(query blockchain.BlockPageQuery) (*blockchain.BlockPage, error){
+	return n.chain.ListBlocksPage(query)
+}
+
+func (n *BlockchainNode) GetBlockByHashAPI(hash []byte) (*blockchain.Block, error){
+	return n.chain.GetBlockByHash(hash)
+}
+
+func (n *BlockchainNode) GetBlockByHeightAPI(height uint64) (*blockchain.Block, error){
+	return n.chain.GetBlockByHeight(height)
+}
+
+func (n *BlockchainNode) LatestBlockAPI() (*blockchain.Block, error){
+	lastHash, _ := n.chain.Tip()
+	return n.chain.GetBlockByHash(lastHash)
+}
+
+// FindFileHashAPI returns the block anchoring a document and its number of
+// confirmations, counting the block itself
+func (n *BlockchainNode) FindFileHashAPI(hash []byte) (*blockchain.Block, uint64, error){
+	block, err := n.chain.GetBlockByFileHash(hash)
+	if err != nil{
+		return nil, 0, err
+	}
+	height := n.chain.Height()
+	if height < block.Height{
+		// a reorg moved the tip below the block since it was read
+		return block, 0, nil
+	}
+	return block, height - block.Height + 1, nil
+}
+
+func (n *BlockchainNode) ContainsFileHashAPI(hash []byte) (bool, error){ 
 	return n.chain.ContainsFileHash(hash) 
 }
+
+func (n *BlockchainNode) VerifyChainAPI() (*blockchain.VerifyReport, error){
+	return n.chain.Verify()
+}
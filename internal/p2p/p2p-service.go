@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	libp2p "github.com/libp2p/go-libp2p"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
 	host "github.com/libp2p/go-libp2p/core/host"
 	network "github.com/libp2p/go-libp2p/core/network"
 	peer "github.com/libp2p/go-libp2p/core/peer"
@@ -37,6 +38,7 @@ type P2PService struct {
 
     Inbound  chan PeerMessage  // incoming messages from network
     Outbound chan *PeerMessage     // outgoing messages to broadcast
+    Connected chan peer.AddrInfo   // peers we successfully dialed
 }
 
 // NewP2PService constructs and configures a libp2p host listening on listenAddr
@@ -74,6 +76,7 @@ func NewP2PService(parentCtx context.Context, hostInfo utils.PeerInfo , protoID
         peers:      make(map[peer.ID]peer.AddrInfo),
         Inbound:    make(chan PeerMessage, 32),
         Outbound:   make(chan *PeerMessage, 32),
+        Connected:  make(chan peer.AddrInfo, 32),
     }
 
     // register handler for incoming streams
@@ -107,14 +110,30 @@ func (s *P2PService) Stop() error {
 func (s *P2PService) Connect(info *peer.AddrInfo){
 	s.peerLock.Lock()
 	s.peers[info.ID] = *info
-	defer s.peerLock.Unlock()
 	s.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
 	if err := s.host.Connect(s.ctx, *info); err !=nil{
+		s.peerLock.Unlock()
 		log.Printf("Could Not Connect to %s", info.ID)
 		return 
 	}
 
 	s.connPeers[info.ID] = *info
+	s.peerLock.Unlock()
+
+	select{
+	case s.Connected <- *info:
+	case <-s.ctx.Done():
+	}
+}
+
+// ID returns the peer ID of the local host
+func (s *P2PService) ID() peer.ID {
+    return s.host.ID()
+}
+
+// PrivKey returns the identity key of the local host
+func (s *P2PService) PrivKey() crypto.PrivKey {
+    return s.host.Peerstore().PrivKey(s.host.ID())
 }
 
 // ListPeers returns the IDs of connected peers
@@ -239,14 +258,28 @@ func (s *P2PService) handleStream(stream network.Stream) {
     s.handleGetBlockIn(&pm)  
   case MsgTypeBlock:
     s.handleBlockIn(&pm)
+  case MsgTypeStatus:
+    s.handleStatusIn(&pm)
+  case MsgTypeGetBlocks, MsgTypeBlocks, MsgTypePending, MsgTypeConsensus, MsgTypeRaft:
+    s.Inbound <- pm
   }
 }
 
 
 func (s *P2PService) handleMsg(pmsg *PeerMessage){
   switch pmsg.Msg.Type{
-    case MsgTypeGossip:
+    case MsgTypeGossip, MsgTypeConsensus:
       s.broadcastMsg(pmsg.Msg)
+    case MsgTypeRaft:
+      // raft tolerates reordered messages, and dialing a dead member must
+      // not hold back the heartbeats to the others
+      go s.sendMsg(pmsg.To.ID, pmsg.Msg)
+    case MsgTypePending:
+      if pmsg.To == nil{
+        s.broadcastMsg(pmsg.Msg)
+      } else {
+        s.sendMsg(pmsg.To.ID, pmsg.Msg)
+      }
     default:
      s.sendMsg(pmsg.To.ID, pmsg.Msg) 
   }
@@ -287,6 +320,18 @@ func (s *P2PService) handleBlockIn(msg *PeerMessage){
 	s.Inbound <- *msg
 }
 
+// handleStatusIn remembers peers that dialed us so that they also receive
+// broadcasts, then hands the status to the node
+func (s *P2PService) handleStatusIn(msg *PeerMessage){
+	s.peerLock.Lock()
+	if _, ok := s.peers[msg.From.ID]; !ok{
+		s.peers[msg.From.ID] = *msg.From
+	}
+	s.peerLock.Unlock()
+
+	s.Inbound <- *msg
+}
+
 func (s *P2PService) handleHiIn(msg *PeerMessage){
 	for _, info := range msg.Msg.Peers{
 		if _, ok := s.peers[info.ID]; ok{
@@ -0,0 +1,241 @@
+package p2p
+
+import (
+	"sync"
+
+	"blockchain-service/internal/blockchain"
+)
+
+// PendingPool holds documents waiting to be mined, deduplicated by file hash,
+// and notary registry and document status transactions, deduplicated by
+// transaction hash
+type PendingPool struct{
+	lock sync.Mutex
+	queue []*blockchain.BlockData
+	hashes map[string]struct{}
+	notaries txQueue[*blockchain.NotaryTx]
+	statuses txQueue[*blockchain.StatusTx]
+	ready chan struct{}
+}
+
+func NewPendingPool() *PendingPool{
+	return &PendingPool{
+		queue: make([]*blockchain.BlockData, 0),
+		hashes: make(map[string]struct{}),
+		notaries: newTxQueue[*blockchain.NotaryTx](),
+		statuses: newTxQueue[*blockchain.StatusTx](),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// txQueue holds pending transactions in arrival order, deduplicated by hash
+type txQueue[T interface{ Hash() []byte }] struct{
+	queue []T
+	hashes map[string]struct{}
+}
+
+func newTxQueue[T interface{ Hash() []byte }]() txQueue[T]{
+	return txQueue[T]{
+		queue: make([]T, 0),
+		hashes: make(map[string]struct{}),
+	}
+}
+
+func (q *txQueue[T]) add(tx T) bool{
+	key := string(tx.Hash())
+	if _, ok := q.hashes[key]; ok{
+		return false
+	}
+	q.hashes[key] = struct{}{}
+	q.queue = append(q.queue, tx)
+	return true
+}
+
+func (q *txQueue[T]) remove(txs []T){
+	removed := map[string]bool{}
+	for _, tx := range txs{
+		removed[string(tx.Hash())] = true
+	}
+	queue := make([]T, 0, len(q.queue))
+	for _, tx := range q.queue{
+		key := string(tx.Hash())
+		if removed[key]{
+			delete(q.hashes, key)
+			continue
+		}
+		queue = append(queue, tx)
+	}
+	q.queue = queue
+}
+
+// Add queues a document and reports whether it was not already pending
+func (p *PendingPool) Add(data *blockchain.BlockData) bool{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := string(data.Hash)
+	if _, ok := p.hashes[key]; ok{
+		return false
+	}
+	p.hashes[key] = struct{}{}
+	p.queue = append(p.queue, data)
+	p.signal()
+	return true
+}
+
+// signal wakes up the miner without blocking
+func (p *PendingPool) signal(){
+	select{
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Pop removes and returns the oldest pending document, or nil if the pool is empty
+func (p *PendingPool) Pop() *blockchain.BlockData{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.queue) == 0{
+		return nil
+	}
+	data := p.queue[0]
+	p.queue = p.queue[1:]
+	delete(p.hashes, string(data.Hash))
+	return data
+}
+
+// PopN removes and returns up to n of the oldest pending documents
+func (p *PendingPool) PopN(n int) []*blockchain.BlockData{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	n = min(n, len(p.queue))
+	batch := p.queue[:n:n]
+	p.queue = p.queue[n:]
+	for _, data := range batch{
+		delete(p.hashes, string(data.Hash))
+	}
+	return batch
+}
+
+// Requeue puts documents back in front of the pool, in order, skipping the
+// ones that are pending again already
+func (p *PendingPool) Requeue(batch []*blockchain.BlockData){
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	front := make([]*blockchain.BlockData, 0, len(batch)+len(p.queue))
+	for _, data := range batch{
+		if _, ok := p.hashes[string(data.Hash)]; ok{
+			continue
+		}
+		p.hashes[string(data.Hash)] = struct{}{}
+		front = append(front, data)
+	}
+	if len(front) == 0{
+		return
+	}
+	p.queue = append(front, p.queue...)
+	p.signal()
+}
+
+// Remove drops the given documents from the pool if they are pending
+func (p *PendingPool) Remove(hashes [][]byte){
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	removed := false
+	for _, hash := range hashes{
+		if _, ok := p.hashes[string(hash)]; ok{
+			delete(p.hashes, string(hash))
+			removed = true
+		}
+	}
+	if !removed{
+		return
+	}
+
+	queue := make([]*blockchain.BlockData, 0, len(p.hashes))
+	for _, data := range p.queue{
+		if _, ok := p.hashes[string(data.Hash)]; ok{
+			queue = append(queue, data)
+		}
+	}
+	p.queue = queue
+}
+
+// Snapshot returns the pending documents, oldest first
+func (p *PendingPool) Snapshot() []*blockchain.BlockData{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*blockchain.BlockData{}, p.queue...)
+}
+
+// AddNotary queues a registry transaction and reports whether it was not
+// already pending
+func (p *PendingPool) AddNotary(tx *blockchain.NotaryTx) bool{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.notaries.add(tx){
+		return false
+	}
+	p.signal()
+	return true
+}
+
+// RemoveNotaries drops the given registry transactions from the pool if they
+// are pending
+func (p *PendingPool) RemoveNotaries(txs []*blockchain.NotaryTx){
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.notaries.remove(txs)
+}
+
+// Notaries returns the pending registry transactions, oldest first
+func (p *PendingPool) Notaries() []*blockchain.NotaryTx{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*blockchain.NotaryTx{}, p.notaries.queue...)
+}
+
+// AddStatus queues a status transaction and reports whether it was not
+// already pending
+func (p *PendingPool) AddStatus(tx *blockchain.StatusTx) bool{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.statuses.add(tx){
+		return false
+	}
+	p.signal()
+	return true
+}
+
+// RemoveStatuses drops the given status transactions from the pool if they
+// are pending
+func (p *PendingPool) RemoveStatuses(txs []*blockchain.StatusTx){
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.statuses.remove(txs)
+}
+
+// Statuses returns the pending status transactions, oldest first
+func (p *PendingPool) Statuses() []*blockchain.StatusTx{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*blockchain.StatusTx{}, p.statuses.queue...)
+}
+
+// Len returns the number of pending documents and transactions
+func (p *PendingPool) Len() int{
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.queue) + len(p.notaries.queue) + len(p.statuses.queue)
+}
+
+// Ready is signalled whenever a document or transaction is added to the pool
+func (p *PendingPool) Ready() <-chan struct{}{
+	return p.ready
+}
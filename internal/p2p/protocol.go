@@ -3,11 +3,12 @@ package p2p
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"io"
 
+	"blockchain-service/internal/bft"
 	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/raft"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 )
@@ -20,20 +21,40 @@ const (
     MsgTypeBlock    = "BLOCK"
     MsgTypeHi    = "HI"
     MsgTypeWhat    = "WHAT"
+    MsgTypeStatus   = "STATUS"
+    MsgTypeGetBlocks = "GETBLOCKS"
+    MsgTypeBlocks   = "BLOCKS"
+    MsgTypePending  = "PENDING"
+    MsgTypeConsensus = "CONSENSUS"
+    MsgTypeRaft     = "RAFT"
 )
 
-// Message is the envelope for all protocol messages
+// Message is the envelope for all protocol messages. It travels as the
+// Envelope message of proto/p2p.proto.
 type Message struct {
-    Type      string   `json:"type"`
+    Type      string
     // HELLO fields
-    ID        string   `json:"id,omitempty"`       // sender node ID
-    Height    uint64   `json:"height,omitempty"`   // sender chain height
-    Version   string   `json:"version,omitempty"`  // protocol version
-    Peers     []*peer.AddrInfo      `json:"peers,omitempty"`    // list of known peers (multiaddrs)
+    ID        string           // sender node ID
+    Height    uint64           // sender chain height
+    Version   string           // protocol version
+    Peers     []*peer.AddrInfo // list of known peers (multiaddrs)
     // INV / GETBLOCK fields
-    BlockHash string   `json:"blockHash,omitempty"`
+    BlockHash string
     // BLOCK field
-    Block     *blockchain.Block   `json:"block,omitempty"`
+    Block     *blockchain.Block
+    // GETBLOCKS fields
+    StartHeight uint64 // first main chain height requested
+    Limit     uint64   // maximum number of blocks requested
+    // BLOCKS field
+    Blocks    []*blockchain.Block // consecutive blocks in ascending height
+    // PENDING field
+    Pending   []*blockchain.BlockData // documents waiting to be mined
+    Notaries  []*blockchain.NotaryTx  // registry transactions waiting to be mined
+    Statuses  []*blockchain.StatusTx  // status transactions waiting to be mined
+    // CONSENSUS field
+    Consensus *bft.Message // BFT proposal or vote
+    // RAFT field
+    Raft      *raft.Message // raft vote or log replication
 }
 
 
@@ -50,17 +71,41 @@ func NewGetBlockMsg(blockHash string) *Message {
 func NewBlockMsg(blk *blockchain.Block) *Message {
     return &Message{Type: MsgTypeBlock, Block: blk}
 }
+func NewStatusMsg(height uint64, lastHash string) *Message {
+    return &Message{Type: MsgTypeStatus, Height: height, BlockHash: lastHash}
+}
+func NewGetBlocksMsg(startHeight uint64, limit uint64) *Message {
+    return &Message{Type: MsgTypeGetBlocks, StartHeight: startHeight, Limit: limit}
+}
+func NewBlocksMsg(blocks []*blockchain.Block, height uint64) *Message {
+    return &Message{Type: MsgTypeBlocks, Blocks: blocks, Height: height}
+}
+func NewPendingMsg(pending []*blockchain.BlockData) *Message {
+    return &Message{Type: MsgTypePending, Pending: pending}
+}
+
+func NewPendingNotariesMsg(notaries []*blockchain.NotaryTx) *Message {
+    return &Message{Type: MsgTypePending, Notaries: notaries}
+}
+
+func NewPendingStatusesMsg(statuses []*blockchain.StatusTx) *Message {
+    return &Message{Type: MsgTypePending, Statuses: statuses}
+}
+func NewConsensusMsg(msg *bft.Message) *Message {
+    return &Message{Type: MsgTypeConsensus, Consensus: msg}
+}
+func NewRaftMsg(msg *raft.Message) *Message {
+    return &Message{Type: MsgTypeRaft, Raft: msg}
+}
 func NewHiMsg(id string, height uint64, version string, peers []*peer.AddrInfo) *Message {
     return &Message{Type: MsgTypeHi, ID: id, Height: height, Version: version, Peers: peers}
 }
 
 
-// EncodeMessage serializes a Message to length-prefixed JSON
+// EncodeMessage serializes a Message to its length-prefixed canonical
+// encoding
 func EncodeMessage(msg *Message) ([]byte, error) {
-    payload, err := json.Marshal(msg)
-    if err != nil {
-        return nil, fmt.Errorf("json marshal: %w", err)
-    }
+    payload := msg.serialize()
     buf := new(bytes.Buffer)
     if err := binary.Write(buf, binary.BigEndian, uint32(len(payload))); err != nil {
         return nil, fmt.Errorf("write length: %w", err)
@@ -81,11 +126,11 @@ func DecodeNextMessage(r io.Reader) (*Message, error) {
     if _, err := io.ReadFull(r, payload); err != nil {
         return nil, fmt.Errorf("read payload: %w", err)
     }
-    var msg Message
-    if err := json.Unmarshal(payload, &msg); err != nil {
-        return nil, fmt.Errorf("json unmarshal: %w", err)
+    msg, err := deserializeMessage(payload)
+    if err != nil {
+        return nil, fmt.Errorf("decode message: %w", err)
     }
-    return &msg, nil
+    return msg, nil
 }
 
 // DecodeMessageBytes is a convenience wrapper for decoding from a byte slice
@@ -0,0 +1,110 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/raft"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newRaft creates the raft member of the node when the chain runs the raft
+// engine, or returns nil
+func newRaft(n *BlockchainNode) (*raft.Raft, error){
+	engine, ok := n.chain.Engine().(*blockchain.RaftEngine)
+	if !ok{
+		return nil, nil
+	}
+	config := raft.DefaultConfig(engine.Members(), n.p2p.ID())
+	storage := raft.NewStorage(n.chain.Database)
+	return raft.New(config, &raftApp{node: n}, &raftTransport{node: n}, storage)
+}
+
+// runRaft takes part in the raft cluster, waking the leader up whenever
+// documents are added to the pool. When a committed block cannot be applied
+// the node leaves the cluster and only serves the chain it has.
+func (n *BlockchainNode) runRaft(){
+	go func(){
+		for{
+			select{
+			case <-n.ctx.Done():
+				return
+			case <-n.pool.Ready():
+				n.raft.Kick()
+			}
+		}
+	}()
+
+	if err := n.raft.Run(n.ctx); err != nil && !errors.Is(err, context.Canceled){
+		log.Printf("Raft stopped: %v", err)
+	}
+}
+
+func (n *BlockchainNode) handleRaft(pmsg *PeerMessage){
+	if n.raft == nil || pmsg.Msg.Raft == nil{
+		return
+	}
+	n.raft.Receive(pmsg.From.ID, pmsg.Msg.Raft)
+}
+
+// isFinal reports whether a block can no longer leave the main chain: it
+// carries a BFT commit, or a majority of the raft members stored it
+func (n *BlockchainNode) isFinal(block *blockchain.Block) bool{
+	return block.IsFinal() || n.raft != nil
+}
+
+type raftTransport struct{
+	node *BlockchainNode
+}
+
+func (t *raftTransport) Send(to peer.ID, msg *raft.Message){
+	t.node.outbound <- &PeerMessage{To: &peer.AddrInfo{ID: to}, Msg: NewRaftMsg(msg)}
+}
+
+// raftApp connects the raft member to the chain and the pending pool
+type raftApp struct{
+	node *BlockchainNode
+}
+
+func (a *raftApp) Pending() bool{
+	return a.node.pool.Len() > 0
+}
+
+// ProposeBlock builds a block from the oldest pending documents that are not
+// anchored yet and the pending registry and status transactions. The documents stay in the pool until the block is applied.
+func (a *raftApp) ProposeBlock() (*blockchain.Block, error){
+	n := a.node
+	batch := []blockchain.BlockData{}
+	for _, data := range n.pool.Snapshot(){
+		if len(batch) == n.miner.MaxBlockData{
+			break
+		}
+		if !n.minable(data){
+			continue
+		}
+		batch = append(batch, *data)
+	}
+	notaries := n.pendingNotaries()
+	statuses := n.pendingStatuses()
+	if len(batch) == 0 && len(notaries) == 0 && len(statuses) == 0{
+		return nil, nil
+	}
+	return n.chain.CreateBlock(n.ctx, batch, notaries, statuses)
+}
+
+func (a *raftApp) Apply(block *blockchain.Block) error{
+	return a.node.processBlock(block)
+}
+
+// LeaderChanged hands our pool to a new leader, which may not have the
+// documents that were forwarded to the previous one
+func (a *raftApp) LeaderChanged(leader peer.ID){
+	n := a.node
+	if leader == "" || leader == n.ID(){
+		return
+	}
+	n.sendPending(peer.AddrInfo{ID: leader})
+}
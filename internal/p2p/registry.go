@@ -0,0 +1,79 @@
+package p2p
+
+import (
+	"log"
+
+	"blockchain-service/internal/blockchain"
+)
+
+// pendingNotaries returns the pending registry transactions that apply on top
+// of the current tip. The ones that were applied meanwhile or no longer apply
+// are dropped from the pool.
+func (n *BlockchainNode) pendingNotaries() []blockchain.NotaryTx{
+	pending := n.pool.Notaries()
+	if len(pending) == 0{
+		return nil
+	}
+
+	valid, rejected := n.chain.CheckNotaryTxs(pending)
+	for _, tx := range rejected{
+		if ok, err := n.chain.ContainsNotaryTx(tx.Hash()); err == nil && ok{
+			continue
+		}
+		log.Printf("Dropping notary tx %x for %s, it no longer applies", tx.Hash(), tx.NotaryID)
+	}
+	n.pool.RemoveNotaries(rejected)
+	return valid
+}
+
+// handlePendingNotaries queues the registry transactions relayed by a peer
+// and relays the ones that are new to our pool
+func (n *BlockchainNode) handlePendingNotaries(pmsg *PeerMessage){
+	added := []*blockchain.NotaryTx{}
+	for _, tx := range pmsg.Msg.Notaries{
+		if tx == nil{
+			continue
+		}
+		if err := n.chain.CheckNotaryTx(tx); err != nil{
+			log.Printf("Ignoring pending notary tx %x from %s: %v", tx.Hash(), pmsg.From.ID, err)
+			continue
+		}
+		if n.pool.AddNotary(tx){
+			added = append(added, tx)
+		}
+	}
+	n.relayNotaries(added)
+}
+
+// SubmitNotaryAPI queues a registry transaction signed by an admin, once it
+// applies to the current registry state
+func (n *BlockchainNode) SubmitNotaryAPI(tx *blockchain.NotaryTx) error{
+	if err := n.chain.CheckNotaryTx(tx); err != nil{
+		return err
+	}
+	if n.pool.AddNotary(tx){
+		n.relayNotaries([]*blockchain.NotaryTx{tx})
+	}
+	return nil
+}
+
+// NotaryAPI returns the current registry record of a notary and its history,
+// oldest first
+func (n *BlockchainNode) NotaryAPI(notaryID string) ([]*blockchain.NotaryRecord, error){
+	return n.chain.NotaryHistory(notaryID)
+}
+
+// NotaryAuthorizedAPI reports whether the notary of a document anchored at
+// height was authorized to sign it then. The record is nil and the result
+// false when the registry is disabled or the notary was not registered.
+func (n *BlockchainNode) NotaryAuthorizedAPI(data *blockchain.BlockData, height uint64) (*blockchain.NotaryRecord, bool, error){
+	if !n.chain.RegistryEnabled(){
+		return nil, false, nil
+	}
+	return n.chain.NotaryAuthorized(data, height)
+}
+
+// RegistryEnabledAPI reports whether notary registry admins are configured
+func (n *BlockchainNode) RegistryEnabledAPI() bool{
+	return n.chain.RegistryEnabled()
+}
@@ -0,0 +1,161 @@
+package p2p
+
+import (
+	"log"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// pendingBatchSize is the maximum number of documents sent in a single
+// PENDING message
+const pendingBatchSize = 256
+
+// relayPending broadcasts documents that were added to our pool, so that any
+// node can mine them and they survive a crash of the node that received them.
+// Under raft only the leader builds blocks, so they are forwarded to it
+// instead; while there is no leader they wait in the pool until one is
+// elected.
+func (n *BlockchainNode) relayPending(pending []*blockchain.BlockData){
+	to, ok := n.relayTarget()
+	if !ok{
+		return
+	}
+	for start := 0; start < len(pending); start += pendingBatchSize{
+		end := min(start+pendingBatchSize, len(pending))
+		n.outbound <- &PeerMessage{To: to, Msg: NewPendingMsg(pending[start:end])}
+	}
+}
+
+// relayNotaries broadcasts registry transactions that were added to our pool
+// like relayPending does for documents
+func (n *BlockchainNode) relayNotaries(txs []*blockchain.NotaryTx){
+	to, ok := n.relayTarget()
+	if !ok || len(txs) == 0{
+		return
+	}
+	n.outbound <- &PeerMessage{To: to, Msg: NewPendingNotariesMsg(txs)}
+}
+
+// relayStatuses broadcasts status transactions that were added to our pool
+// like relayPending does for documents
+func (n *BlockchainNode) relayStatuses(txs []*blockchain.StatusTx){
+	to, ok := n.relayTarget()
+	if !ok || len(txs) == 0{
+		return
+	}
+	n.outbound <- &PeerMessage{To: to, Msg: NewPendingStatusesMsg(txs)}
+}
+
+// relayTarget returns the peer pending entries are relayed to, nil for every
+// peer, and false when they must stay in our pool for now
+func (n *BlockchainNode) relayTarget() (*peer.AddrInfo, bool){
+	if n.raft == nil{
+		return nil, true
+	}
+	leader := n.raft.Leader()
+	if leader == "" || leader == n.ID(){
+		return nil, false
+	}
+	return &peer.AddrInfo{ID: leader}, true
+}
+
+// sendPending hands our whole pool to a newly connected peer
+func (n *BlockchainNode) sendPending(info peer.AddrInfo){
+	pending := n.pool.Snapshot()
+	for start := 0; start < len(pending); start += pendingBatchSize{
+		end := min(start+pendingBatchSize, len(pending))
+		n.outbound <- &PeerMessage{To: &info, Msg: NewPendingMsg(pending[start:end])}
+	}
+	if notaries := n.pool.Notaries(); len(notaries) > 0{
+		n.outbound <- &PeerMessage{To: &info, Msg: NewPendingNotariesMsg(notaries)}
+	}
+	if statuses := n.pool.Statuses(); len(statuses) > 0{
+		n.outbound <- &PeerMessage{To: &info, Msg: NewPendingStatusesMsg(statuses)}
+	}
+}
+
+// handlePending queues the documents and transactions relayed by a peer. Documents already on the main chain are done; the ones that are new to
+// our pool are relayed further, while known ones stop the flood.
+func (n *BlockchainNode) handlePending(pmsg *PeerMessage){
+	n.handlePendingNotaries(pmsg)
+	n.handlePendingStatuses(pmsg)
+
+	added := []*blockchain.BlockData{}
+	for _, data := range pmsg.Msg.Pending{
+		if data == nil || len(data.Hash) == 0{
+			log.Printf("Ignoring pending document without a hash from %s", pmsg.From.ID)
+			continue
+		}
+		if err := data.CheckHash(); err != nil{
+			log.Printf("Ignoring pending document %x from %s: %v", data.Hash, pmsg.From.ID, err)
+			continue
+		}
+		if err := data.VerifySignature(); err != nil{
+			log.Printf("Ignoring pending document %x from %s: %v", data.Hash, pmsg.From.ID, err)
+			continue
+		}
+		if err := n.chain.AuthorizeNotary(data); err != nil{
+			log.Printf("Ignoring pending document %x from %s: %v", data.Hash, pmsg.From.ID, err)
+			continue
+		}
+		ok, err := n.chain.ContainsFileHash(data.Hash)
+		if err != nil{
+			log.Printf("Failed to look up pending document %x: %v", data.Hash, err)
+			continue
+		}
+		if ok{
+			continue
+		}
+		if n.pool.Add(data){
+			added = append(added, data)
+		}
+	}
+	n.relayPending(added)
+}
+
+// minable reports whether a pending document can go into the next block: it
+// is not anchored yet and the current registry authorizes its notary.
+// Documents whose notary is not authorized anymore are dropped from the pool.
+func (n *BlockchainNode) minable(data *blockchain.BlockData) bool{
+	if ok, err := n.chain.ContainsFileHash(data.Hash); err == nil && ok{
+		// a peer or an earlier block already anchored it
+		return false
+	}
+	if err := n.chain.AuthorizeNotary(data); err != nil{
+		log.Printf("Dropping pending document %x: %v", data.Hash, err)
+		n.pool.Remove([][]byte{data.Hash})
+		return false
+	}
+	return true
+}
+
+// dropAnchored removes from the pool the documents and transactions of block
+// that are now on the main chain. Entries of side branch blocks stay
+// pending.
+func (n *BlockchainNode) dropAnchored(block *blockchain.Block){
+	anchored := [][]byte{}
+	for i := range block.Data{
+		if ok, err := n.chain.ContainsFileHash(block.Data[i].Hash); err == nil && ok{
+			anchored = append(anchored, block.Data[i].Hash)
+		}
+	}
+	n.pool.Remove(anchored)
+
+	applied := []*blockchain.NotaryTx{}
+	for i := range block.Notaries{
+		if ok, err := n.chain.ContainsNotaryTx(block.Notaries[i].Hash()); err == nil && ok{
+			applied = append(applied, &block.Notaries[i])
+		}
+	}
+	n.pool.RemoveNotaries(applied)
+
+	changed := []*blockchain.StatusTx{}
+	for i := range block.Statuses{
+		if ok, err := n.chain.ContainsStatusTx(&block.Statuses[i]); err == nil && ok{
+			changed = append(changed, &block.Statuses[i])
+		}
+	}
+	n.pool.RemoveStatuses(changed)
+}
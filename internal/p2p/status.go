@@ -0,0 +1,64 @@
+package p2p
+
+import (
+	"log"
+
+	"blockchain-service/internal/blockchain"
+)
+
+// pendingStatuses returns the pending status transactions that apply on top
+// of the current tip. The ones that were applied meanwhile or no longer apply
+// are dropped from the pool.
+func (n *BlockchainNode) pendingStatuses() []blockchain.StatusTx{
+	pending := n.pool.Statuses()
+	if len(pending) == 0{
+		return nil
+	}
+
+	valid, rejected := n.chain.CheckStatusTxs(pending)
+	for _, tx := range rejected{
+		if ok, err := n.chain.ContainsStatusTx(tx); err == nil && ok{
+			continue
+		}
+		log.Printf("Dropping status tx %x for document %x, it no longer applies", tx.Hash(), tx.Target)
+	}
+	n.pool.RemoveStatuses(rejected)
+	return valid
+}
+
+// handlePendingStatuses queues the status transactions relayed by a peer and
+// relays the ones that are new to our pool
+func (n *BlockchainNode) handlePendingStatuses(pmsg *PeerMessage){
+	added := []*blockchain.StatusTx{}
+	for _, tx := range pmsg.Msg.Statuses{
+		if tx == nil{
+			continue
+		}
+		if err := n.chain.CheckStatusTx(tx); err != nil{
+			log.Printf("Ignoring pending status tx %x from %s: %v", tx.Hash(), pmsg.From.ID, err)
+			continue
+		}
+		if n.pool.AddStatus(tx){
+			added = append(added, tx)
+		}
+	}
+	n.relayStatuses(added)
+}
+
+// SubmitStatusAPI queues the revocation or supersession of an anchored
+// document, once it applies to the current tip
+func (n *BlockchainNode) SubmitStatusAPI(tx *blockchain.StatusTx) error{
+	if err := n.chain.CheckStatusTx(tx); err != nil{
+		return err
+	}
+	if n.pool.AddStatus(tx){
+		n.relayStatuses([]*blockchain.StatusTx{tx})
+	}
+	return nil
+}
+
+// DocumentHistoryAPI returns the events of a document on the main chain,
+// oldest first
+func (n *BlockchainNode) DocumentHistoryAPI(hash []byte) ([]blockchain.DocumentEvent, error){
+	return n.chain.DocumentHistory(hash)
+}
@@ -0,0 +1,114 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+)
+
+// ConfirmedDepth is the number of confirmations, counting the anchoring
+// block, from which a submission is reported as confirmed. Blocks finalized
+// by BFT validators are confirmed right away.
+const ConfirmedDepth = 6
+
+// submissionTTL is how long a submission can be polled after it was made
+const submissionTTL = 24 * time.Hour
+
+// Submission states reported by SubmissionAPI
+const(
+	SubmissionPending = "pending"
+	SubmissionMined = "mined"
+	SubmissionConfirmed = "confirmed"
+)
+
+// ErrSubmissionNotFound is returned for unknown or expired submission IDs
+var ErrSubmissionNotFound = errors.New("submission not found")
+
+// Submission is a document accepted by this node for mining
+type Submission struct{
+	ID string
+	Data *blockchain.BlockData
+	SubmittedAt int64
+}
+
+// SubmissionStatus is the current state of a submission. Block and
+// Confirmations are only set once the document is on the main chain.
+type SubmissionStatus struct{
+	Submission *Submission
+	Status string
+	Block *blockchain.Block
+	Confirmations uint64
+}
+
+// Submissions keeps the submissions made to this node in memory, by ID and
+// by file hash, for submissionTTL
+type Submissions struct{
+	lock sync.Mutex
+	byID map[string]*Submission
+	byHash map[string]*Submission
+	order []*Submission
+}
+
+func NewSubmissions() *Submissions{
+	return &Submissions{
+		byID: make(map[string]*Submission),
+		byHash: make(map[string]*Submission),
+		order: make([]*Submission, 0),
+	}
+}
+
+// Add returns the submission of a document, creating one unless the same
+// file hash was already submitted
+func (s *Submissions) Add(data *blockchain.BlockData) (*Submission, error){
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	if sub, ok := s.byHash[string(data.Hash)]; ok{
+		return sub, nil
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil{
+		return nil, err
+	}
+	sub := &Submission{
+		ID: hex.EncodeToString(id),
+		Data: data,
+		SubmittedAt: now.UnixMilli(),
+	}
+	s.byID[sub.ID] = sub
+	s.byHash[string(data.Hash)] = sub
+	s.order = append(s.order, sub)
+	return sub, nil
+}
+
+func (s *Submissions) Get(id string) (*Submission, bool){
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(time.Now())
+	sub, ok := s.byID[id]
+	return sub, ok
+}
+
+// prune drops the submissions older than submissionTTL. Submissions are
+// kept in order, so only the front of the list needs to be checked.
+func (s *Submissions) prune(now time.Time){
+	limit := now.Add(-submissionTTL).UnixMilli()
+
+	expired := 0
+	for expired < len(s.order) && s.order[expired].SubmittedAt < limit{
+		sub := s.order[expired]
+		delete(s.byID, sub.ID)
+		delete(s.byHash, string(sub.Data.Hash))
+		expired++
+	}
+	s.order = s.order[expired:]
+}
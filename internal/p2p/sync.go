@@ -0,0 +1,155 @@
+package p2p
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const(
+	// syncBatchSize is the maximum number of blocks sent in a single BLOCKS message
+	syncBatchSize = 64
+	// syncTimeout is how long we wait for a BLOCKS reply before another peer
+	// may take over the sync
+	syncTimeout = 10 * time.Second
+)
+
+// announceStatus sends our chain height to a peer so that whichever side is
+// behind starts syncing
+func (n *BlockchainNode) announceStatus(info peer.AddrInfo){
+	hash, height := n.chain.Tip()
+	n.outbound <- &PeerMessage{
+		To: &info,
+		Msg: NewStatusMsg(height, hex.EncodeToString(hash)),
+	}
+}
+
+func (n *BlockchainNode) handleStatus(pmsg *PeerMessage){
+	height := n.chain.Height()
+
+	switch{
+	case pmsg.Msg.Height > height:
+		n.startSync(pmsg.From, pmsg.Msg.Height)
+	case pmsg.Msg.Height < height:
+		// we are ahead, answer so the peer syncs from us
+		n.announceStatus(*pmsg.From)
+	}
+}
+
+// startSync begins requesting blocks from a peer that reported a higher
+// chain. A running sync is only replaced by a peer with a higher chain or
+// once it has timed out.
+func (n *BlockchainNode) startSync(from *peer.AddrInfo, target uint64){
+	if n.syncPeer != nil && target <= n.syncTarget && time.Now().Before(n.syncDeadline){
+		return
+	}
+
+	height := n.chain.Height()
+	log.Printf("Syncing from %s: local height %d, peer height %d", from.ID, height, target)
+	n.syncPeer = from
+	n.syncTarget = target
+	n.syncStart = min(height+1, target)
+	n.syncBack = 1
+	n.requestBlocks()
+}
+
+func (n *BlockchainNode) requestBlocks(){
+	n.syncDeadline = time.Now().Add(syncTimeout)
+	n.outbound <- &PeerMessage{
+		To: n.syncPeer,
+		Msg: NewGetBlocksMsg(n.syncStart, syncBatchSize),
+	}
+}
+
+func (n *BlockchainNode) resetSync(){
+	n.syncPeer = nil
+	n.syncTarget = 0
+}
+
+func (n *BlockchainNode) handleGetBlocks(pmsg *PeerMessage){
+	limit := pmsg.Msg.Limit
+	if limit == 0 || limit > syncBatchSize{
+		limit = syncBatchSize
+	}
+
+	blocks := make([]*blockchain.Block, 0, limit)
+	for height := pmsg.Msg.StartHeight; height < pmsg.Msg.StartHeight+limit; height++{
+		block, err := n.chain.GetBlockByHeight(height)
+		if errors.Is(err, blockchain.ErrBlockNotFound){
+			break
+		}
+		if err != nil{
+			log.Printf("Failed to read block at height %d: %v", height, err)
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	n.outbound <- &PeerMessage{
+		From: pmsg.To,
+		To: pmsg.From,
+		Msg: NewBlocksMsg(blocks, n.chain.Height()),
+	}
+}
+
+func (n *BlockchainNode) handleBlocks(pmsg *PeerMessage){
+	if n.syncPeer == nil || n.syncPeer.ID != pmsg.From.ID{
+		log.Printf("Ignoring unsolicited BLOCKS from %s", pmsg.From.ID)
+		return
+	}
+
+	blocks := pmsg.Msg.Blocks
+	for _, block := range blocks{
+		known, err := n.chain.ContainsBlock(block.Hash)
+		if err != nil{
+			log.Printf("Sync from %s aborted: %v", pmsg.From.ID, err)
+			n.resetSync()
+			return
+		}
+		if known{
+			continue
+		}
+		hasParent, err := n.chain.ContainsBlock(block.PrevHash)
+		if err != nil{
+			log.Printf("Sync from %s aborted: %v", pmsg.From.ID, err)
+			n.resetSync()
+			return
+		}
+		if !hasParent{
+			// the peer's branch forks below the requested range, look
+			// further back with exponentially growing steps
+			if n.syncStart <= 1{
+				log.Printf("Sync from %s aborted: no common ancestor", pmsg.From.ID)
+				n.resetSync()
+				return
+			}
+			n.syncStart -= min(n.syncBack, n.syncStart-1)
+			n.syncBack *= 2
+			n.requestBlocks()
+			return
+		}
+		if err := n.processBlock(block); err != nil{
+			log.Printf("Sync from %s aborted at height %d: %v", pmsg.From.ID, block.Height, err)
+			n.resetSync()
+			return
+		}
+	}
+
+	if len(blocks) > 0{
+		n.syncStart = blocks[len(blocks)-1].Height + 1
+	}
+	if pmsg.Msg.Height > n.syncTarget{
+		n.syncTarget = pmsg.Msg.Height
+	}
+	if len(blocks) < syncBatchSize || n.syncStart > n.syncTarget{
+		log.Printf("Chain synced at height %d", n.chain.Height())
+		n.resetSync()
+		return
+	}
+	n.requestBlocks()
+}
@@ -0,0 +1,138 @@
+package raft
+
+import (
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/codec"
+)
+
+// Field numbers of the messages in proto/p2p.proto
+const(
+	entryIndex = iota + 1
+	entryTerm
+	entryBlock
+)
+
+const(
+	messageType = iota + 1
+	messageTerm
+	messageLastIndex
+	messageLastTerm
+	messageGranted
+	messagePrevIndex
+	messagePrevTerm
+	messageEntries
+	messageCommit
+	messageSuccess
+	messageMatch
+)
+
+// Serialize returns the canonical encoding of the entry, which is also how
+// it is stored
+func (entry *Entry) Serialize() []byte{
+	var e codec.Encoder
+	e.Uint(entryIndex, entry.Index)
+	e.Uint(entryTerm, entry.Term)
+	if entry.Block != nil{
+		block, _ := entry.Block.Serialize()
+		e.Message(entryBlock, block)
+	}
+	return e.Encoded()
+}
+
+// DeserializeEntry decodes an entry from its canonical encoding
+func DeserializeEntry(data []byte) (*Entry, error){
+	entry, err := decodeEntry(data)
+	if err != nil{
+		return nil, err
+	}
+	if err := codec.Canonical(data, entry.Serialize()); err != nil{
+		return nil, err
+	}
+	return entry, nil
+}
+
+func decodeEntry(data []byte) (*Entry, error){
+	var entry Entry
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case entryIndex:
+			entry.Index = d.Uint()
+		case entryTerm:
+			entry.Term = d.Uint()
+		case entryBlock:
+			block, err := blockchain.Deserialize(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			entry.Block = block
+		default:
+			d.Skip()
+		}
+	}
+	return &entry, d.Err()
+}
+
+// Serialize returns the canonical encoding of the message
+func (m *Message) Serialize() []byte{
+	var e codec.Encoder
+	e.Uint(messageType, uint64(m.Type))
+	e.Uint(messageTerm, m.Term)
+	e.Uint(messageLastIndex, m.LastIndex)
+	e.Uint(messageLastTerm, m.LastTerm)
+	e.Bool(messageGranted, m.Granted)
+	e.Uint(messagePrevIndex, m.PrevIndex)
+	e.Uint(messagePrevTerm, m.PrevTerm)
+	for i := range m.Entries{
+		e.Message(messageEntries, m.Entries[i].Serialize())
+	}
+	e.Uint(messageCommit, m.Commit)
+	e.Bool(messageSuccess, m.Success)
+	e.Uint(messageMatch, m.Match)
+	return e.Encoded()
+}
+
+// DeserializeMessage decodes a message from its canonical encoding
+func DeserializeMessage(data []byte) (*Message, error){
+	var m Message
+	d := codec.NewDecoder(data)
+	for d.More(){
+		switch d.Field(){
+		case messageType:
+			m.Type = byte(d.Uint32())
+		case messageTerm:
+			m.Term = d.Uint()
+		case messageLastIndex:
+			m.LastIndex = d.Uint()
+		case messageLastTerm:
+			m.LastTerm = d.Uint()
+		case messageGranted:
+			m.Granted = d.Bool()
+		case messagePrevIndex:
+			m.PrevIndex = d.Uint()
+		case messagePrevTerm:
+			m.PrevTerm = d.Uint()
+		case messageEntries:
+			entry, err := decodeEntry(d.Message())
+			if err != nil{
+				return nil, err
+			}
+			m.Entries = append(m.Entries, *entry)
+		case messageCommit:
+			m.Commit = d.Uint()
+		case messageSuccess:
+			m.Success = d.Bool()
+		case messageMatch:
+			m.Match = d.Uint()
+		default:
+			d.Skip()
+		}
+	}
+	if err := d.Err(); err != nil{
+		return nil, err
+	}
+	if err := codec.Canonical(data, m.Serialize()); err != nil{
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,49 @@
+// Package raft orders blocks among a fixed set of members with the Raft
+// consensus algorithm. An elected leader assembles blocks from the pending
+// documents and replicates them as log entries; a block is applied to the
+// chain of every member once a majority stored it. Raft only tolerates
+// crashes, not members that lie, in exchange for committing a block in a
+// single round trip.
+package raft
+
+import (
+	"blockchain-service/internal/blockchain"
+)
+
+// Message types
+const(
+	MsgVote byte = iota + 1
+	MsgVoteResponse
+	MsgAppend
+	MsgAppendResponse
+)
+
+// Entry is a log entry. Entries without a block are appended by a new leader
+// to commit the entries of the previous terms.
+type Entry struct{
+	Index uint64 `json:"index"`
+	Term uint64 `json:"term"`
+	Block *blockchain.Block `json:"block,omitempty"`
+}
+
+// Message is a raft message on the wire. The sender is the authenticated
+// peer of the stream it arrived on.
+type Message struct{
+	Type byte `json:"type"`
+	Term uint64 `json:"term"`
+	// MsgVote: the last entry of the candidate
+	LastIndex uint64 `json:"lastIndex,omitempty"`
+	LastTerm uint64 `json:"lastTerm,omitempty"`
+	// MsgVoteResponse
+	Granted bool `json:"granted,omitempty"`
+	// MsgAppend: the entries following PrevIndex, and the commit index of
+	// the leader
+	PrevIndex uint64 `json:"prevIndex,omitempty"`
+	PrevTerm uint64 `json:"prevTerm,omitempty"`
+	Entries []Entry `json:"entries,omitempty"`
+	Commit uint64 `json:"commit,omitempty"`
+	// MsgAppendResponse: the last index known to match the leader's log on
+	// success, otherwise the last index of the follower's log
+	Success bool `json:"success,omitempty"`
+	Match uint64 `json:"match,omitempty"`
+}
@@ -0,0 +1,553 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Default timings. A follower that hears nothing from the leader for a
+// random time between ElectionTimeout and twice that starts an election.
+const(
+	DefaultHeartbeatInterval = 250 * time.Millisecond
+	DefaultElectionTimeout = time.Second
+)
+
+const(
+	// messageQueueSize is the number of received messages waiting to be
+	// handled before new ones are dropped
+	messageQueueSize = 1024
+	// maxAppendEntries is the number of entries sent in one MsgAppend
+	maxAppendEntries = 64
+)
+
+// Role of a member
+type Role uint8
+
+const(
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string{
+	switch r{
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+// Transport sends raft messages to other members
+type Transport interface{
+	Send(to peer.ID, msg *Message)
+}
+
+// Application is the chain that committed blocks are applied to
+type Application interface{
+	// Pending reports whether there are documents waiting for a block
+	Pending() bool
+	// ProposeBlock returns a new block on top of the chain tip, or nil when
+	// there is nothing to propose
+	ProposeBlock() (*blockchain.Block, error)
+	// Apply stores a committed block
+	Apply(block *blockchain.Block) error
+	// LeaderChanged is called when the known leader changes. leader is empty
+	// while an election is running.
+	LeaderChanged(leader peer.ID)
+}
+
+type Config struct{
+	Members []peer.ID
+	ID peer.ID
+	HeartbeatInterval time.Duration
+	ElectionTimeout time.Duration
+}
+
+func DefaultConfig(members []peer.ID, id peer.ID) Config{
+	return Config{
+		Members: members,
+		ID: id,
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		ElectionTimeout: DefaultElectionTimeout,
+	}
+}
+
+type envelope struct{
+	from peer.ID
+	msg *Message
+}
+
+// Raft runs the protocol for one member. Only the leader proposes blocks,
+// one at a time: the next block is built once the previous one is applied,
+// on top of it.
+type Raft struct{
+	config Config
+	app Application
+	transport Transport
+	storage *Storage
+
+	messages chan envelope
+	kick chan struct{}
+
+	leaderLock sync.RWMutex
+	leader peer.ID
+
+	// only touched by Run
+	state State
+	role Role
+	commit uint64
+	votes map[peer.ID]bool
+	next map[peer.ID]uint64
+	match map[peer.ID]uint64
+	deadline time.Time
+	// failed stops Run: a committed entry could not be applied, so this
+	// member's chain no longer follows the log
+	failed error
+}
+
+func New(config Config, app Application, transport Transport, storage *Storage) (*Raft, error){
+	r := &Raft{
+		config: config,
+		app: app,
+		transport: transport,
+		storage: storage,
+		messages: make(chan envelope, messageQueueSize),
+		kick: make(chan struct{}, 1),
+	}
+	if !r.isMember(config.ID){
+		return nil, fmt.Errorf("%s is not a raft member", config.ID)
+	}
+
+	state, err := storage.State()
+	if err != nil{
+		return nil, err
+	}
+	r.state = state
+	// applied entries were committed
+	r.commit = state.Applied
+	return r, nil
+}
+
+// Leader returns the current leader, or an empty ID during an election
+func (r *Raft) Leader() peer.ID{
+	r.leaderLock.RLock()
+	defer r.leaderLock.RUnlock()
+	return r.leader
+}
+
+// Receive queues a message from another member. It never blocks; when the
+// queue is full the message is dropped, which the protocol tolerates.
+func (r *Raft) Receive(from peer.ID, msg *Message){
+	select{
+	case r.messages <- envelope{from, msg}:
+	default:
+		log.Printf("Raft queue full, dropping message from %s", from)
+	}
+}
+
+// Kick tells the leader that documents are pending
+func (r *Raft) Kick(){
+	select{
+	case r.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run takes part in the cluster until ctx is done, or until a committed
+// block cannot be applied. The member then stops, as if it had crashed,
+// rather than stall with every later entry unapplied.
+func (r *Raft) Run(ctx context.Context) error{
+	r.resetElection()
+	ticker := time.NewTicker(r.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-ctx.Done():
+			return ctx.Err()
+		case env := <-r.messages:
+			r.handle(env.from, env.msg)
+		case <-ticker.C:
+			r.tick()
+		case <-r.kick:
+			r.propose()
+		}
+		if r.failed != nil{
+			r.setLeader("")
+			return r.failed
+		}
+	}
+}
+
+func (r *Raft) isMember(id peer.ID) bool{
+	for _, member := range r.config.Members{
+		if member == id{
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Raft) majority() int{
+	return len(r.config.Members)/2 + 1
+}
+
+func (r *Raft) persist(){
+	if err := r.storage.SetState(r.state); err != nil{
+		log.Printf("Failed to persist raft state: %v", err)
+	}
+}
+
+func (r *Raft) termAt(index uint64) (uint64, error){
+	entry, err := r.storage.Entry(index)
+	if err != nil{
+		return 0, err
+	}
+	return entry.Term, nil
+}
+
+func (r *Raft) lastTerm() uint64{
+	term, err := r.termAt(r.state.Last)
+	if err != nil{
+		log.Printf("Failed to read raft entry %d: %v", r.state.Last, err)
+	}
+	return term
+}
+
+func (r *Raft) resetElection(){
+	timeout := r.config.ElectionTimeout
+	r.deadline = time.Now().Add(timeout + time.Duration(rand.Int63n(int64(timeout))))
+}
+
+func (r *Raft) setLeader(leader peer.ID){
+	r.leaderLock.Lock()
+	changed := r.leader != leader
+	r.leader = leader
+	r.leaderLock.Unlock()
+
+	if !changed{
+		return
+	}
+	if leader != ""{
+		log.Printf("Raft leader for term %d is %s", r.state.Term, leader)
+	}
+	r.app.LeaderChanged(leader)
+}
+
+func (r *Raft) tick(){
+	if r.role == Leader{
+		r.broadcastAppend()
+		r.propose()
+		return
+	}
+	if time.Now().After(r.deadline){
+		r.campaign()
+	}
+}
+
+func (r *Raft) becomeFollower(term uint64, leader peer.ID){
+	if term > r.state.Term{
+		r.state.Term = term
+		r.state.Vote = ""
+		r.persist()
+	}
+	r.role = Follower
+	r.setLeader(leader)
+}
+
+func (r *Raft) campaign(){
+	r.role = Candidate
+	r.state.Term++
+	r.state.Vote = r.config.ID.String()
+	r.persist()
+	r.setLeader("")
+	r.votes = map[peer.ID]bool{r.config.ID: true}
+	r.resetElection()
+	log.Printf("Starting raft election for term %d", r.state.Term)
+
+	msg := &Message{
+		Type: MsgVote,
+		Term: r.state.Term,
+		LastIndex: r.state.Last,
+		LastTerm: r.lastTerm(),
+	}
+	for _, member := range r.config.Members{
+		if member != r.config.ID{
+			r.transport.Send(member, msg)
+		}
+	}
+	r.checkElection()
+}
+
+func (r *Raft) checkElection(){
+	if r.role == Candidate && len(r.votes) >= r.majority(){
+		r.becomeLeader()
+	}
+}
+
+// becomeLeader takes over the log. The empty entry appended in the new term
+// commits the entries left by earlier leaders once it is replicated.
+func (r *Raft) becomeLeader(){
+	r.role = Leader
+	r.setLeader(r.config.ID)
+
+	r.next = map[peer.ID]uint64{}
+	r.match = map[peer.ID]uint64{}
+	for _, member := range r.config.Members{
+		r.next[member] = r.state.Last + 1
+	}
+	if err := r.appendLocal(Entry{Index: r.state.Last + 1, Term: r.state.Term}); err != nil{
+		log.Printf("Failed to append raft entry: %v", err)
+		return
+	}
+	r.broadcastAppend()
+	r.advanceCommit()
+}
+
+// appendLocal appends an entry to the leader's own log
+func (r *Raft) appendLocal(entry Entry) error{
+	state := r.state
+	state.Last = entry.Index
+	if err := r.storage.Append([]Entry{entry}, state); err != nil{
+		return err
+	}
+	r.state = state
+	r.match[r.config.ID] = entry.Index
+	return nil
+}
+
+// propose appends a block with the pending documents once every entry of
+// the log is applied
+func (r *Raft) propose(){
+	if r.role != Leader || r.failed != nil || r.state.Applied != r.state.Last || !r.app.Pending(){
+		return
+	}
+
+	block, err := r.app.ProposeBlock()
+	if err != nil{
+		log.Printf("Failed to build a block: %v", err)
+		return
+	}
+	if block == nil{
+		return
+	}
+	if err := r.appendLocal(Entry{Index: r.state.Last + 1, Term: r.state.Term, Block: block}); err != nil{
+		log.Printf("Failed to append raft entry: %v", err)
+		return
+	}
+	r.broadcastAppend()
+	r.advanceCommit()
+}
+
+func (r *Raft) broadcastAppend(){
+	for _, member := range r.config.Members{
+		if member != r.config.ID{
+			r.sendAppend(member)
+		}
+	}
+}
+
+// sendAppend sends a member the entries it is missing, or a heartbeat
+func (r *Raft) sendAppend(to peer.ID){
+	prev := r.next[to] - 1
+	prevTerm, err := r.termAt(prev)
+	if err != nil{
+		log.Printf("Failed to read raft entry %d: %v", prev, err)
+		return
+	}
+	entries, err := r.storage.Entries(prev+1, r.state.Last, maxAppendEntries)
+	if err != nil{
+		log.Printf("Failed to read raft entries from %d: %v", prev+1, err)
+		return
+	}
+
+	r.transport.Send(to, &Message{
+		Type: MsgAppend,
+		Term: r.state.Term,
+		PrevIndex: prev,
+		PrevTerm: prevTerm,
+		Entries: entries,
+		Commit: r.commit,
+	})
+}
+
+// advanceCommit commits the last entry of the current term stored by a
+// majority, with every entry before it
+func (r *Raft) advanceCommit(){
+	for index := r.state.Last; index > r.commit; index--{
+		stored := 0
+		for _, member := range r.config.Members{
+			if r.match[member] >= index{
+				stored++
+			}
+		}
+		if stored < r.majority(){
+			continue
+		}
+		if term, err := r.termAt(index); err != nil || term != r.state.Term{
+			return
+		}
+
+		r.commit = index
+		r.apply()
+		r.broadcastAppend()
+		r.propose()
+		return
+	}
+}
+
+// apply hands the committed entries to the application in order. A block
+// the application refuses fails the member, as the other members applied it.
+func (r *Raft) apply(){
+	for r.state.Applied < r.commit && r.failed == nil{
+		entry, err := r.storage.Entry(r.state.Applied + 1)
+		if err != nil{
+			log.Printf("Failed to read raft entry %d: %v", r.state.Applied+1, err)
+			return
+		}
+		if entry.Block != nil{
+			if err := r.app.Apply(entry.Block); err != nil{
+				r.failed = fmt.Errorf("apply block %x of raft entry %d: %w", entry.Block.Hash, entry.Index, err)
+				return
+			}
+		}
+		r.state.Applied = entry.Index
+		r.persist()
+	}
+}
+
+func (r *Raft) handle(from peer.ID, msg *Message){
+	if msg == nil || !r.isMember(from){
+		return
+	}
+	if msg.Term > r.state.Term{
+		leader := peer.ID("")
+		if msg.Type == MsgAppend{
+			leader = from
+		}
+		r.becomeFollower(msg.Term, leader)
+	}
+
+	switch msg.Type{
+	case MsgVote:
+		r.handleVote(from, msg)
+	case MsgVoteResponse:
+		if r.role == Candidate && msg.Term == r.state.Term && msg.Granted{
+			r.votes[from] = true
+			r.checkElection()
+		}
+	case MsgAppend:
+		r.handleAppend(from, msg)
+	case MsgAppendResponse:
+		r.handleAppendResponse(from, msg)
+	}
+}
+
+// handleVote grants the vote of this term to the first candidate whose log
+// is at least as recent as ours
+func (r *Raft) handleVote(from peer.ID, msg *Message){
+	granted := false
+	if msg.Term == r.state.Term && (r.state.Vote == "" || r.state.Vote == from.String()){
+		lastTerm := r.lastTerm()
+		if msg.LastTerm > lastTerm || (msg.LastTerm == lastTerm && msg.LastIndex >= r.state.Last){
+			granted = true
+			r.state.Vote = from.String()
+			r.persist()
+			r.resetElection()
+		}
+	}
+	r.transport.Send(from, &Message{Type: MsgVoteResponse, Term: r.state.Term, Granted: granted})
+}
+
+func (r *Raft) handleAppend(from peer.ID, msg *Message){
+	reply := &Message{Type: MsgAppendResponse, Term: r.state.Term, Match: r.state.Last}
+	if msg.Term < r.state.Term{
+		r.transport.Send(from, reply)
+		return
+	}
+	if r.role != Follower || r.Leader() != from{
+		r.becomeFollower(msg.Term, from)
+	}
+	r.resetElection()
+
+	if msg.PrevIndex > r.state.Last{
+		r.transport.Send(from, reply)
+		return
+	}
+	if term, err := r.termAt(msg.PrevIndex); err != nil || term != msg.PrevTerm{
+		reply.Match = msg.PrevIndex - 1
+		r.transport.Send(from, reply)
+		return
+	}
+
+	// skip the entries we already have, and replace the log from the first
+	// conflicting one on
+	var missing []Entry
+	for i, entry := range msg.Entries{
+		if entry.Index != msg.PrevIndex+uint64(i)+1{
+			log.Printf("Ignoring raft append from %s with a gap at entry %d", from, entry.Index)
+			return
+		}
+		if entry.Index <= r.state.Last{
+			if term, err := r.termAt(entry.Index); err == nil && term == entry.Term{
+				continue
+			}
+			if entry.Index <= r.commit{
+				log.Printf("Raft leader %s conflicts with committed entry %d", from, entry.Index)
+				return
+			}
+		}
+		missing = msg.Entries[i:]
+		break
+	}
+	if len(missing) > 0{
+		state := r.state
+		state.Last = missing[len(missing)-1].Index
+		if err := r.storage.Append(missing, state); err != nil{
+			log.Printf("Failed to store raft entries: %v", err)
+			return
+		}
+		r.state = state
+	}
+
+	matched := msg.PrevIndex + uint64(len(msg.Entries))
+	if msg.Commit > r.commit{
+		r.commit = min(msg.Commit, matched)
+		r.apply()
+	}
+	reply.Success = true
+	reply.Match = matched
+	r.transport.Send(from, reply)
+}
+
+func (r *Raft) handleAppendResponse(from peer.ID, msg *Message){
+	if r.role != Leader || msg.Term != r.state.Term{
+		return
+	}
+
+	if msg.Success{
+		if msg.Match > r.match[from]{
+			r.match[from] = msg.Match
+		}
+		r.next[from] = max(r.next[from], r.match[from]+1)
+		r.advanceCommit()
+		if r.next[from] <= r.state.Last{
+			r.sendAppend(from)
+		}
+		return
+	}
+
+	// back off to the end of the follower's log, or one entry
+	r.next[from] = max(1, min(r.next[from]-1, msg.Match+1))
+	r.sendAppend(from)
+}
@@ -0,0 +1,466 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"blockchain-service/internal/blockchain"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var errRefused = errors.New("block refused")
+
+// testApp keeps the applied blocks of a member in memory and has documents
+// pending until target blocks are applied
+type testApp struct{
+	lock sync.Mutex
+	id peer.ID
+	target uint64
+	refuse bool
+	blocks []*blockchain.Block
+}
+
+func newTestApp(id peer.ID) *testApp{
+	genesis := &blockchain.Block{Hash: []byte("genesis")}
+	return &testApp{id: id, blocks: []*blockchain.Block{genesis}}
+}
+
+func testBlock(parent *blockchain.Block, signer peer.ID) *blockchain.Block{
+	block := &blockchain.Block{
+		PrevHash: parent.Hash,
+		Height: parent.Height + 1,
+		Timestamp: time.Now().UnixMilli(),
+		Signer: []byte(signer),
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%x/%d/%s/%d", block.PrevHash, block.Height, signer, block.Timestamp)))
+	block.Hash = hash[:]
+	return block
+}
+
+func (a *testApp) Pending() bool{
+	return a.height() < a.targetHeight()
+}
+
+func (a *testApp) ProposeBlock() (*blockchain.Block, error){
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return testBlock(a.blocks[len(a.blocks)-1], a.id), nil
+}
+
+func (a *testApp) Apply(block *blockchain.Block) error{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.refuse{
+		return errRefused
+	}
+	if last := a.blocks[len(a.blocks)-1]; !bytes.Equal(block.PrevHash, last.Hash) || block.Height != last.Height+1{
+		return fmt.Errorf("block at height %d does not extend height %d", block.Height, last.Height)
+	}
+	a.blocks = append(a.blocks, block)
+	return nil
+}
+
+func (a *testApp) LeaderChanged(leader peer.ID){}
+
+func (a *testApp) setTarget(target uint64){
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.target = target
+}
+
+func (a *testApp) targetHeight() uint64{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.target
+}
+
+func (a *testApp) height() uint64{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return uint64(len(a.blocks) - 1)
+}
+
+func (a *testApp) block(height uint64) *blockchain.Block{
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.blocks[height]
+}
+
+// testMember is a member of a testCluster with its database and app, which
+// outlive restarts like the chain of a node does
+type testMember struct{
+	app *testApp
+	storage *Storage
+	raft *Raft
+	cancel context.CancelFunc
+	done chan error
+}
+
+// testCluster is a set of members on a SimNetwork
+type testCluster struct{
+	net *SimNetwork
+	ids []peer.ID
+	members map[peer.ID]*testMember
+}
+
+func testConfig(members []peer.ID, id peer.ID) Config{
+	return Config{
+		Members: members,
+		ID: id,
+		HeartbeatInterval: 20 * time.Millisecond,
+		ElectionTimeout: 150 * time.Millisecond,
+	}
+}
+
+func testIDs(t *testing.T, count int) []peer.ID{
+	t.Helper()
+	ids := make([]peer.ID, count)
+	for i := range ids{
+		key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if ids[i], err = peer.IDFromPrivateKey(key); err != nil{
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+func testStorage(t *testing.T) *Storage{
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ db.Close() })
+	return NewStorage(db)
+}
+
+// newTestCluster creates count members, all started
+func newTestCluster(t *testing.T, count int) *testCluster{
+	t.Helper()
+	tc := &testCluster{net: NewSimNetwork(), ids: testIDs(t, count), members: map[peer.ID]*testMember{}}
+	for _, id := range tc.ids{
+		tc.members[id] = &testMember{app: newTestApp(id), storage: testStorage(t)}
+	}
+	// registered after the storages, so that it runs before they close
+	t.Cleanup(func(){
+		for _, id := range tc.ids{
+			tc.stop(id)
+		}
+	})
+	for _, id := range tc.ids{
+		tc.start(t, id)
+	}
+	return tc
+}
+
+// start runs a new Raft for id on its storage, as a restarted node does
+func (tc *testCluster) start(t *testing.T, id peer.ID){
+	t.Helper()
+	m := tc.members[id]
+	r, err := New(testConfig(tc.ids, id), m.app, tc.net.Transport(id), m.storage)
+	if err != nil{
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.raft, m.cancel, m.done = r, cancel, make(chan error, 1)
+	tc.net.Join(id, r)
+	go func(){
+		m.done <- r.Run(ctx)
+	}()
+}
+
+// stop stops the Raft of id and disconnects it
+func (tc *testCluster) stop(id peer.ID){
+	m := tc.members[id]
+	if m.cancel == nil{
+		return
+	}
+	tc.net.Leave(id)
+	m.cancel()
+	<-m.done
+	m.cancel = nil
+}
+
+func (tc *testCluster) setTarget(target uint64){
+	for _, m := range tc.members{
+		m.app.setTarget(target)
+	}
+}
+
+// waitLeader waits until the members in ids agree on a leader among them
+func (tc *testCluster) waitLeader(t *testing.T, ids ...peer.ID) peer.ID{
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline){
+		leader := tc.members[ids[0]].raft.Leader()
+		agreed := leader != ""
+		for _, id := range ids{
+			agreed = agreed && tc.members[id].raft.Leader() == leader
+		}
+		for _, id := range ids{
+			if agreed && id == leader{
+				return leader
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("members did not agree on a leader")
+	return ""
+}
+
+// waitApplied waits until every member in ids applied height, then checks
+// that they all applied the same blocks
+func (tc *testCluster) waitApplied(t *testing.T, height uint64, ids ...peer.ID){
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for _, id := range ids{
+		for tc.members[id].app.height() < height{
+			if time.Now().After(deadline){
+				t.Fatalf("member %s applied %d blocks, want %d", id, tc.members[id].app.height(), height)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for h := uint64(1); h <= height; h++{
+		first := tc.members[ids[0]].app.block(h)
+		for _, id := range ids[1:]{
+			if block := tc.members[id].app.block(h); !bytes.Equal(block.Hash, first.Hash){
+				t.Fatalf("members applied %x and %x at height %d", first.Hash, block.Hash, h)
+			}
+		}
+	}
+}
+
+func TestElection(t *testing.T){
+	tc := newTestCluster(t, 3)
+	leader := tc.waitLeader(t, tc.ids...)
+
+	leading, err := tc.members[leader].storage.State()
+	if err != nil{
+		t.Fatal(err)
+	}
+	term := leading.Term
+	for _, id := range tc.ids{
+		state, err := tc.members[id].storage.State()
+		if err != nil{
+			t.Fatal(err)
+		}
+		if state.Term < term{
+			t.Fatalf("member %s stored term %d, leader is in term %d", id, state.Term, term)
+		}
+	}
+}
+
+func TestReplication(t *testing.T){
+	tc := newTestCluster(t, 3)
+	tc.waitLeader(t, tc.ids...)
+	tc.setTarget(5)
+	tc.waitApplied(t, 5, tc.ids...)
+
+	for _, id := range tc.ids{
+		state, err := tc.members[id].storage.State()
+		if err != nil{
+			t.Fatal(err)
+		}
+		entry, err := tc.members[id].storage.Entry(state.Applied)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if state.Applied > state.Last || entry.Index != state.Applied{
+			t.Fatalf("member %s applied entry %d of %d", id, state.Applied, state.Last)
+		}
+	}
+}
+
+func TestLeaderFailover(t *testing.T){
+	tc := newTestCluster(t, 3)
+	leader := tc.waitLeader(t, tc.ids...)
+	tc.setTarget(2)
+	tc.waitApplied(t, 2, tc.ids...)
+
+	tc.stop(leader)
+	others := []peer.ID{}
+	for _, id := range tc.ids{
+		if id != leader{
+			others = append(others, id)
+		}
+	}
+	if next := tc.waitLeader(t, others...); next == leader{
+		t.Fatal("the stopped leader is still leading")
+	}
+	tc.setTarget(4)
+	tc.waitApplied(t, 4, others...)
+
+	// the old leader catches up as a follower
+	tc.start(t, leader)
+	tc.waitApplied(t, 4, tc.ids...)
+}
+
+// recordTransport keeps the messages sent by a member that is driven by the
+// test instead of Run
+type recordTransport struct{
+	sent []*Message
+}
+
+func (t *recordTransport) Send(to peer.ID, msg *Message){
+	t.sent = append(t.sent, msg)
+}
+
+func TestConflictingEntriesTruncated(t *testing.T){
+	ids := testIDs(t, 3)
+	app := newTestApp(ids[0])
+	storage := testStorage(t)
+	transport := &recordTransport{}
+	r, err := New(testConfig(ids, ids[0]), app, transport, storage)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	genesis := app.block(0)
+	first := testBlock(genesis, ids[1])
+	stale := testBlock(first, ids[1])
+	// ids[1] leads term 1 and replicates three entries, committing the first
+	r.handle(ids[1], &Message{Type: MsgAppend, Term: 1, Commit: 1, Entries: []Entry{
+		{Index: 1, Term: 1, Block: first},
+		{Index: 2, Term: 1, Block: stale},
+		{Index: 3, Term: 1, Block: testBlock(stale, ids[1])},
+	}})
+
+	// ids[2] leads term 2 without the last two and overwrites them
+	replacement := testBlock(first, ids[2])
+	r.handle(ids[2], &Message{Type: MsgAppend, Term: 2, PrevIndex: 1, PrevTerm: 1, Commit: 2, Entries: []Entry{
+		{Index: 2, Term: 2, Block: replacement},
+	}})
+
+	reply := transport.sent[len(transport.sent)-1]
+	if !reply.Success || reply.Match != 2{
+		t.Fatalf("reply to the term 2 leader: success %v, match %d", reply.Success, reply.Match)
+	}
+	state, err := storage.State()
+	if err != nil{
+		t.Fatal(err)
+	}
+	if state.Last != 2 || state.Applied != 2{
+		t.Fatalf("log ends at %d with %d applied, want 2 and 2", state.Last, state.Applied)
+	}
+	entry, err := storage.Entry(2)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if entry.Term != 2 || !bytes.Equal(entry.Block.Hash, replacement.Hash){
+		t.Fatalf("entry 2 is in term %d, want the term 2 entry", entry.Term)
+	}
+	if !bytes.Equal(app.block(2).Hash, replacement.Hash){
+		t.Fatal("applied the overwritten block")
+	}
+
+	// a committed entry is never overwritten
+	sent := len(transport.sent)
+	r.handle(ids[1], &Message{Type: MsgAppend, Term: 3, Entries: []Entry{
+		{Index: 1, Term: 3, Block: testBlock(genesis, ids[1])},
+	}})
+	if entry, err := storage.Entry(1); err != nil || entry.Term != 1{
+		t.Fatalf("committed entry 1 replaced: %v", err)
+	}
+	if len(transport.sent) != sent{
+		t.Fatal("acknowledged an append conflicting with a committed entry")
+	}
+}
+
+func TestRestartFromStorage(t *testing.T){
+	tc := newTestCluster(t, 3)
+	tc.waitLeader(t, tc.ids...)
+	tc.setTarget(2)
+	tc.waitApplied(t, 2, tc.ids...)
+
+	for _, id := range tc.ids{
+		tc.stop(id)
+	}
+	terms := map[peer.ID]uint64{}
+	for _, id := range tc.ids{
+		m := tc.members[id]
+		r, err := New(testConfig(tc.ids, id), m.app, tc.net.Transport(id), m.storage)
+		if err != nil{
+			t.Fatal(err)
+		}
+		stored, err := m.storage.State()
+		if err != nil{
+			t.Fatal(err)
+		}
+		// the entries of the two blocks and at least one leader entry
+		if r.state != stored || r.state.Term == 0 || r.state.Applied < 3 || r.commit != r.state.Applied{
+			t.Fatalf("member %s restarted in term %d with %d entries applied", id, r.state.Term, r.state.Applied)
+		}
+		terms[id] = r.state.Term
+	}
+	for _, id := range tc.ids{
+		tc.start(t, id)
+	}
+
+	leader := tc.waitLeader(t, tc.ids...)
+	tc.setTarget(4)
+	tc.waitApplied(t, 4, tc.ids...)
+	state, err := tc.members[leader].storage.State()
+	if err != nil{
+		t.Fatal(err)
+	}
+	if state.Term <= terms[leader]{
+		t.Fatalf("leader restarted in term %d and leads term %d", terms[leader], state.Term)
+	}
+	for _, id := range tc.ids{
+		select{
+		case err := <-tc.members[id].done:
+			t.Fatalf("member %s stopped: %v", id, err)
+		default:
+		}
+	}
+}
+
+func TestApplyFailureStopsMember(t *testing.T){
+	tc := newTestCluster(t, 3)
+	leader := tc.waitLeader(t, tc.ids...)
+	failing := tc.ids[0]
+	if failing == leader{
+		failing = tc.ids[1]
+	}
+	m := tc.members[failing]
+	m.app.lock.Lock()
+	m.app.refuse = true
+	m.app.lock.Unlock()
+
+	tc.setTarget(1)
+	select{
+	case err := <-m.done:
+		if !errors.Is(err, errRefused){
+			t.Fatalf("member stopped with %v", err)
+		}
+		tc.net.Leave(failing)
+		m.done <- err
+	case <-time.After(10 * time.Second):
+		t.Fatal("member kept running after failing to apply a block")
+	}
+	if m.raft.Leader() != ""{
+		t.Fatal("stopped member still reports a leader")
+	}
+
+	others := []peer.ID{}
+	for _, id := range tc.ids{
+		if id != failing{
+			others = append(others, id)
+		}
+	}
+	tc.waitApplied(t, 1, others...)
+}
@@ -0,0 +1,61 @@
+package raft
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SimNetwork connects Raft members in the same process, to simulate a
+// cluster. Drop, when set, is asked about every delivery so that lost
+// messages and partitions can be reproduced.
+type SimNetwork struct{
+	lock sync.Mutex
+	members map[peer.ID]*Raft
+
+	Drop func(from peer.ID, to peer.ID, msg *Message) bool
+}
+
+func NewSimNetwork() *SimNetwork{
+	return &SimNetwork{
+		members: make(map[peer.ID]*Raft),
+	}
+}
+
+// Join registers the member receiving the messages sent to id
+func (n *SimNetwork) Join(id peer.ID, r *Raft){
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.members[id] = r
+}
+
+// Leave disconnects id, as if the member had stopped
+func (n *SimNetwork) Leave(id peer.ID){
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	delete(n.members, id)
+}
+
+// Transport returns the transport id sends through
+func (n *SimNetwork) Transport(id peer.ID) Transport{
+	return &simTransport{network: n, id: id}
+}
+
+type simTransport struct{
+	network *SimNetwork
+	id peer.ID
+}
+
+func (t *simTransport) Send(to peer.ID, msg *Message){
+	n := t.network
+	n.lock.Lock()
+	r, ok := n.members[to]
+	_, joined := n.members[t.id]
+	drop := n.Drop
+	n.lock.Unlock()
+
+	if !ok || !joined || (drop != nil && drop(t.id, to, msg)){
+		return
+	}
+	r.Receive(t.id, msg)
+}
@@ -0,0 +1,140 @@
+package raft
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const(
+	stateKey = "raft:state"
+	entryPrefix = "raft:e:"
+)
+
+// State is the raft state that must survive a restart
+type State struct{
+	Term uint64 `json:"term"`
+	Vote string `json:"vote,omitempty"`
+	// Applied is the index of the last entry applied to the chain
+	Applied uint64 `json:"applied"`
+	// Last is the index of the last entry of the log
+	Last uint64 `json:"last"`
+}
+
+// Storage keeps the raft state and log in the chain database, next to the
+// blocks they produced. Index 0 is the genesis block, implicitly in term 0.
+type Storage struct{
+	db *badger.DB
+}
+
+func NewStorage(db *badger.DB) *Storage{
+	return &Storage{db: db}
+}
+
+func entryKey(index uint64) []byte{
+	key := make([]byte, len(entryPrefix)+8)
+	copy(key, entryPrefix)
+	binary.BigEndian.PutUint64(key[len(entryPrefix):], index)
+	return key
+}
+
+// State returns the stored state, or the zero state of a new log
+func (s *Storage) State() (State, error){
+	var state State
+	err := s.db.View(func(txn *badger.Txn) error{
+		item, err := txn.Get([]byte(stateKey))
+		if errors.Is(err, badger.ErrKeyNotFound){
+			return nil
+		}
+		if err != nil{
+			return err
+		}
+		return item.Value(func(val []byte) error{
+			return json.Unmarshal(val, &state)
+		})
+	})
+	return state, err
+}
+
+func (s *Storage) SetState(state State) error{
+	encoded, err := json.Marshal(state)
+	if err != nil{
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error{
+		return txn.Set([]byte(stateKey), encoded)
+	})
+}
+
+// Entry returns the entry at index
+func (s *Storage) Entry(index uint64) (*Entry, error){
+	if index == 0{
+		return &Entry{}, nil
+	}
+
+	var entry *Entry
+	err := s.db.View(func(txn *badger.Txn) error{
+		item, err := txn.Get(entryKey(index))
+		if errors.Is(err, badger.ErrKeyNotFound){
+			return fmt.Errorf("raft entry %d not found", index)
+		}
+		if err != nil{
+			return err
+		}
+		return item.Value(func(val []byte) error{
+			var err error
+			entry, err = decodeStoredEntry(val)
+			return err
+		})
+	})
+	if err != nil{
+		return nil, err
+	}
+	return entry, nil
+}
+
+// decodeStoredEntry decodes a stored entry. Entries written before the
+// canonical encoding are JSON objects, which no canonical entry starts with.
+func decodeStoredEntry(val []byte) (*Entry, error){
+	if len(val) > 0 && val[0] == '{'{
+		var entry Entry
+		if err := json.Unmarshal(val, &entry); err != nil{
+			return nil, err
+		}
+		return &entry, nil
+	}
+	return DeserializeEntry(val)
+}
+
+// Entries returns up to limit entries from index on, stopping at last
+func (s *Storage) Entries(index uint64, last uint64, limit int) ([]Entry, error){
+	entries := []Entry{}
+	for ; index <= last && len(entries) < limit; index++{
+		entry, err := s.Entry(index)
+		if err != nil{
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// Append writes entries, replacing any stored at the same indexes, and the
+// state that goes with them in the same transaction
+func (s *Storage) Append(entries []Entry, state State) error{
+	encodedState, err := json.Marshal(state)
+	if err != nil{
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error{
+		for i := range entries{
+			if err := txn.Set(entryKey(entries[i].Index), entries[i].Serialize()); err != nil{
+				return err
+			}
+		}
+		return txn.Set([]byte(stateKey), encodedState)
+	})
+}
@@ -51,6 +51,15 @@ func LoadPeers(filename string) ([]PeerInfo, error) {
 	return peers, nil
 }
 
+// PeerIDs returns the IDs of the given peers, in order
+func PeerIDs(peers []PeerInfo) []string{
+	ids := make([]string, 0, len(peers))
+	for _, p := range peers{
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
 // UnmarshalPrivateKey decodes a base64-encoded private key.
 func UnmarshalPrivateKey(encoded string) (crypto.PrivKey, error) {
 	privBytes, err := base64.StdEncoding.DecodeString(encoded)
@@ -0,0 +1,158 @@
+// Package verify checks blocks and inclusion receipts exported by the API of
+// a node, completely offline. It needs neither a node nor its database: it
+// reads the JSON returned by the API and recomputes hashes over the canonical
+// encoding of proto/blockchain.proto, which it implements on its own so that
+// it can serve as a reference for verifiers written in other languages.
+package verify
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var(
+	// ErrInvalidBlock is returned for a block whose fields cannot be decoded,
+	// or whose hash or merkle root does not match its contents
+	ErrInvalidBlock = errors.New("invalid block")
+	// ErrInvalidSeal is returned when the proof-of-work, the signature or the
+	// commit of a block does not hold
+	ErrInvalidSeal = errors.New("invalid block seal")
+	// ErrBrokenChain is returned when consecutive blocks are not linked
+	ErrBrokenChain = errors.New("blocks are not linked")
+	// ErrInvalidReceipt is returned for a receipt that is not signed by the
+	// node it names
+	ErrInvalidReceipt = errors.New("invalid receipt")
+	// ErrDocumentNotFound is returned when no block anchors the document
+	ErrDocumentNotFound = errors.New("document not found in the blocks")
+	// ErrInvalidSignature is returned when a document is not signed by the
+	// key it carries
+	ErrInvalidSignature = errors.New("invalid document signature")
+	// ErrLegacyBlock is returned for documents anchored in blocks of schema
+	// version 0, whose merkle leaves were computed over Go gob encodings
+	ErrLegacyBlock = errors.New("documents in blocks of schema version 0 cannot be checked offline")
+)
+
+// Block is a block as returned by GET /blocks/:hash, GET /blocks/height/:n,
+// GET /blocks/latest and inside receipts
+type Block struct{
+	Version uint32 `json:"version"`
+	Hash string `json:"hash"`
+	PrevHash string `json:"prevHash"`
+	Nonce int64 `json:"nonce"`
+	Difficulty uint32 `json:"difficulty"`
+	Height uint64 `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+	MerkleRoot string `json:"merkleRoot"`
+	Signer string `json:"signer,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Commit []CommitSig `json:"commit,omitempty"`
+	Data []Document `json:"data"`
+	Notaries []NotaryTx `json:"notaries,omitempty"`
+	Statuses []StatusTx `json:"statuses,omitempty"`
+}
+
+// Document is an entry of a block anchoring a document
+type Document struct{
+	Hash string `json:"hash"`
+	DocumentID string `json:"momId"`
+	NotaryID string `json:"notaryId"`
+	UserID string `json:"userId"`
+	CNPJ string `json:"cnpj"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type NotaryTx struct{
+	Op string `json:"op"`
+	NotaryID string `json:"notaryId"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Timestamp int64 `json:"timestamp"`
+	Admin string `json:"admin"`
+	Signature string `json:"signature"`
+}
+
+type StatusTx struct{
+	Op string `json:"op"`
+	Target string `json:"target"`
+	Replacement string `json:"replacement,omitempty"`
+	Reason string `json:"reason"`
+	NotaryID string `json:"notaryId"`
+	Timestamp int64 `json:"timestamp"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+type CommitSig struct{
+	Validator string `json:"validator"`
+	Round uint32 `json:"round"`
+	Signature string `json:"signature"`
+}
+
+// ParseBlocks reads a single block, an array of blocks, or a page of blocks
+// as returned by GET /list
+func ParseBlocks(data []byte) ([]*Block, error){
+	var probe any
+	if err := json.Unmarshal(data, &probe); err != nil{
+		return nil, err
+	}
+
+	switch probe := probe.(type){
+	case []any:
+		blocks := []*Block{}
+		err := json.Unmarshal(data, &blocks)
+		return blocks, err
+	case map[string]any:
+		if _, ok := probe["blocks"]; ok{
+			var page struct{
+				Blocks []*Block `json:"blocks"`
+			}
+			err := json.Unmarshal(data, &page)
+			return page.Blocks, err
+		}
+		var block Block
+		if err := json.Unmarshal(data, &block); err != nil{
+			return nil, err
+		}
+		return []*Block{&block}, nil
+	}
+	return nil, fmt.Errorf("expected a block, an array of blocks or a page of blocks")
+}
+
+// decoder collects the first error met while decoding the text encoded
+// fields of a block
+type decoder struct{
+	err error
+}
+
+func (d *decoder) hex(field string, value string) []byte{
+	b, err := hex.DecodeString(value)
+	if err != nil && d.err == nil{
+		d.err = fmt.Errorf("%w: %s: %v", ErrInvalidBlock, field, err)
+	}
+	return b
+}
+
+func (d *decoder) base64(field string, value string) []byte{
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil && d.err == nil{
+		d.err = fmt.Errorf("%w: %s: %v", ErrInvalidBlock, field, err)
+	}
+	return b
+}
+
+// peerID decodes a libp2p peer ID into the bytes the block hash covers
+func (d *decoder) peerID(field string, value string) []byte{
+	if value == ""{
+		return nil
+	}
+	id, err := peer.Decode(value)
+	if err != nil && d.err == nil{
+		d.err = fmt.Errorf("%w: %s: %v", ErrInvalidBlock, field, err)
+	}
+	return []byte(id)
+}
@@ -0,0 +1,211 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Field numbers of the messages of proto/blockchain.proto
+const(
+	blockVersion = 1
+	blockPrevHash = 3
+	blockNonce = 4
+	blockDifficulty = 5
+	blockHeight = 6
+	blockTimestamp = 7
+	blockMerkleRoot = 8
+	blockSigner = 9
+)
+
+const(
+	documentHash = iota + 1
+	documentID
+	documentNotaryID
+	documentUserID
+	documentCNPJ
+	documentPublicKey
+	documentSignature
+)
+
+const(
+	notaryTxOp = iota + 1
+	notaryTxNotaryID
+	notaryTxPublicKey
+	notaryTxTimestamp
+	notaryTxAdmin
+	notaryTxSignature
+)
+
+const(
+	statusTxOp = iota + 1
+	statusTxTarget
+	statusTxReplacement
+	statusTxReason
+	statusTxNotaryID
+	statusTxTimestamp
+	statusTxPublicKey
+	statusTxSignature
+)
+
+// Merkle tree prefixes: leaves of documents, inner nodes, leaves of registry
+// transactions and leaves of status transactions
+const(
+	leafDocument = 0x00
+	leafNode = 0x01
+	leafNotary = 0x02
+	leafStatus = 0x03
+)
+
+// Protobuf wire types
+const(
+	wireVarint = 0
+	wireBytes = 2
+)
+
+// encoder writes the canonical encoding: fields in ascending order and
+// fields holding their default value left out
+type encoder struct{
+	buf []byte
+}
+
+func (e *encoder) tag(num int, wireType int){
+	e.buf = binary.AppendUvarint(e.buf, uint64(num)<<3|uint64(wireType))
+}
+
+func (e *encoder) uint(num int, v uint64){
+	if v == 0{
+		return
+	}
+	e.tag(num, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+// int writes a protobuf int64, negative values being sign extended to 64 bits
+func (e *encoder) int(num int, v int64){
+	e.uint(num, uint64(v))
+}
+
+func (e *encoder) bytes(num int, v []byte){
+	if len(v) == 0{
+		return
+	}
+	e.tag(num, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) text(num int, v string){
+	e.bytes(num, []byte(v))
+}
+
+// headerBytes is the encoding of the block without its hash, signature,
+// commit and entries, which the block hash is computed over
+func headerBytes(b *Block, d *decoder) []byte{
+	var e encoder
+	e.uint(blockVersion, uint64(b.Version))
+	e.bytes(blockPrevHash, d.hex("prevHash", b.PrevHash))
+	e.int(blockNonce, b.Nonce)
+	e.uint(blockDifficulty, uint64(b.Difficulty))
+	e.uint(blockHeight, b.Height)
+	e.int(blockTimestamp, b.Timestamp)
+	e.bytes(blockMerkleRoot, d.hex("merkleRoot", b.MerkleRoot))
+	e.bytes(blockSigner, d.peerID("signer", b.Signer))
+	return e.buf
+}
+
+// legacyHeaderBytes is what the hash of a schema version 0 block covers: the
+// previous hash and merkle root followed by the height, timestamp, nonce
+// (mined blocks only) and difficulty as 8 byte big endian integers, and the
+// signer (signed blocks only)
+func legacyHeaderBytes(b *Block, mined bool, d *decoder) []byte{
+	var buf bytes.Buffer
+	buf.Write(d.hex("prevHash", b.PrevHash))
+	buf.Write(d.hex("merkleRoot", b.MerkleRoot))
+	binary.Write(&buf, binary.BigEndian, b.Height)
+	binary.Write(&buf, binary.BigEndian, b.Timestamp)
+	if mined{
+		binary.Write(&buf, binary.BigEndian, b.Nonce)
+	}
+	binary.Write(&buf, binary.BigEndian, uint64(b.Difficulty))
+	if !mined{
+		buf.Write(d.peerID("signer", b.Signer))
+	}
+	return buf.Bytes()
+}
+
+func (doc *Document) encode(d *decoder) []byte{
+	var e encoder
+	e.bytes(documentHash, d.documentHash("data.hash", doc.Hash))
+	e.text(documentID, doc.DocumentID)
+	e.text(documentNotaryID, doc.NotaryID)
+	e.text(documentUserID, doc.UserID)
+	e.text(documentCNPJ, doc.CNPJ)
+	e.bytes(documentPublicKey, d.base64("data.publicKey", doc.PublicKey))
+	e.bytes(documentSignature, d.base64("data.signature", doc.Signature))
+	return e.buf
+}
+
+func (tx *NotaryTx) encode(d *decoder) []byte{
+	var e encoder
+	e.text(notaryTxOp, tx.Op)
+	e.text(notaryTxNotaryID, tx.NotaryID)
+	e.bytes(notaryTxPublicKey, d.base64("notaries.publicKey", tx.PublicKey))
+	e.int(notaryTxTimestamp, tx.Timestamp)
+	e.bytes(notaryTxAdmin, d.base64("notaries.admin", tx.Admin))
+	e.bytes(notaryTxSignature, d.base64("notaries.signature", tx.Signature))
+	return e.buf
+}
+
+func (tx *StatusTx) encode(d *decoder) []byte{
+	var e encoder
+	e.text(statusTxOp, tx.Op)
+	e.bytes(statusTxTarget, d.documentHash("statuses.target", tx.Target))
+	e.bytes(statusTxReplacement, d.documentHash("statuses.replacement", tx.Replacement))
+	e.text(statusTxReason, tx.Reason)
+	e.text(statusTxNotaryID, tx.NotaryID)
+	e.int(statusTxTimestamp, tx.Timestamp)
+	e.bytes(statusTxPublicKey, d.base64("statuses.publicKey", tx.PublicKey))
+	e.bytes(statusTxSignature, d.base64("statuses.signature", tx.Signature))
+	return e.buf
+}
+
+func leaf(prefix byte, encoded []byte) []byte{
+	hash := sha256.Sum256(append([]byte{prefix}, encoded...))
+	return hash[:]
+}
+
+// merkleRoot computes the root over the documents, then the registry
+// transactions and then the status transactions of a block. A node without
+// a sibling is promoted unchanged; an empty block has an empty root.
+func merkleRoot(b *Block, d *decoder) []byte{
+	level := [][]byte{}
+	for i := range b.Data{
+		level = append(level, leaf(leafDocument, b.Data[i].encode(d)))
+	}
+	for i := range b.Notaries{
+		level = append(level, leaf(leafNotary, b.Notaries[i].encode(d)))
+	}
+	for i := range b.Statuses{
+		level = append(level, leaf(leafStatus, b.Statuses[i].encode(d)))
+	}
+	if len(level) == 0{
+		return []byte{}
+	}
+
+	for len(level) > 1{
+		next := [][]byte{}
+		for i := 0; i < len(level); i += 2{
+			if i+1 == len(level){
+				next = append(next, level[i])
+				continue
+			}
+			node := append([]byte{leafNode}, level[i]...)
+			node = append(node, level[i+1]...)
+			hash := sha256.Sum256(node)
+			next = append(next, hash[:])
+		}
+		level = next
+	}
+	return level[0]
+}
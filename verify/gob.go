@@ -0,0 +1,111 @@
+package verify
+
+import (
+	"encoding/binary"
+)
+
+// Blocks of the first release have a single entry and no merkle root. Their
+// proof-of-work covers the gob encoding of the entry, written here as nodes
+// wrote it: BlockData under gob type id 64, with its fields of []byte and
+// string types, ids 5 and 6.
+const(
+	gobBytesID = 5
+	gobStringID = 6
+	gobDataID = 64
+)
+
+var firstReleaseFields = []struct{
+	name string
+	typeID int64
+}{
+	{"Hash", gobBytesID},
+	{"DocumentID", gobStringID},
+	{"NotaryID", gobStringID},
+	{"UserID", gobStringID},
+	{"CNPJ", gobStringID},
+}
+
+func gobUint(buf []byte, x uint64) []byte{
+	if x < 0x80{
+		return append(buf, byte(x))
+	}
+	var be [8]byte
+	binary.BigEndian.PutUint64(be[:], x)
+	n := 8
+	for be[8-n] == 0{
+		n--
+	}
+	buf = append(buf, byte(-n))
+	return append(buf, be[8-n:]...)
+}
+
+func gobInt(buf []byte, x int64) []byte{
+	if x < 0{
+		return gobUint(buf, uint64(^x)<<1|1)
+	}
+	return gobUint(buf, uint64(x)<<1)
+}
+
+func gobMessage(buf []byte, content []byte) []byte{
+	buf = gobUint(buf, uint64(len(content)))
+	return append(buf, content...)
+}
+
+// firstReleaseDataBytes is the gob stream of an entry of the first release:
+// the definition of its type followed by its value
+func firstReleaseDataBytes(doc *Document, d *decoder) []byte{
+	def := gobInt(nil, -gobDataID)
+	def = append(def, 3, 1, 1)
+	def = gobUint(def, uint64(len("BlockData")))
+	def = append(def, "BlockData"...)
+	def = append(def, 1)
+	def = gobInt(def, gobDataID)
+	def = append(def, 0, 1)
+	def = gobUint(def, uint64(len(firstReleaseFields)))
+	for _, field := range firstReleaseFields{
+		def = append(def, 1)
+		def = gobUint(def, uint64(len(field.name)))
+		def = append(def, field.name...)
+		def = append(def, 1)
+		def = gobInt(def, field.typeID)
+		def = append(def, 0)
+	}
+	def = append(def, 0, 0)
+
+	value := gobInt(nil, gobDataID)
+	last := -1
+	for i, field := range [][]byte{
+		d.hex("data.hash", doc.Hash),
+		[]byte(doc.DocumentID),
+		[]byte(doc.NotaryID),
+		[]byte(doc.UserID),
+		[]byte(doc.CNPJ),
+	}{
+		if len(field) == 0{
+			continue
+		}
+		value = gobUint(value, uint64(i-last))
+		value = gobUint(value, uint64(len(field)))
+		value = append(value, field...)
+		last = i
+	}
+	value = append(value, 0)
+
+	return gobMessage(gobMessage(nil, def), value)
+}
+
+// isFirstRelease reports whether a block was mined by the first release
+func (b *Block) isFirstRelease() bool{
+	return b.Version == 0 && b.MerkleRoot == "" && len(b.Data) == 1 &&
+		len(b.Notaries) == 0 && len(b.Statuses) == 0 && b.Signer == ""
+}
+
+// firstReleaseHeaderBytes is what the hash of a block of the first release
+// covers: the previous hash, the entry, and the nonce and difficulty as 8
+// byte big endian integers
+func firstReleaseHeaderBytes(b *Block, d *decoder) []byte{
+	buf := append([]byte{}, d.hex("prevHash", b.PrevHash)...)
+	buf = append(buf, firstReleaseDataBytes(&b.Data[0], d)...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(b.Nonce))
+	return binary.BigEndian.AppendUint64(buf, uint64(b.Difficulty))
+}
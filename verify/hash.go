@@ -0,0 +1,107 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Hash algorithms of documents. The API writes SHA-256 hashes as their hex
+// encoded digest and the other ones prefixed with the algorithm and a colon.
+// On the chain SHA-256 hashes are the raw digest and the other ones
+// multihashes: the varint multihash code, the varint digest length and the
+// digest.
+const(
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashSHA3_256 = "sha3-256"
+	HashBLAKE3 = "blake3"
+)
+
+type hashAlgorithm struct{
+	code uint64
+	size int
+	new func() hash.Hash
+}
+
+var hashAlgorithms = map[string]hashAlgorithm{
+	HashSHA256: {0x12, 32, sha256.New},
+	HashSHA512: {0x13, 64, sha512.New},
+	HashSHA3_256: {0x16, 32, func() hash.Hash{ return sha3.New256() }},
+	HashBLAKE3: {0x1e, 32, func() hash.Hash{ return blake3.New(32, nil) }},
+}
+
+// storedHash returns the form of a digest that blocks hold
+func storedHash(algorithm string, digest []byte) ([]byte, error){
+	alg, ok := hashAlgorithms[algorithm]
+	if !ok{
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+	if len(digest) != alg.size{
+		return nil, fmt.Errorf("%s digests are %d bytes, got %d", algorithm, alg.size, len(digest))
+	}
+	if algorithm == HashSHA256{
+		return digest, nil
+	}
+	stored := binary.AppendUvarint(nil, alg.code)
+	stored = binary.AppendUvarint(stored, uint64(len(digest)))
+	return append(stored, digest...), nil
+}
+
+// parseHash decodes a document hash as written by the API into the form
+// blocks hold
+func parseHash(encoded string) ([]byte, error){
+	algorithm, digestHex, found := strings.Cut(encoded, ":")
+	if !found{
+		algorithm, digestHex = HashSHA256, encoded
+	}
+	digest, err := hex.DecodeString(digestHex)
+	if err != nil{
+		return nil, err
+	}
+	return storedHash(strings.ToLower(algorithm), digest)
+}
+
+// documentHash decodes a document hash, which may be missing
+func (d *decoder) documentHash(field string, value string) []byte{
+	if value == ""{
+		return nil
+	}
+	stored, err := parseHash(value)
+	if err != nil && d.err == nil{
+		d.err = fmt.Errorf("%w: %s: %v", ErrInvalidBlock, field, err)
+	}
+	return stored
+}
+
+// HashFile returns the hash of a file with algorithm, in the form blocks
+// hold
+func HashFile(path string, algorithm string) ([]byte, error){
+	file, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer file.Close()
+	return HashReader(file, algorithm)
+}
+
+func HashReader(r io.Reader, algorithm string) ([]byte, error){
+	alg, ok := hashAlgorithms[algorithm]
+	if !ok{
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+	hash := alg.new()
+	if _, err := io.Copy(hash, r); err != nil{
+		return nil, err
+	}
+	return storedHash(algorithm, hash.Sum(nil))
+}
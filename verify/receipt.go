@@ -0,0 +1,104 @@
+package verify
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/crypto/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ReceiptVersion is the version of the receipt payload format understood
+const ReceiptVersion = 1
+
+// Receipt is an inclusion receipt signed by a node, as returned by
+// GET /verify?receipt=true
+type Receipt struct{
+	Payload string `json:"payload"`
+	Signature string `json:"signature"`
+	PublicKey string `json:"publicKey"`
+	KeyType string `json:"keyType"`
+	NodeID string `json:"nodeId"`
+}
+
+// ReceiptPayload is the signed content of a receipt
+type ReceiptPayload struct{
+	Version int `json:"version"`
+	NodeID string `json:"nodeId"`
+	IssuedAt int64 `json:"issuedAt"`
+	Confirmations uint64 `json:"confirmations"`
+	Block Block `json:"block"`
+}
+
+// ParseReceipt reads a receipt, alone or inside the response of GET /verify
+func ParseReceipt(data []byte) (*Receipt, error){
+	var response struct{
+		Receipt *Receipt `json:"receipt"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil{
+		return nil, err
+	}
+	if response.Receipt != nil{
+		return response.Receipt, nil
+	}
+
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil{
+		return nil, err
+	}
+	if receipt.Payload == ""{
+		return nil, fmt.Errorf("%w: no payload", ErrInvalidReceipt)
+	}
+	return &receipt, nil
+}
+
+// Open checks that the receipt is signed by the node it names and returns
+// its payload
+func (r *Receipt) Open() (*ReceiptPayload, error){
+	payload, err := base64.StdEncoding.DecodeString(r.Payload)
+	if err != nil{
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidReceipt, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil{
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidReceipt, err)
+	}
+	rawKey, err := base64.StdEncoding.DecodeString(r.PublicKey)
+	if err != nil{
+		return nil, fmt.Errorf("%w: public key: %v", ErrInvalidReceipt, err)
+	}
+
+	keyType, ok := pb.KeyType_value[r.KeyType]
+	unmarshal := crypto.PubKeyUnmarshallers[pb.KeyType(keyType)]
+	if !ok || unmarshal == nil{
+		return nil, fmt.Errorf("%w: unsupported key type %q", ErrInvalidReceipt, r.KeyType)
+	}
+	pubKey, err := unmarshal(rawKey)
+	if err != nil{
+		return nil, fmt.Errorf("%w: public key: %v", ErrInvalidReceipt, err)
+	}
+	id, err := peer.IDFromPublicKey(pubKey)
+	if err != nil{
+		return nil, fmt.Errorf("%w: public key: %v", ErrInvalidReceipt, err)
+	}
+	if id.String() != r.NodeID{
+		return nil, fmt.Errorf("%w: public key is not the key of node %s", ErrInvalidReceipt, r.NodeID)
+	}
+	if ok, err := pubKey.Verify(payload, signature); err != nil || !ok{
+		return nil, fmt.Errorf("%w: bad signature from %s", ErrInvalidReceipt, r.NodeID)
+	}
+
+	var content ReceiptPayload
+	if err := json.Unmarshal(payload, &content); err != nil{
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidReceipt, err)
+	}
+	if content.Version != ReceiptVersion{
+		return nil, fmt.Errorf("%w: payload version %d, expected %d", ErrInvalidReceipt, content.Version, ReceiptVersion)
+	}
+	if content.NodeID != r.NodeID{
+		return nil, fmt.Errorf("%w: payload issued by %s, signed by %s", ErrInvalidReceipt, content.NodeID, r.NodeID)
+	}
+	return &content, nil
+}
@@ -0,0 +1,366 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Bounds of the proof-of-work difficulty, the number of leading zero bits of
+// the block hash
+const(
+	MinDifficulty = 1
+	MaxDifficulty = 255
+)
+
+// Domains separating the signatures of votes and documents from any other
+// use of the keys
+var(
+	voteDomain = []byte("bc/bft/vote")
+	documentDomain = []byte("bc/document/v1")
+)
+
+const votePrecommit = 2
+
+// Options are what the verifier knows about the network beyond the blocks
+type Options struct{
+	// Authorities are the peer IDs of the authorities, raft members or BFT
+	// validators of the network. Without them signed blocks are only checked
+	// to be signed by the key of their signer.
+	Authorities []string
+	// MinDifficulty is the least proof-of-work difficulty accepted
+	MinDifficulty uint32
+}
+
+// Warnings are checks that could not be made offline, reported to the user
+// rather than failing the verification
+type Warnings []string
+
+func (w *Warnings) add(format string, args ...any){
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+// VerifyBlock checks that the hash of a block matches its contents, that it
+// is sealed by a proof-of-work, a signature or a BFT commit, and that its
+// merkle root matches its entries
+func VerifyBlock(b *Block, opts Options) (Warnings, error){
+	warnings := Warnings{}
+	d := &decoder{}
+	hash := d.hex("hash", b.Hash)
+	merkle := d.hex("merkleRoot", b.MerkleRoot)
+	if d.err != nil{
+		return warnings, d.err
+	}
+
+	var signed []byte
+	var mined []byte
+	if b.Version == 0{
+		signed = sha256Sum(legacyHeaderBytes(b, false, d))
+		mined = sha256Sum(legacyHeaderBytes(b, true, d))
+		if b.isFirstRelease(){
+			mined = sha256Sum(firstReleaseHeaderBytes(b, d))
+		}
+	} else {
+		signed = sha256Sum(headerBytes(b, d))
+		mined = signed
+	}
+	if d.err != nil{
+		return warnings, d.err
+	}
+
+	genesis := b.Height == 0 && b.PrevHash == ""
+	switch {
+	case b.Signer == "" && bytes.Equal(hash, mined):
+		if err := verifyWork(b, hash, opts); err != nil{
+			return warnings, err
+		}
+	case b.Signer == "" && genesis && bytes.Equal(hash, signed):
+		// the genesis block of a signed network is neither mined nor signed
+		if b.Signature != "" || len(b.Commit) != 0{
+			return warnings, fmt.Errorf("%w: genesis block is signed", ErrInvalidSeal)
+		}
+		warnings.add("genesis block %s is not sealed: compare its hash with the network's", b.Hash)
+	case b.Signer != "" && bytes.Equal(hash, signed):
+		if err := verifySignature(b, hash, opts, &warnings); err != nil{
+			return warnings, err
+		}
+	default:
+		return warnings, fmt.Errorf("%w: hash does not match the block contents", ErrInvalidBlock)
+	}
+
+	if b.isFirstRelease(){
+		// the proof-of-work covers the entry itself
+		return warnings, nil
+	}
+	if b.Version == 0 && len(b.Data)+len(b.Notaries)+len(b.Statuses) > 0{
+		warnings.add("block %d has schema version 0: its merkle root was not recomputed", b.Height)
+		return warnings, nil
+	}
+	root := merkleRoot(b, d)
+	if d.err != nil{
+		return warnings, d.err
+	}
+	if !bytes.Equal(root, merkle){
+		return warnings, fmt.Errorf("%w: merkle root does not match the block entries", ErrInvalidBlock)
+	}
+	return warnings, nil
+}
+
+// verifyWork checks that the hash of a mined block meets the target of its
+// difficulty
+func verifyWork(b *Block, hash []byte, opts Options) error{
+	if b.Difficulty < MinDifficulty || b.Difficulty > MaxDifficulty{
+		return fmt.Errorf("%w: difficulty %d out of range", ErrInvalidSeal, b.Difficulty)
+	}
+	if b.Difficulty < opts.MinDifficulty{
+		return fmt.Errorf("%w: difficulty %d, at least %d expected", ErrInvalidSeal, b.Difficulty, opts.MinDifficulty)
+	}
+	target := new(big.Int).Lsh(big.NewInt(1), uint(256 - b.Difficulty))
+	if new(big.Int).SetBytes(hash).Cmp(target) != -1{
+		return fmt.Errorf("%w: proof-of-work does not meet the target", ErrInvalidSeal)
+	}
+	return nil
+}
+
+// verifySignature checks a block signed by its proposer: a BFT commit when
+// the block has one, the signature of its signer otherwise
+func verifySignature(b *Block, hash []byte, opts Options, warnings *Warnings) error{
+	signer, err := peer.Decode(b.Signer)
+	if err != nil{
+		return fmt.Errorf("%w: invalid signer: %v", ErrInvalidSeal, err)
+	}
+	authorities := map[peer.ID]bool{}
+	for _, encoded := range opts.Authorities{
+		id, err := peer.Decode(encoded)
+		if err != nil{
+			return fmt.Errorf("authority %q: %w", encoded, err)
+		}
+		authorities[id] = true
+	}
+	if len(authorities) > 0 && !authorities[signer]{
+		return fmt.Errorf("%w: signer %s is not an authority", ErrInvalidSeal, signer)
+	}
+
+	if len(b.Commit) > 0{
+		return verifyCommit(b, hash, authorities, warnings)
+	}
+
+	if len(authorities) == 0{
+		warnings.add("block %d is signed by %s, which was not checked against the authorities", b.Height, signer)
+	}
+	pubKey, err := signer.ExtractPublicKey()
+	if err != nil{
+		return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	signature := (&decoder{}).base64("signature", b.Signature)
+	ok, err := pubKey.Verify(hash, signature)
+	if err != nil || !ok{
+		return fmt.Errorf("%w: bad signature from %s", ErrInvalidSeal, signer)
+	}
+	return nil
+}
+
+// verifyCommit checks that more than two thirds of the validators
+// precommitted the block. Without the validator set it is only checked that
+// every precommit is valid.
+func verifyCommit(b *Block, hash []byte, validators map[peer.ID]bool, warnings *Warnings) error{
+	signed := map[peer.ID]bool{}
+	for _, sig := range b.Commit{
+		validator, err := peer.Decode(sig.Validator)
+		if err != nil || signed[validator]{
+			continue
+		}
+		if len(validators) > 0 && !validators[validator]{
+			continue
+		}
+		pubKey, err := validator.ExtractPublicKey()
+		if err != nil{
+			continue
+		}
+		signature := (&decoder{}).base64("commit.signature", sig.Signature)
+		ok, err := pubKey.Verify(voteSignBytes(b.Height, sig.Round, hash), signature)
+		if err == nil && ok{
+			signed[validator] = true
+		}
+	}
+
+	if len(validators) == 0{
+		if len(signed) < len(b.Commit){
+			return fmt.Errorf("%w: %d of %d precommits are valid", ErrInvalidSeal, len(signed), len(b.Commit))
+		}
+		warnings.add("block %d is committed by %d validators, which were not checked against the validator set", b.Height, len(signed))
+		return nil
+	}
+	if quorum := 2*len(validators)/3 + 1; len(signed) < quorum{
+		return fmt.Errorf("%w: %d valid precommits, %d needed", ErrInvalidSeal, len(signed), quorum)
+	}
+	return nil
+}
+
+// voteSignBytes returns the bytes a validator signs to precommit a block
+func voteSignBytes(height uint64, round uint32, hash []byte) []byte{
+	buf := append([]byte{}, voteDomain...)
+	buf = append(buf, votePrecommit)
+	buf = binary.BigEndian.AppendUint64(buf, height)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(round))
+	return append(buf, hash...)
+}
+
+// VerifyChain checks every block and that each one extends the previous one.
+// The blocks may be given in any order but must be consecutive.
+func VerifyChain(blocks []*Block, opts Options) (Warnings, error){
+	warnings := Warnings{}
+	if len(blocks) == 0{
+		return warnings, fmt.Errorf("%w: no blocks", ErrBrokenChain)
+	}
+	sorted := append([]*Block{}, blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool{
+		return sorted[i].Height < sorted[j].Height
+	})
+
+	for i, block := range sorted{
+		blockWarnings, err := VerifyBlock(block, opts)
+		warnings = append(warnings, blockWarnings...)
+		if err != nil{
+			return warnings, fmt.Errorf("block %d: %w", block.Height, err)
+		}
+		if i == 0{
+			continue
+		}
+
+		parent := sorted[i-1]
+		switch {
+		case block.Height != parent.Height+1:
+			return warnings, fmt.Errorf("%w: block %d follows block %d", ErrBrokenChain, block.Height, parent.Height)
+		case block.PrevHash != parent.Hash:
+			return warnings, fmt.Errorf("%w: block %d does not extend block %s", ErrBrokenChain, block.Height, parent.Hash)
+		case block.Version < parent.Version:
+			return warnings, fmt.Errorf("%w: block %d has schema version %d after %d", ErrBrokenChain, block.Height, block.Version, parent.Version)
+		case block.Timestamp < parent.Timestamp:
+			return warnings, fmt.Errorf("%w: block %d is older than its parent", ErrBrokenChain, block.Height)
+		}
+	}
+	return warnings, nil
+}
+
+// FindDocument returns the block and entry anchoring the document with the
+// given file hash, in the form blocks hold
+func FindDocument(blocks []*Block, fileHash []byte) (*Block, *Document, error){
+	for _, block := range blocks{
+		for i := range block.Data{
+			d := &decoder{}
+			if bytes.Equal(d.documentHash("data.hash", block.Data[i].Hash), fileHash){
+				return block, &block.Data[i], nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %x", ErrDocumentNotFound, fileHash)
+}
+
+// VerifyDocument checks that a document is anchored in a block whose merkle
+// root covers it, and that it is signed by the key it carries. The key is
+// not checked against the notary registry, which is kept on the chain.
+func VerifyDocument(b *Block, doc *Document) error{
+	if b.Version == 0{
+		return ErrLegacyBlock
+	}
+	d := &decoder{}
+	root := merkleRoot(b, d)
+	if d.err != nil{
+		return d.err
+	}
+	if !bytes.Equal(root, d.hex("merkleRoot", b.MerkleRoot)){
+		return fmt.Errorf("%w: merkle root does not match the block entries", ErrInvalidBlock)
+	}
+	return doc.VerifySignature()
+}
+
+// SigningBytes returns the bytes the notary of a document signs: the domain
+// followed by the hash, document ID, notary ID, user ID and CNPJ, each as a
+// 4 byte big endian length and the bytes themselves
+func (doc *Document) SigningBytes() ([]byte, error){
+	d := &decoder{}
+	hash := d.documentHash("data.hash", doc.Hash)
+	if d.err != nil{
+		return nil, d.err
+	}
+
+	buf := append([]byte{}, documentDomain...)
+	for _, field := range [][]byte{
+		hash,
+		[]byte(doc.DocumentID),
+		[]byte(doc.NotaryID),
+		[]byte(doc.UserID),
+		[]byte(doc.CNPJ),
+	}{
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(field)))
+		buf = append(buf, field...)
+	}
+	return buf, nil
+}
+
+// VerifySignature checks the signature of a document by its public key, a
+// DER encoded SubjectPublicKeyInfo holding an Ed25519 or an ECDSA P-256 key
+func (doc *Document) VerifySignature() error{
+	d := &decoder{}
+	der := d.base64("data.publicKey", doc.PublicKey)
+	signature := d.base64("data.signature", doc.Signature)
+	if d.err != nil{
+		return d.err
+	}
+	if len(der) == 0 || len(signature) == 0{
+		return fmt.Errorf("%w: document is not signed", ErrInvalidSignature)
+	}
+	message, err := doc.SigningBytes()
+	if err != nil{
+		return err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil{
+		return fmt.Errorf("%w: public key: %v", ErrInvalidSignature, err)
+	}
+	switch key := key.(type){
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, message, signature){
+			return fmt.Errorf("%w: bad Ed25519 signature", ErrInvalidSignature)
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256(){
+			return fmt.Errorf("%w: ECDSA keys must use the P-256 curve", ErrInvalidSignature)
+		}
+		digest := sha256.Sum256(message)
+		if !verifyECDSA(key, digest[:], signature){
+			return fmt.Errorf("%w: bad ECDSA signature", ErrInvalidSignature)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported %T public key", ErrInvalidSignature, key)
+	}
+	return nil
+}
+
+// verifyECDSA accepts both r || s and ASN.1 DER signatures
+func verifyECDSA(key *ecdsa.PublicKey, digest []byte, signature []byte) bool{
+	if len(signature) == 64{
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if ecdsa.Verify(key, digest, r, s){
+			return true
+		}
+	}
+	return ecdsa.VerifyASN1(key, digest, signature)
+}
+
+func sha256Sum(data []byte) []byte{
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
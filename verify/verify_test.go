@@ -0,0 +1,177 @@
+package verify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"blockchain-service/internal/blockchain"
+	"blockchain-service/internal/models"
+)
+
+// devChain returns a new dev chain, whose blocks are mined at a low
+// difficulty
+func devChain(t *testing.T) *blockchain.BlockChain{
+	t.Helper()
+	t.Chdir(t.TempDir())
+	params, err := blockchain.NetworkParams("dev")
+	if err != nil{
+		t.Fatal(err)
+	}
+	engine, err := blockchain.NewEngine(params, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	chain, err := blockchain.InitBlockChain(0, params, engine)
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func(){ chain.Database.Close() })
+	return chain
+}
+
+// document returns the entry of a document signed by notary
+func document(t *testing.T, notary ed25519.PrivateKey, name string) blockchain.BlockData{
+	t.Helper()
+	hash := sha256.Sum256([]byte(name))
+	data := blockchain.BlockData{
+		Hash: hash[:],
+		DocumentID: "mom-" + name,
+		NotaryID: "21122ee1-a5bc-4fcc-bead-065acfc38edf",
+		UserID: "a101fb26-8b78-4e93-9fab-67d291a28fb7",
+		CNPJ: "11.222.333/0001-81",
+	}
+	if err := data.Sign(notary); err != nil{
+		t.Fatal(err)
+	}
+	return data
+}
+
+func notaryKey(seed byte) ed25519.PrivateKey{
+	s := make([]byte, ed25519.SeedSize)
+	s[0] = seed
+	return ed25519.NewKeyFromSeed(s)
+}
+
+// exported returns the blocks as read back from the JSON of the API
+func exported(t *testing.T, blocks ...*blockchain.Block) []*Block{
+	t.Helper()
+	api := []models.BlockAPI{}
+	for _, block := range blocks{
+		api = append(api, models.FromBlock(block))
+	}
+	encoded, err := json.Marshal(api)
+	if err != nil{
+		t.Fatal(err)
+	}
+	parsed, err := ParseBlocks(encoded)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// anchored returns the genesis block and a block anchoring deed.pdf and
+// will.pdf, as exported
+func anchored(t *testing.T) []*Block{
+	t.Helper()
+	chain := devChain(t)
+	block, err := chain.CreateInsertBlock(context.Background(), []blockchain.BlockData{
+		document(t, notaryKey(0), "deed.pdf"),
+		document(t, notaryKey(0), "will.pdf"),
+	}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	genesis, err := chain.GetBlockByHeight(0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return exported(t, genesis, block)
+}
+
+func TestMatchingDocument(t *testing.T){
+	blocks := anchored(t)
+	if _, err := VerifyChain(blocks, Options{}); err != nil{
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("deed.pdf"))
+	block, doc, err := FindDocument(blocks, hash[:])
+	if err != nil{
+		t.Fatal(err)
+	}
+	if block.Height != 1 || doc.DocumentID != "mom-deed.pdf"{
+		t.Fatalf("found %s in block %d", doc.DocumentID, block.Height)
+	}
+	if err := VerifyDocument(block, doc); err != nil{
+		t.Fatal(err)
+	}
+
+	other := sha256.Sum256([]byte("lease.pdf"))
+	if _, _, err := FindDocument(blocks, other[:]); !errors.Is(err, ErrDocumentNotFound){
+		t.Fatalf("FindDocument of a document not anchored: %v", err)
+	}
+}
+
+func TestTamperedBlockHash(t *testing.T){
+	blocks := anchored(t)
+	block := blocks[1]
+	last := "0"
+	if block.Hash[len(block.Hash)-1] == '0'{
+		last = "1"
+	}
+	block.Hash = block.Hash[:len(block.Hash)-1] + last
+	if _, err := VerifyBlock(block, Options{}); !errors.Is(err, ErrInvalidBlock){
+		t.Fatalf("VerifyBlock of a tampered hash: %v", err)
+	}
+	if _, err := VerifyChain(blocks, Options{}); !errors.Is(err, ErrInvalidBlock){
+		t.Fatalf("VerifyChain of a tampered hash: %v", err)
+	}
+}
+
+func TestTamperedMerkleStep(t *testing.T){
+	// will.pdf is the sibling of deed.pdf in the merkle tree: changing it
+	// changes the step that leads from deed.pdf to the root
+	blocks := anchored(t)
+	block := blocks[1]
+	block.Data[1].DocumentID = "mom-lease.pdf"
+	if _, err := VerifyBlock(block, Options{}); !errors.Is(err, ErrInvalidBlock){
+		t.Fatalf("VerifyBlock of a tampered sibling: %v", err)
+	}
+	if err := VerifyDocument(block, &block.Data[0]); !errors.Is(err, ErrInvalidBlock){
+		t.Fatalf("VerifyDocument under a tampered sibling: %v", err)
+	}
+
+	blocks = anchored(t)
+	block = blocks[1]
+	block.MerkleRoot = blocks[0].Hash
+	if _, err := VerifyBlock(block, Options{}); !errors.Is(err, ErrInvalidBlock){
+		t.Fatalf("VerifyBlock of a tampered merkle root: %v", err)
+	}
+	if err := VerifyDocument(block, &block.Data[0]); !errors.Is(err, ErrInvalidBlock){
+		t.Fatalf("VerifyDocument under a tampered merkle root: %v", err)
+	}
+}
+
+func TestWrongNotarySignature(t *testing.T){
+	chain := devChain(t)
+	data := document(t, notaryKey(0), "deed.pdf")
+	data.Signature = document(t, notaryKey(1), "deed.pdf").Signature
+
+	// the block is sealed but never inserted, as the chain refuses the
+	// document
+	block, err := chain.CreateBlock(context.Background(), []blockchain.BlockData{data}, nil, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	blocks := exported(t, block)
+	if _, err := VerifyBlock(blocks[0], Options{}); err != nil{
+		t.Fatal(err)
+	}
+	if err := VerifyDocument(blocks[0], &blocks[0].Data[0]); !errors.Is(err, ErrInvalidSignature){
+		t.Fatalf("VerifyDocument of a document signed by another key: %v", err)
+	}
+}